@@ -0,0 +1,188 @@
+package ableton
+
+import (
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ////////////////////// DRUM RACK PRESETS ////////////////////////
+
+// The Live version written into presets. Newer versions open older presets without complaint.
+const (
+	majorVersion = "5"
+	minorVersion = "11.0_433"
+	creator      = "Ableton Live 11.0"
+)
+
+// Live's marker for presets that came from outside a Live pack
+const overwriteProtectionNumber = 2816
+
+// A drum rack pad playing one sample through a Simpler
+type DrumPad struct {
+	Name       string
+	Path       string // absolute path to the sample
+	Note       int    // midi note the pad receives, 36 is C1 in Live
+	Frames     int
+	SampleRate int
+}
+
+// A pad for an exported sample, named after the sample without its extension
+func NewDrumPad(name string, path string, note int, frames int, sampleRate int) DrumPad {
+	return DrumPad{
+		Name:       strings.TrimSuffix(name, filepath.Ext(name)),
+		Path:       path,
+		Note:       note,
+		Frames:     frames,
+		SampleRate: sampleRate,
+	}
+}
+
+// Write a gzip compressed .adg drum rack preset with a pad per sample. Sample paths are stored both absolute and
+// relative to the preset, so Live can find them after the folder moves.
+func WriteDrumRack(destination string, pads []DrumPad) error {
+	presets := make([]node, 0, len(pads))
+	for i, pad := range pads {
+		if pad.Note < 0 || pad.Note > 127 {
+			return errors.New(fmt.Sprintf("pad %s has note %d, outside the rack", pad.Name, pad.Note))
+		}
+		relative, err := filepath.Rel(filepath.Dir(destination), pad.Path)
+		if err != nil {
+			relative = pad.Path
+		}
+		presets = append(presets, drumBranchPreset(i, pad, filepath.ToSlash(relative)))
+	}
+	document := el("Ableton",
+		el("GroupDevicePreset",
+			val("OverwriteProtectionNumber", overwriteProtectionNumber),
+			el("Device", withId(0, el("DrumGroupDevice",
+				val("LomId", 0),
+				val("IsExpanded", true),
+				param("On", true),
+				val("UserName", ""),
+				val("Annotation", ""),
+				el("Branches"),
+				val("IsBranchesListVisible", false),
+				val("IsReturnBranchesListVisible", false),
+				val("IsRangesEditorVisible", false),
+				val("AreDevicesVisible", true),
+				val("NumVisiblePads", 16),
+				val("AreSendsVisible", false),
+				val("ArePadsVisible", true),
+				val("PadScrollPosition", 9),
+			))),
+			el("BranchPresets", presets...),
+			el("ReturnBranchPresets"),
+		),
+	)
+	document.Attrs = []xml.Attr{
+		{Name: xml.Name{Local: "MajorVersion"}, Value: majorVersion},
+		{Name: xml.Name{Local: "MinorVersion"}, Value: minorVersion},
+		{Name: xml.Name{Local: "SchemaChangeCount"}, Value: "3"},
+		{Name: xml.Name{Local: "Creator"}, Value: creator},
+		{Name: xml.Name{Local: "Revision"}, Value: ""},
+	}
+	body, err := xml.MarshalIndent(document, "", "\t")
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	w := gzip.NewWriter(f)
+	_, err = w.Write(append([]byte(xml.Header), body...))
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(destination)
+	}
+	return err
+}
+
+// One pad of the rack, holding a Simpler and the note it responds to
+func drumBranchPreset(id int, pad DrumPad, relative string) node {
+	return withId(id, el("DrumBranchPreset",
+		val("Name", pad.Name),
+		val("IsSoloed", false),
+		el("DevicePresets", withId(0, el("AbletonDevicePreset",
+			val("OverwriteProtectionNumber", overwriteProtectionNumber),
+			el("Device", simpler(pad, relative)),
+			el("PresetRef"),
+		))),
+		el("MixerPreset", withId(0, el("AbletonDevicePreset",
+			val("OverwriteProtectionNumber", overwriteProtectionNumber),
+			el("Device", withId(0, el("AudioBranchMixerDevice",
+				val("LomId", 0),
+				param("On", true),
+				param("Speaker", true),
+				param("Volume", 1),
+				param("Panorama", 0),
+			))),
+			el("PresetRef"),
+		))),
+		el("ZoneSettings",
+			// Live counts pads down from the top of the rack, so notes are stored inverted
+			val("ReceivingNote", 128-pad.Note),
+			val("SendingNote", 60),
+			val("ChokeGroup", 0),
+		),
+	))
+}
+
+// A Simpler in one shot mode playing the whole sample at its original pitch on C3
+func simpler(pad DrumPad, relative string) node {
+	return withId(0, el("OriginalSimpler",
+		val("LomId", 0),
+		param("On", true),
+		val("UserName", pad.Name),
+		el("Player",
+			el("MultiSampleMap",
+				el("SampleParts", withId(0, el("MultiSamplePart",
+					val("LomId", 0),
+					val("Name", pad.Name),
+					val("Selection", true),
+					val("IsActive", true),
+					val("Solo", false),
+					el("KeyRange", val("Min", 0), val("Max", 127), val("CrossfadeMin", 0), val("CrossfadeMax", 127)),
+					el("VelocityRange", val("Min", 1), val("Max", 127), val("CrossfadeMin", 1), val("CrossfadeMax", 127)),
+					el("SelectorRange", val("Min", 0), val("Max", 127), val("CrossfadeMin", 0), val("CrossfadeMax", 127)),
+					val("RootKey", 60),
+					val("Detune", 0),
+					val("TuneScale", 100),
+					val("Panorama", 0),
+					val("Volume", 1),
+					val("Link", false),
+					val("SampleStart", 0),
+					val("SampleEnd", pad.Frames),
+					el("SampleRef",
+						el("FileRef",
+							val("RelativePathType", 1),
+							val("RelativePath", relative),
+							val("Path", pad.Path),
+							val("Type", 1),
+							val("LivePackName", ""),
+							val("LivePackId", ""),
+							val("OriginalFileSize", 0),
+							val("OriginalCrc", 0),
+						),
+						val("LastModDate", 0),
+						el("SourceContext"),
+						val("SampleUsageHint", 0),
+						val("DefaultDuration", pad.Frames),
+						val("DefaultSampleRate", pad.SampleRate),
+					),
+				))),
+			),
+		),
+		el("Globals", val("PlaybackMode", 1)),
+	))
+}
@@ -0,0 +1,127 @@
+package ableton
+
+import (
+	"compress/gzip"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jesses-code-adventures/excavator/core"
+)
+
+// A Value attribute, which is where Live keeps most of a preset's settings
+type value struct {
+	Value string `xml:"Value,attr"`
+}
+
+// The parts of a drum rack preset Live needs to load it and play each pad's sample
+type drumRackPreset struct {
+	XMLName      xml.Name `xml:"Ableton"`
+	MajorVersion string   `xml:"MajorVersion,attr"`
+	MinorVersion string   `xml:"MinorVersion,attr"`
+	Device       struct {
+		DrumGroupDevice *struct{} `xml:"DrumGroupDevice"`
+	} `xml:"GroupDevicePreset>Device"`
+	Branches []struct {
+		Id      string `xml:"Id,attr"`
+		Name    value  `xml:"Name"`
+		Simpler *struct {
+			Part struct {
+				SampleStart value `xml:"SampleStart"`
+				SampleEnd   value `xml:"SampleEnd"`
+				FileRef     struct {
+					RelativePathType value `xml:"RelativePathType"`
+					RelativePath     value `xml:"RelativePath"`
+					Path             value `xml:"Path"`
+				} `xml:"SampleRef>FileRef"`
+				DefaultSampleRate value `xml:"SampleRef>DefaultSampleRate"`
+			} `xml:"Player>MultiSampleMap>SampleParts>MultiSamplePart"`
+			PlaybackMode value `xml:"Globals>PlaybackMode"`
+		} `xml:"DevicePresets>AbletonDevicePreset>Device>OriginalSimpler"`
+		ReceivingNote value `xml:"ZoneSettings>ReceivingNote"`
+	} `xml:"GroupDevicePreset>BranchPresets>DrumBranchPreset"`
+}
+
+// Read back a gzip compressed preset
+func readDrumRack(t *testing.T, path string) drumRackPreset {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var preset drumRackPreset
+	if err := xml.NewDecoder(r).Decode(&preset); err != nil {
+		t.Fatal(err)
+	}
+	return preset
+}
+
+func TestWriteDrumRack(t *testing.T) {
+	dir := t.TempDir()
+	tags := []core.CollectionTag{
+		core.NewCollectionTag(1, "Kick 01.wav", "/samples/kick.wav", "Kit", "/drums"),
+		core.NewCollectionTag(2, "snare", "/samples/snare.aif", "Kit", "/drums"),
+		core.NewCollectionTag(3, "Closed Hat.flac", "/samples/hats/closed.flac", "Kit", "/drums"),
+	}
+	pads := make([]DrumPad, 0, len(tags))
+	for i, tag := range tags {
+		exported := filepath.Join(dir, "drums", filepath.Base(tag.FilePath))
+		pads = append(pads, NewDrumPad(tag.Name(), exported, 36+i, 44100*(i+1), 44100))
+	}
+	destination := filepath.Join(dir, "drums.adg")
+	if err := WriteDrumRack(destination, pads); err != nil {
+		t.Fatal(err)
+	}
+	preset := readDrumRack(t, destination)
+	if preset.MajorVersion != majorVersion || preset.MinorVersion != minorVersion {
+		t.Errorf("written for Live %s %s, want %s %s", preset.MajorVersion, preset.MinorVersion, majorVersion, minorVersion)
+	}
+	if preset.Device.DrumGroupDevice == nil {
+		t.Fatal("preset doesn't hold a drum rack")
+	}
+	if len(preset.Branches) != len(pads) {
+		t.Fatalf("got %d pads, want %d", len(preset.Branches), len(pads))
+	}
+	wantNames := []string{"Kick 01", "snare", "Closed Hat"}
+	wantRelative := []string{"drums/kick.wav", "drums/snare.aif", "drums/closed.flac"}
+	wantEnd := []string{"44100", "88200", "132300"}
+	wantNotes := []string{"92", "91", "90"}
+	for i, branch := range preset.Branches {
+		if branch.Name.Value != wantNames[i] {
+			t.Errorf("pad %d is named %q, want %q", i, branch.Name.Value, wantNames[i])
+		}
+		// Live counts pads down from 128, so 92 is C1
+		if branch.ReceivingNote.Value != wantNotes[i] {
+			t.Errorf("pad %d receives note %s, want %s", i, branch.ReceivingNote.Value, wantNotes[i])
+		}
+		if branch.Simpler == nil {
+			t.Errorf("pad %d has no simpler", i)
+			continue
+		}
+		part := branch.Simpler.Part
+		if part.FileRef.Path.Value != pads[i].Path {
+			t.Errorf("pad %d plays %s, want %s", i, part.FileRef.Path.Value, pads[i].Path)
+		}
+		if part.FileRef.RelativePathType.Value != "1" || part.FileRef.RelativePath.Value != wantRelative[i] {
+			t.Errorf("pad %d has relative path %s of type %s, want %s of type 1", i, part.FileRef.RelativePath.Value, part.FileRef.RelativePathType.Value, wantRelative[i])
+		}
+		if part.SampleStart.Value != "0" || part.SampleEnd.Value != wantEnd[i] {
+			t.Errorf("pad %d plays frames %s to %s, want 0 to %s", i, part.SampleStart.Value, part.SampleEnd.Value, wantEnd[i])
+		}
+		if part.DefaultSampleRate.Value != "44100" {
+			t.Errorf("pad %d has sample rate %s, want 44100", i, part.DefaultSampleRate.Value)
+		}
+		if branch.Simpler.PlaybackMode.Value != "1" {
+			t.Errorf("pad %d isn't one shot, playback mode %s", i, branch.Simpler.PlaybackMode.Value)
+		}
+	}
+	if err := WriteDrumRack(destination, pads); !os.IsExist(err) {
+		t.Errorf("expected an existing preset to be left alone, got %v", err)
+	}
+}
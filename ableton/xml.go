@@ -0,0 +1,36 @@
+package ableton
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// ////////////////////// LIVE XML ////////////////////////
+
+// An element in one of Live's xml documents, which mostly hold their values in a Value attribute
+type node struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []node     `xml:",any"`
+}
+
+// An element holding other elements
+func el(name string, children ...node) node {
+	return node{XMLName: xml.Name{Local: name}, Children: children}
+}
+
+// An element with an Id attribute, as Live gives to devices, branches and the like
+func withId(id int, n node) node {
+	n.Attrs = append([]xml.Attr{{Name: xml.Name{Local: "Id"}, Value: fmt.Sprint(id)}}, n.Attrs...)
+	return n
+}
+
+// An element holding a single value, e.g. <Name Value="Kick" />
+func val(name string, value any) node {
+	return node{XMLName: xml.Name{Local: name}, Attrs: []xml.Attr{{Name: xml.Name{Local: "Value"}, Value: fmt.Sprint(value)}}}
+}
+
+// A parameter Live can automate, reduced to its manual value
+func param(name string, value any) node {
+	return el(name, val("LomId", 0), val("Manual", value))
+}
@@ -0,0 +1,382 @@
+package ableton
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ////////////////////// BROWSER LABELS ////////////////////////
+
+// The folder Live keeps its browser labels in, beside the files they describe
+const FolderInfoDir = "Ableton Folder Info"
+
+// The file name Live gives a folder's labels
+const folderInfoFile = "dc66a3fa-0fe1-5352-91cf-3ec237e9ee90.xmp"
+
+// Separates the levels of a hierarchical label, e.g. "Drums|Kick"
+const LabelSeparator = "|"
+
+// The namespace Live keeps its per-file fields in
+const resourceNamespace = "https://ns.ableton.com/xmp/fs-resources/1.0/"
+
+// How far Live indents each level of a sidecar
+const xmpIndent = "   "
+
+// A sidecar with nothing in it, in the form Live writes them
+const emptySidecar = "<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n" +
+	"<x:xmpmeta xmlns:x=\"adobe:ns:meta/\" x:xmptk=\"XMP Core 5.6.0\">\n" +
+	"   <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n" +
+	"      <rdf:Description rdf:about=\"\"\n" +
+	"            xmlns:dc=\"http://purl.org/dc/elements/1.1/\"\n" +
+	"            xmlns:ablFR=\"" + resourceNamespace + "\">\n" +
+	"         <dc:format>application/vnd.ableton.folder</dc:format>\n" +
+	"         <ablFR:resource>\n" +
+	"            <rdf:Bag>\n" +
+	"            </rdf:Bag>\n" +
+	"         </ablFR:resource>\n" +
+	"      </rdf:Description>\n" +
+	"   </rdf:RDF>\n" +
+	"</x:xmpmeta>\n" +
+	"<?xpacket end=\"w\"?>"
+
+// One file's entry in a sidecar, along with where its labels sit so they can be rewritten in place
+type xmpResource struct {
+	filePath      string
+	keywords      []string
+	indent        string // whitespace before the entry's start tag
+	keywordsStart int64  // offset of the keywords element, or -1 if the entry has none
+	keywordsEnd   int64
+	end           int64 // offset of the entry's end tag, or -1 if it closes itself
+}
+
+// The parts of a sidecar labels live in. Everything else is written back byte for byte.
+type xmpDocument struct {
+	data           []byte
+	resources      []xmpResource
+	rdfPrefix      string
+	resourcePrefix string // what this sidecar calls Live's namespace, usually ablFR
+	bagEnd         int64  // offset of the end tag of the list of entries, or -1 if there isn't one
+	descriptionEnd int64  // offset of the end tag of the first rdf:Description, or -1 if there isn't one
+}
+
+// The whitespace a line starts with, if the element at pos starts the line
+func indentBefore(data []byte, pos int64) string {
+	i := pos
+	for i > 0 && (data[i-1] == ' ' || data[i-1] == '\t') {
+		i--
+	}
+	if i > 0 && data[i-1] != '\n' {
+		return ""
+	}
+	return string(data[i:pos])
+}
+
+// Where to insert whole lines ahead of the element at pos, which is the start of its line if nothing else is on it
+func lineStart(data []byte, pos int64) int64 {
+	i := pos
+	for i > 0 && (data[i-1] == ' ' || data[i-1] == '\t') {
+		i--
+	}
+	if i > 0 && data[i-1] == '\n' {
+		return i
+	}
+	return pos
+}
+
+// A name with the prefix this sidecar uses for its namespace
+func qualify(prefix string, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+// Find every file's entry in a sidecar. Elements are matched by local name beneath any resource element, so any
+// kind of rdf container and either way of writing an rdf resource is understood.
+func parseXmp(data []byte) (xmpDocument, error) {
+	doc := xmpDocument{data: data, rdfPrefix: "rdf", resourcePrefix: "ablFR", bagEnd: -1, descriptionEnd: -1}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	stack := make([]xml.Name, 0)
+	resourceDepth, entryDepth, keywordsDepth := -1, -1, -1
+	var entry *xmpResource
+	var text strings.Builder
+	collecting := false
+	for {
+		start := d.InputOffset()
+		token, err := d.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return doc, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth := len(stack)
+			stack = append(stack, t.Name)
+			switch {
+			case t.Name.Local == "RDF":
+				doc.rdfPrefix = t.Name.Space
+			case t.Name.Local == "resource" && resourceDepth == -1:
+				resourceDepth = depth
+				doc.resourcePrefix = t.Name.Space
+			case resourceDepth != -1 && depth == resourceDepth+2 && t.Name.Local == "li":
+				entry = &xmpResource{indent: indentBefore(data, start), keywordsStart: -1}
+				entryDepth = depth
+			}
+			if entry == nil {
+				continue
+			}
+			for _, attr := range t.Attr {
+				if attr.Name.Local == "filePath" {
+					entry.filePath = strings.TrimSpace(attr.Value)
+				}
+			}
+			switch {
+			case t.Name.Local == "keywords" && keywordsDepth == -1:
+				keywordsDepth = depth
+				entry.keywordsStart = start
+			case t.Name.Local == "filePath" || (keywordsDepth != -1 && t.Name.Local == "li"):
+				collecting = true
+				text.Reset()
+			}
+		case xml.CharData:
+			if collecting {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+			depth := len(stack)
+			if collecting {
+				collecting = false
+				if t.Name.Local == "filePath" {
+					entry.filePath = strings.TrimSpace(text.String())
+				} else {
+					entry.keywords = append(entry.keywords, strings.TrimSpace(text.String()))
+				}
+			}
+			switch {
+			case entry != nil && depth == keywordsDepth:
+				entry.keywordsEnd = d.InputOffset()
+				keywordsDepth = -1
+			case entry != nil && depth == entryDepth:
+				entry.end = start
+				if d.InputOffset() == start {
+					// the entry closed itself, so there's no end tag to put labels ahead of
+					entry.end = -1
+				}
+				doc.resources = append(doc.resources, *entry)
+				entry, entryDepth = nil, -1
+			case resourceDepth != -1 && depth == resourceDepth+1 && doc.bagEnd == -1:
+				doc.bagEnd = start
+			case depth == resourceDepth:
+				resourceDepth = -1
+			case t.Name.Local == "Description" && depth > 0 && stack[depth-1].Local == "RDF" && doc.descriptionEnd == -1:
+				doc.descriptionEnd = start
+			}
+		}
+	}
+	return doc, nil
+}
+
+// A keywords element holding labels, with its first line unindented
+func (doc xmpDocument) keywordsXml(indent string, labels []string) string {
+	var b strings.Builder
+	b.WriteString("<" + qualify(doc.resourcePrefix, "keywords") + ">\n")
+	b.WriteString(indent + xmpIndent + "<" + qualify(doc.rdfPrefix, "Bag") + ">\n")
+	for _, label := range labels {
+		b.WriteString(indent + xmpIndent + xmpIndent + "<" + qualify(doc.rdfPrefix, "li") + ">")
+		xml.EscapeText(&b, []byte(label))
+		b.WriteString("</" + qualify(doc.rdfPrefix, "li") + ">\n")
+	}
+	b.WriteString(indent + xmpIndent + "</" + qualify(doc.rdfPrefix, "Bag") + ">\n")
+	b.WriteString(indent + "</" + qualify(doc.resourcePrefix, "keywords") + ">")
+	return b.String()
+}
+
+// A whole entry for a file, as complete lines
+func (doc xmpDocument) entryXml(indent string, file string, labels []string) string {
+	var b strings.Builder
+	b.WriteString(indent + "<" + qualify(doc.rdfPrefix, "li") + " " + qualify(doc.rdfPrefix, "parseType") + "=\"Resource\">\n")
+	b.WriteString(indent + xmpIndent + "<" + qualify(doc.resourcePrefix, "filePath") + ">")
+	xml.EscapeText(&b, []byte(file))
+	b.WriteString("</" + qualify(doc.resourcePrefix, "filePath") + ">\n")
+	b.WriteString(indent + xmpIndent + doc.keywordsXml(indent+xmpIndent, labels) + "\n")
+	b.WriteString(indent + "</" + qualify(doc.rdfPrefix, "li") + ">\n")
+	return b.String()
+}
+
+// The sidecar with every file given the labels passed in, leaving entries and content it doesn't know about alone
+func (doc xmpDocument) withLabels(labels map[string][]string) ([]byte, error) {
+	type edit struct {
+		start, end int64
+		text       string
+	}
+	edits := make([]edit, 0)
+	files := make([]string, 0, len(labels))
+	for file := range labels {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	var added strings.Builder
+	entryIndent := ""
+	if doc.bagEnd != -1 {
+		entryIndent = indentBefore(doc.data, doc.bagEnd) + xmpIndent
+	} else if doc.descriptionEnd != -1 {
+		entryIndent = indentBefore(doc.data, doc.descriptionEnd) + xmpIndent + xmpIndent + xmpIndent
+	}
+	if len(doc.resources) > 0 {
+		entryIndent = doc.resources[len(doc.resources)-1].indent
+	}
+	for _, file := range files {
+		i := slices.IndexFunc(doc.resources, func(r xmpResource) bool { return r.filePath == file })
+		if i == -1 || (doc.resources[i].keywordsStart == -1 && doc.resources[i].end == -1) {
+			added.WriteString(doc.entryXml(entryIndent, file, labels[file]))
+			continue
+		}
+		resource := doc.resources[i]
+		if slices.Equal(resource.keywords, labels[file]) {
+			continue
+		}
+		if resource.keywordsStart != -1 {
+			indent := indentBefore(doc.data, resource.keywordsStart)
+			edits = append(edits, edit{resource.keywordsStart, resource.keywordsEnd, doc.keywordsXml(indent, labels[file])})
+		} else {
+			indent := resource.indent + xmpIndent
+			at := lineStart(doc.data, resource.end)
+			edits = append(edits, edit{at, at, indent + doc.keywordsXml(indent, labels[file]) + "\n"})
+		}
+	}
+	if added.Len() > 0 {
+		switch {
+		case doc.bagEnd != -1:
+			at := lineStart(doc.data, doc.bagEnd)
+			edits = append(edits, edit{at, at, added.String()})
+		case doc.descriptionEnd != -1:
+			// no list of entries yet, so one is added to the description along with Live's namespace
+			indent := indentBefore(doc.data, doc.descriptionEnd) + xmpIndent
+			bag := qualify(doc.rdfPrefix, "Bag")
+			resource := qualify(doc.resourcePrefix, "resource")
+			namespace := "xmlns"
+			if doc.resourcePrefix != "" {
+				namespace += ":" + doc.resourcePrefix
+			}
+			at := lineStart(doc.data, doc.descriptionEnd)
+			text := indent + "<" + resource + " " + namespace + "=\"" + resourceNamespace + "\">\n" +
+				indent + xmpIndent + "<" + bag + ">\n" +
+				added.String() +
+				indent + xmpIndent + "</" + bag + ">\n" +
+				indent + "</" + resource + ">\n"
+			edits = append(edits, edit{at, at, text})
+		default:
+			return nil, errors.New("the sidecar has no rdf:Description to hold labels")
+		}
+	}
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	var b bytes.Buffer
+	last := int64(0)
+	for _, e := range edits {
+		b.Write(doc.data[last:e.start])
+		b.WriteString(e.text)
+		last = e.end
+	}
+	b.Write(doc.data[last:])
+	return b.Bytes(), nil
+}
+
+// Every label Live has given the files in one folder
+type FolderLabels struct {
+	Dir    string
+	Path   string              // the sidecar they were read from, or will be written to
+	Labels map[string][]string // file name to labels
+}
+
+// Read the labels of every file in dir, merging all the sidecars Live has left there
+func ReadFolderLabels(dir string) (FolderLabels, error) {
+	labels := FolderLabels{Dir: dir, Path: filepath.Join(dir, FolderInfoDir, folderInfoFile), Labels: make(map[string][]string)}
+	sidecars, err := filepath.Glob(filepath.Join(dir, FolderInfoDir, "*.xmp"))
+	if err != nil {
+		return labels, err
+	}
+	sort.Strings(sidecars)
+	for i, sidecar := range sidecars {
+		if i == 0 {
+			labels.Path = sidecar
+		}
+		data, err := os.ReadFile(sidecar)
+		if err != nil {
+			return labels, err
+		}
+		doc, err := parseXmp(data)
+		if err != nil {
+			return labels, err
+		}
+		for _, resource := range doc.resources {
+			for _, keyword := range resource.keywords {
+				labels.Add(resource.filePath, keyword)
+			}
+		}
+	}
+	return labels, nil
+}
+
+// Label a file, returning whether it didn't already have the label
+func (f *FolderLabels) Add(fileName string, label string) bool {
+	label = strings.TrimSpace(label)
+	if fileName == "" || label == "" || slices.Contains(f.Labels[fileName], label) {
+		return false
+	}
+	f.Labels[fileName] = append(f.Labels[fileName], label)
+	return true
+}
+
+// Write the labels back to the folder's sidecar, changing only the labels of files whose labels have changed.
+// Anything else Live keeps in the sidecar is left as it was.
+func (f FolderLabels) Write() error {
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && len(bytes.TrimSpace(data)) == 0) {
+		data = []byte(emptySidecar)
+	} else if err != nil {
+		return err
+	}
+	doc, err := parseXmp(data)
+	if err != nil {
+		return err
+	}
+	edited, err := doc.withLabels(f.Labels)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.Path, edited)
+}
+
+// Replace a file in one step, so Live never sees a half written sidecar
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".*.xmp.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
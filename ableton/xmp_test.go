@@ -0,0 +1,179 @@
+package ableton
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the fixtures in testdata from the current output")
+
+// Put a copy of a fixture sidecar in a new folder's Ableton Folder Info, returning the folder
+func sidecarDir(t *testing.T, fixture string) string {
+	t.Helper()
+	dir := t.TempDir()
+	data, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, FolderInfoDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, FolderInfoDir, folderInfoFile), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestReadFolderLabels(t *testing.T) {
+	labels, err := ReadFolderLabels(sidecarDir(t, "labels.xmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"Kick 01.wav":     {"Drums|Kick"},
+		"Snare & Rim.wav": {"Drums|Snare", "Favourites"},
+	}
+	if len(labels.Labels) != len(want) {
+		t.Errorf("got labels for %d files, want %d: %v", len(labels.Labels), len(want), labels.Labels)
+	}
+	for file, fileLabels := range want {
+		if !slices.Equal(labels.Labels[file], fileLabels) {
+			t.Errorf("%s has labels %v, want %v", file, labels.Labels[file], fileLabels)
+		}
+	}
+}
+
+func TestWriteFolderLabelsRoundTrip(t *testing.T) {
+	dir := sidecarDir(t, "labels.xmp")
+	labels, err := ReadFolderLabels(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := labels.Write(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(labels.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(filepath.Join("testdata", "labels.xmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("writing unchanged labels changed the sidecar:\n%s", got)
+	}
+}
+
+func TestWriteFolderLabelsKeepsOtherContent(t *testing.T) {
+	dir := sidecarDir(t, "labels.xmp")
+	labels, err := ReadFolderLabels(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels.Add("Kick 01.wav", "Kits|Techno")
+	labels.Add("Pad.wav", "Textures")
+	labels.Add("Hat <open>.wav", "Drums|Hat")
+	if err := labels.Write(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(labels.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture := filepath.Join("testdata", "labels_added.xmp")
+	if *update {
+		if err := os.WriteFile(fixture, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("sidecar doesn't match %s:\n%s", fixture, got)
+	}
+	reread, err := ReadFolderLabels(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for file, fileLabels := range labels.Labels {
+		if !slices.Equal(reread.Labels[file], fileLabels) {
+			t.Errorf("%s was written with %v, read back %v", file, fileLabels, reread.Labels[file])
+		}
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, FolderInfoDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the sidecar to be left, found %d files", len(entries))
+	}
+}
+
+func TestWriteFolderLabelsNewSidecar(t *testing.T) {
+	dir := t.TempDir()
+	labels, err := ReadFolderLabels(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels.Add("Kick.wav", "Drums|Kick")
+	if err := labels.Write(); err != nil {
+		t.Fatal(err)
+	}
+	reread, err := ReadFolderLabels(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(reread.Labels["Kick.wav"], []string{"Drums|Kick"}) {
+		t.Errorf("read back %v from a new sidecar", reread.Labels)
+	}
+}
+
+func TestReadFolderLabelsOtherForms(t *testing.T) {
+	dir := t.TempDir()
+	sidecar := `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="" xmlns:a="https://ns.ableton.com/xmp/fs-resources/1.0/">
+   <a:resource>
+    <rdf:Seq>
+     <rdf:li>
+      <rdf:Description a:filePath="Kick.wav">
+       <a:keywords><rdf:Alt><rdf:li>Drums|Kick</rdf:li></rdf:Alt></a:keywords>
+      </rdf:Description>
+     </rdf:li>
+    </rdf:Seq>
+   </a:resource>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+	if err := os.MkdirAll(filepath.Join(dir, FolderInfoDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, FolderInfoDir, folderInfoFile), []byte(sidecar), 0644); err != nil {
+		t.Fatal(err)
+	}
+	labels, err := ReadFolderLabels(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(labels.Labels["Kick.wav"], []string{"Drums|Kick"}) {
+		t.Errorf("read %v", labels.Labels)
+	}
+	labels.Add("Kick.wav", "Kits|House")
+	if err := labels.Write(); err != nil {
+		t.Fatal(err)
+	}
+	reread, err := ReadFolderLabels(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(reread.Labels["Kick.wav"], []string{"Drums|Kick", "Kits|House"}) {
+		t.Errorf("read back %v", reread.Labels)
+	}
+}
@@ -0,0 +1,169 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// ////////////////////// SAMPLE CHAINS ////////////////////////
+
+// One sample's place in a chain, in sample frames
+type Slice struct {
+	Name   string
+	Start  int
+	Length int
+}
+
+// A written chain and where its slices landed
+type Chain struct {
+	SampleRate int
+	Slices     []Slice
+}
+
+// Concatenate sources into a single wav with a cue point and a smpl loop marking each slice. With equal set every
+// slice is padded with silence to the length of the longest, so devices that slice evenly line up with the samples.
+func WriteChain(destination string, sources []string, names []string, options TranscodeOptions, equal bool) (Chain, error) {
+	if len(sources) == 0 {
+		return Chain{}, errors.New("a chain needs at least one sample")
+	}
+	options.Format = FormatWav
+	if err := options.Validate(); err != nil {
+		return Chain{}, err
+	}
+	buffers := make([]Buffer, len(sources))
+	sampleRate := options.SampleRate
+	dither := false
+	sourceBits := 0
+	for i, source := range sources {
+		buffer, resampled, err := decodeForExport(source, sampleRate)
+		if err != nil {
+			return Chain{}, errors.New(fmt.Sprintf("%s: %v", source, err))
+		}
+		// everything is resampled to the first sample's rate when no rate is set
+		if sampleRate == 0 {
+			sampleRate = int(buffer.Format.SampleRate)
+		}
+		dither = dither || resampled
+		sourceBits = max(sourceBits, buffer.Format.Precision*8)
+		buffers[i] = buffer
+	}
+	longest := 0
+	for _, buffer := range buffers {
+		longest = max(longest, len(buffer.Samples))
+	}
+	mono := options.Mono
+	if !mono {
+		// only write stereo when at least one sample actually is
+		mono = true
+		for _, buffer := range buffers {
+			mono = mono && buffer.Format.NumChannels == 1
+		}
+	}
+	slices := make([]Slice, len(buffers))
+	chain := Buffer{Format: buffers[0].Format, Samples: make([][2]float64, 0)}
+	chain.Format.NumChannels = 2
+	for i, buffer := range buffers {
+		slices[i] = Slice{Name: names[i], Start: len(chain.Samples), Length: len(buffer.Samples)}
+		for _, sample := range buffer.Samples {
+			if buffer.Format.NumChannels == 1 {
+				sample[1] = sample[0]
+			}
+			chain.Samples = append(chain.Samples, sample)
+		}
+		if equal {
+			chain.Samples = append(chain.Samples, make([][2]float64, longest-len(buffer.Samples))...)
+			slices[i].Length = longest
+		}
+	}
+	if mono {
+		chain.Format.NumChannels = 1
+	}
+	bitDepth := options.BitDepth
+	if bitDepth == 0 {
+		bitDepth = 16
+		if sourceBits > 16 {
+			bitDepth = 24
+		}
+	}
+	channels, summed := chain.exportChannels(mono)
+	dither = dither || summed || bitDepth < sourceBits
+	quantised := quantiseChannels(channels, bitDepth, dither)
+	err := writePcmFile(destination, FormatWav, quantised, sampleRate, bitDepth, cueChunk(slices), labelChunk(slices), smplChunk(slices, sampleRate))
+	return Chain{SampleRate: sampleRate, Slices: slices}, err
+}
+
+// A cue chunk with a point at the start of each slice
+func cueChunk(slices []Slice) []byte {
+	body := make([]byte, 4, 4+24*len(slices))
+	binary.LittleEndian.PutUint32(body, uint32(len(slices)))
+	for i, slice := range slices {
+		point := make([]byte, 24)
+		binary.LittleEndian.PutUint32(point[0:], uint32(i+1))
+		binary.LittleEndian.PutUint32(point[4:], uint32(slice.Start))
+		copy(point[8:], "data")
+		// chunk start and block start stay zero for uncompressed data
+		binary.LittleEndian.PutUint32(point[20:], uint32(slice.Start))
+		body = append(body, point...)
+	}
+	var buf bytes.Buffer
+	appendChunk(&buf, "cue ", body)
+	return buf.Bytes()
+}
+
+// A LIST/adtl chunk naming each cue point
+func labelChunk(slices []Slice) []byte {
+	var labels bytes.Buffer
+	labels.WriteString("adtl")
+	for i, slice := range slices {
+		body := make([]byte, 4, 5+len(slice.Name))
+		binary.LittleEndian.PutUint32(body, uint32(i+1))
+		body = append(append(body, slice.Name...), 0)
+		appendChunk(&labels, "labl", body)
+	}
+	var buf bytes.Buffer
+	appendChunk(&buf, "LIST", labels.Bytes())
+	return buf.Bytes()
+}
+
+// A smpl chunk with one loop spanning each slice, for samplers that read slices from loop points
+func smplChunk(slices []Slice, sampleRate int) []byte {
+	body := make([]byte, 36, 36+24*len(slices))
+	binary.LittleEndian.PutUint32(body[8:], uint32(1e9/sampleRate))
+	binary.LittleEndian.PutUint32(body[12:], 60)
+	binary.LittleEndian.PutUint32(body[28:], uint32(len(slices)))
+	for i, slice := range slices {
+		loop := make([]byte, 24)
+		binary.LittleEndian.PutUint32(loop[0:], uint32(i+1))
+		binary.LittleEndian.PutUint32(loop[8:], uint32(slice.Start))
+		binary.LittleEndian.PutUint32(loop[12:], uint32(slice.Start+max(slice.Length-1, 0)))
+		body = append(body, loop...)
+	}
+	var buf bytes.Buffer
+	appendChunk(&buf, "smpl", body)
+	return buf.Bytes()
+}
+
+// Write the slice positions as csv, for devices and tools that can't read markers
+func (c Chain) WriteSliceList(destination string) error {
+	f, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"slice", "name", "start", "length", "start_seconds"})
+	for i, slice := range c.Slices {
+		seconds := strconv.FormatFloat(float64(slice.Start)/float64(c.SampleRate), 'f', 6, 64)
+		w.Write([]string{strconv.Itoa(i + 1), slice.Name, strconv.Itoa(slice.Start), strconv.Itoa(slice.Length), seconds})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,154 @@
+package audio
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ////////////////////// CLASSIFICATION ////////////////////////
+
+// Instrument category enum
+type Category int
+
+// Instrument category enum values
+const (
+	Unclassified Category = iota
+	Kick
+	Snare
+	Clap
+	Hat
+	Perc
+	Bass
+	Fx
+	Vocal
+	Loop
+	OneShot
+)
+
+// String representation of a category
+func (c Category) String() string {
+	return [...]string{"", "kick", "snare", "clap", "hat", "perc", "bass", "fx", "vocal", "loop", "one-shot"}[c]
+}
+
+// Construct a category from its string representation
+func CategoryFromString(s string) Category {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for c := Kick; c <= OneShot; c++ {
+		if c.String() == s {
+			return c
+		}
+	}
+	return Unclassified
+}
+
+// Filename and path words that suggest a category
+var categoryTokens = map[string]Category{
+	"kick": Kick, "kicks": Kick, "kik": Kick, "kck": Kick, "bd": Kick, "bassdrum": Kick,
+	"snare": Snare, "snares": Snare, "snr": Snare, "sd": Snare, "rim": Snare, "rimshot": Snare,
+	"clap": Clap, "claps": Clap, "clp": Clap, "snap": Clap, "snaps": Clap,
+	"hat": Hat, "hats": Hat, "hihat": Hat, "hihats": Hat, "hh": Hat, "chh": Hat, "ohh": Hat, "cymbal": Hat, "ride": Hat, "crash": Hat,
+	"perc": Perc, "percs": Perc, "percussion": Perc, "tom": Perc, "toms": Perc, "conga": Perc, "bongo": Perc, "shaker": Perc, "tamb": Perc, "tambourine": Perc, "cowbell": Perc, "clave": Perc,
+	"bass": Bass, "basses": Bass, "sub": Bass, "808": Bass, "reese": Bass,
+	"fx": Fx, "sfx": Fx, "riser": Fx, "impact": Fx, "sweep": Fx, "noise": Fx, "whoosh": Fx, "downlifter": Fx, "uplifter": Fx, "transition": Fx,
+	"vocal": Vocal, "vocals": Vocal, "vox": Vocal, "voice": Vocal, "acapella": Vocal, "chant": Vocal, "phrase": Vocal,
+	"loop": Loop, "loops": Loop,
+	"oneshot": OneShot, "oneshots": OneShot, "shot": OneShot, "shots": OneShot,
+}
+
+var (
+	tokenSplitter = regexp.MustCompile(`[^a-z0-9]+`)
+	bpmToken      = regexp.MustCompile(`^\d{2,3}bpm$`)
+)
+
+// Lower case words in a string, split on anything that isn't a letter or digit
+func Tokens(s string) []string {
+	return strings.Fields(tokenSplitter.ReplaceAllString(strings.ToLower(s), " "))
+}
+
+// Score categories from the words in a path. Filename words count for more than directory names, and
+// directories closer to the file count for more than those further up.
+func scoreTokens(path string, scores map[Category]float64) {
+	dir, file := filepath.Split(path)
+	file = strings.TrimSuffix(file, filepath.Ext(file))
+	for _, token := range Tokens(file) {
+		if category, ok := categoryTokens[token]; ok {
+			scores[category] += 1.0
+		} else if bpmToken.MatchString(token) {
+			scores[Loop] += 0.8
+		}
+	}
+	dirs := strings.Split(strings.Trim(dir, string(filepath.Separator)), string(filepath.Separator))
+	weight := 0.6
+	for i := len(dirs) - 1; i >= 0 && weight > 0.1; i-- {
+		for _, token := range Tokens(dirs[i]) {
+			if category, ok := categoryTokens[token]; ok {
+				scores[category] += weight
+			}
+		}
+		weight /= 2
+	}
+}
+
+// Score categories from what the sound actually looks like
+func scoreFeatures(f Features, scores map[Category]float64) {
+	short := f.Duration < 1.5
+	switch {
+	case short && f.Centroid < 500:
+		scores[Kick] += 0.7
+	case short && f.Centroid > 6000:
+		scores[Hat] += 0.7
+	case short && f.Centroid >= 1200 && f.Centroid <= 5000:
+		scores[Snare] += 0.35
+		scores[Clap] += 0.35
+		scores[Perc] += 0.2
+	case short:
+		scores[Perc] += 0.4
+	}
+	if f.Centroid < 350 && f.Duration >= 0.3 && f.Attack > 0.01 {
+		scores[Bass] += 0.5
+	}
+	if f.Duration > 3 && f.Attack > 0.5 {
+		scores[Fx] += 0.4
+	}
+	if f.Duration > 2.5 {
+		scores[Loop] += 0.3
+	}
+}
+
+// Guess a category from the words in a path alone, for when a file hasn't been analysed
+func ClassifyPath(path string) Category {
+	scores := make(map[Category]float64)
+	scoreTokens(path, scores)
+	best, bestScore := Unclassified, 0.0
+	for category := Kick; category <= OneShot; category++ {
+		if scores[category] > bestScore {
+			best, bestScore = category, scores[category]
+		}
+	}
+	return best
+}
+
+// Label a sample with a category using its path and audio features. Returns the category and a confidence between 0 and 1.
+func Classify(path string, f Features) (Category, float64) {
+	scores := make(map[Category]float64)
+	scoreTokens(path, scores)
+	scoreFeatures(f, scores)
+	best, bestScore, total := Unclassified, 0.0, 0.0
+	for category := Kick; category <= OneShot; category++ {
+		score := scores[category]
+		total += score
+		if score > bestScore {
+			best, bestScore = category, score
+		}
+	}
+	if best == Unclassified {
+		if f.Duration > 2.5 {
+			return Loop, 0.2
+		}
+		return OneShot, 0.2
+	}
+	// a clear winner with plenty of evidence is trusted more than a narrow or thin one
+	confidence := (bestScore / total) * min(bestScore/1.5, 1)
+	return best, confidence
+}
@@ -0,0 +1,135 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gopxl/beep"
+	"github.com/gopxl/beep/flac"
+	"github.com/gopxl/beep/mp3"
+	"github.com/gopxl/beep/wav"
+)
+
+// ////////////////////// DECODING ////////////////////////
+
+// Get a streamer for an open audio file, choosing the decoder from the path's extension
+func GetStreamer(path string, f *os.File) (beep.StreamSeekCloser, beep.Format, error) {
+	var streamer beep.StreamSeekCloser
+	var format beep.Format
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		streamer, format, err = mp3.Decode(f)
+	case ".wav":
+		streamer, format, err = wav.Decode(f)
+	case ".flac":
+		streamer, format, err = flac.Decode(f)
+	default:
+		err = errors.New(fmt.Sprintf("Unsupported audio file type: %v", filepath.Ext(path)))
+	}
+	if err != nil {
+		return nil, format, err
+	}
+	return streamer, format, nil
+}
+
+// Length of an audio file in sample frames along with its format, without decoding it all
+func Length(path string) (int, beep.Format, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, beep.Format{}, err
+	}
+	defer f.Close()
+	streamer, format, err := GetStreamer(path, f)
+	if err != nil {
+		return 0, format, err
+	}
+	defer streamer.Close()
+	return streamer.Len(), format, nil
+}
+
+// Length of an audio file in seconds, without decoding it all
+func Duration(path string) (float64, error) {
+	frames, format, err := Length(path)
+	if err != nil {
+		return 0, err
+	}
+	return format.SampleRate.D(frames).Seconds(), nil
+}
+
+// Decoded audio held in memory
+type Buffer struct {
+	Format  beep.Format
+	Samples [][2]float64
+}
+
+// Decode an entire audio file into memory at full level
+func DecodeFile(path string) (Buffer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Buffer{}, err
+	}
+	defer f.Close()
+	streamer, format, err := GetStreamer(path, f)
+	if err != nil {
+		return Buffer{}, err
+	}
+	defer streamer.Close()
+	samples := make([][2]float64, 0, max(streamer.Len(), 0))
+	chunk := make([][2]float64, 4096)
+	for {
+		n, ok := streamer.Stream(chunk)
+		samples = append(samples, chunk[:n]...)
+		if !ok {
+			break
+		}
+	}
+	if err := streamer.Err(); err != nil {
+		return Buffer{}, err
+	}
+	buffer := Buffer{Format: format, Samples: samples}
+	if strings.ToLower(filepath.Ext(path)) == ".wav" {
+		buffer = buffer.correctWavScale()
+	}
+	return buffer, nil
+}
+
+// beep's wav decoder divides 16 and 24 bit samples by 2^n-1 rather than 2^(n-1), so they come back at
+// half level. Everything decoded is brought back to full level, otherwise a wav and a flac of the same
+// audio would fingerprint differently and a transcoded wav would come out 6db quieter.
+func (b Buffer) correctWavScale() Buffer {
+	bits := b.Format.Precision * 8
+	if bits != 16 && bits != 24 {
+		return b
+	}
+	factor := float64(int64(1)<<bits-1) / float64(int64(1)<<(bits-1))
+	samples := make([][2]float64, len(b.Samples))
+	for i, sample := range b.Samples {
+		samples[i] = [2]float64{sample[0] * factor, sample[1] * factor}
+	}
+	return Buffer{Format: b.Format, Samples: samples}
+}
+
+// The buffer summed to a single channel
+func (b Buffer) Mono() []float64 {
+	mono := make([]float64, len(b.Samples))
+	for i, sample := range b.Samples {
+		if b.Format.NumChannels == 1 {
+			mono[i] = sample[0]
+		} else {
+			mono[i] = (sample[0] + sample[1]) / 2
+		}
+	}
+	return mono
+}
+
+// Length of the buffer in seconds
+func (b Buffer) Seconds() float64 {
+	if b.Format.SampleRate == 0 {
+		return 0
+	}
+	return float64(len(b.Samples)) / float64(b.Format.SampleRate)
+}
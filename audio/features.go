@@ -0,0 +1,201 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Analysis settings for feature extraction
+const (
+	featureFFT         = 2048
+	featureMaxSeconds  = 30 // long loops are only analysed up to this point
+	featureMelBands    = 26
+	FeatureCoeffs      = 13
+	featureRolloff     = 0.85
+	featureEnvelopeHop = 0.005 // seconds per envelope step when measuring attack
+)
+
+// Audio descriptors used to compare how similar two sounds are
+type Features struct {
+	Centroid float64   // spectral centroid in Hz
+	Rolloff  float64   // frequency below which 85% of the spectral energy sits, in Hz
+	Envelope []float64 // MFCC-style cepstral coefficients of the average spectrum
+	Duration float64   // seconds
+	Attack   float64   // seconds from onset to peak level
+}
+
+// Extract features from an audio file
+func NewFeatures(path string) (Features, error) {
+	buffer, err := DecodeFile(path)
+	if err != nil {
+		return Features{}, err
+	}
+	return NewFeaturesFromBuffer(buffer), nil
+}
+
+// Extract features from decoded audio
+func NewFeaturesFromBuffer(buffer Buffer) Features {
+	mono := buffer.Mono()
+	sampleRate := float64(buffer.Format.SampleRate)
+	features := Features{Duration: buffer.Seconds(), Envelope: make([]float64, FeatureCoeffs)}
+	if len(mono) == 0 || sampleRate == 0 {
+		return features
+	}
+	analysed := mono
+	if limit := int(featureMaxSeconds * sampleRate); len(analysed) > limit {
+		analysed = analysed[:limit]
+	}
+	spectrum := averagePowerSpectrum(analysed)
+	binHz := sampleRate / 2 / float64(len(spectrum))
+	total, weighted := 0.0, 0.0
+	for bin, power := range spectrum {
+		total += power
+		weighted += power * float64(bin) * binHz
+	}
+	if total > 0 {
+		features.Centroid = weighted / total
+		running := 0.0
+		for bin, power := range spectrum {
+			running += power
+			if running >= featureRolloff*total {
+				features.Rolloff = float64(bin) * binHz
+				break
+			}
+		}
+	}
+	features.Envelope = cepstrum(spectrum, sampleRate)
+	features.Attack = attackTime(mono, sampleRate)
+	return features
+}
+
+// Mean power spectrum across half-overlapping frames
+func averagePowerSpectrum(samples []float64) []float64 {
+	window := HannWindow(featureFFT)
+	spectrum := make([]float64, featureFFT/2)
+	frames := 0
+	for offset := 0; offset == 0 || offset+featureFFT <= len(samples); offset += featureFFT / 2 {
+		for bin, magnitude := range MagnitudeSpectrum(samples, offset, window) {
+			spectrum[bin] += magnitude * magnitude
+		}
+		frames++
+	}
+	for bin := range spectrum {
+		spectrum[bin] /= float64(frames)
+	}
+	return spectrum
+}
+
+func hzToMel(hz float64) float64 {
+	return 2595 * math.Log10(1+hz/700)
+}
+
+func melToHz(mel float64) float64 {
+	return 700 * (math.Pow(10, mel/2595) - 1)
+}
+
+// Log mel band energies of a power spectrum, decorrelated with a DCT
+func cepstrum(spectrum []float64, sampleRate float64) []float64 {
+	nyquist := sampleRate / 2
+	binHz := nyquist / float64(len(spectrum))
+	maxMel := hzToMel(math.Min(nyquist, 16000))
+	centres := make([]float64, featureMelBands+2)
+	for i := range centres {
+		centres[i] = melToHz(maxMel * float64(i) / float64(featureMelBands+1))
+	}
+	energies := make([]float64, featureMelBands)
+	for band := 0; band < featureMelBands; band++ {
+		low, centre, high := centres[band], centres[band+1], centres[band+2]
+		for bin, power := range spectrum {
+			freq := float64(bin) * binHz
+			var weight float64
+			switch {
+			case freq > low && freq <= centre:
+				weight = (freq - low) / (centre - low)
+			case freq > centre && freq < high:
+				weight = (high - freq) / (high - centre)
+			}
+			energies[band] += weight * power
+		}
+		energies[band] = math.Log(energies[band] + 1e-10)
+	}
+	coeffs := make([]float64, FeatureCoeffs)
+	for k := range coeffs {
+		for n, energy := range energies {
+			coeffs[k] += energy * math.Cos(math.Pi*float64(k)*(float64(n)+0.5)/featureMelBands)
+		}
+	}
+	return coeffs
+}
+
+// Time from the signal first rising above 10% of its peak to the peak itself
+func attackTime(samples []float64, sampleRate float64) float64 {
+	hop := max(int(featureEnvelopeHop*sampleRate), 1)
+	envelope := make([]float64, 0, len(samples)/hop+1)
+	for offset := 0; offset < len(samples); offset += hop {
+		end := min(offset+hop, len(samples))
+		sum := 0.0
+		for _, sample := range samples[offset:end] {
+			sum += sample * sample
+		}
+		envelope = append(envelope, math.Sqrt(sum/float64(end-offset)))
+	}
+	peak, peakIndex := 0.0, 0
+	for i, level := range envelope {
+		if level > peak {
+			peak, peakIndex = level, i
+		}
+	}
+	onset := 0
+	for onset < peakIndex && envelope[onset] < peak*0.1 {
+		onset++
+	}
+	return float64(peakIndex-onset) * float64(hop) / sampleRate
+}
+
+// A vector of the features scaled so each contributes comparably to a distance
+func (f Features) Vector() []float64 {
+	vector := []float64{
+		math.Log2(f.Centroid+20) * 2,
+		math.Log2(f.Rolloff+20) * 2,
+		math.Log2(f.Duration + 0.05),
+		math.Log2(f.Attack+0.005) * 0.5,
+	}
+	// the first coefficient mostly tracks loudness, which shouldn't make sounds dissimilar
+	for _, coeff := range f.Envelope[1:] {
+		vector = append(vector, coeff/10)
+	}
+	return vector
+}
+
+// Euclidean distance between two feature sets
+func (f Features) Distance(other Features) float64 {
+	a, b := f.Vector(), other.Vector()
+	sum := 0.0
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+// Serialise the envelope for storage
+func (f Features) EnvelopeBytes() []byte {
+	buf := make([]byte, 8*len(f.Envelope))
+	for i, coeff := range f.Envelope {
+		binary.LittleEndian.PutUint64(buf[i*8:], math.Float64bits(coeff))
+	}
+	return buf
+}
+
+// Deserialise a stored envelope
+func EnvelopeFromBytes(buf []byte) ([]float64, error) {
+	if len(buf) != 8*FeatureCoeffs {
+		return nil, errors.New("stored envelope has the wrong number of coefficients")
+	}
+	envelope := make([]float64, FeatureCoeffs)
+	for i := range envelope {
+		envelope[i] = math.Float64frombits(binary.LittleEndian.Uint64(buf[i*8:]))
+	}
+	return envelope, nil
+}
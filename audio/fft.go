@@ -0,0 +1,66 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// In-place iterative radix-2 FFT. The length of x must be a power of two.
+func FFT(x []complex128) {
+	n := len(x)
+	if n <= 1 {
+		return
+	}
+	// bit reversal permutation
+	j := 0
+	for i := 1; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even := x[start+k]
+				odd := x[start+k+size/2] * w
+				x[start+k] = even + odd
+				x[start+k+size/2] = even - odd
+				w *= step
+			}
+		}
+	}
+}
+
+// A Hann window of the given size
+func HannWindow(size int) []float64 {
+	window := make([]float64, size)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size-1))
+	}
+	return window
+}
+
+// Magnitude spectrum of one windowed frame starting at offset. Samples past the end are treated as silence.
+// Returns size/2 magnitudes.
+func MagnitudeSpectrum(samples []float64, offset int, window []float64) []float64 {
+	size := len(window)
+	buf := make([]complex128, size)
+	for i := 0; i < size; i++ {
+		if offset+i < len(samples) && offset+i >= 0 {
+			buf[i] = complex(samples[offset+i]*window[i], 0)
+		}
+	}
+	FFT(buf)
+	magnitudes := make([]float64, size/2)
+	for i := range magnitudes {
+		magnitudes[i] = cmplx.Abs(buf[i])
+	}
+	return magnitudes
+}
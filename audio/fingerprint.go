@@ -0,0 +1,53 @@
+package audio
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+)
+
+// Samples quieter than this at the start and end of a file are ignored when fingerprinting
+const fingerprintSilence = 1.0 / 32768
+
+// Hash the decoded audio of a file rather than its bytes, so the same sound saved with different
+// containers, metadata or encoders still matches. Audio is quantised to 16 bits and leading and
+// trailing silence is trimmed before hashing.
+func Fingerprint(path string) (string, error) {
+	buffer, err := DecodeFile(path)
+	if err != nil {
+		return "", err
+	}
+	return FingerprintBuffer(buffer), nil
+}
+
+// Hash already decoded audio
+func FingerprintBuffer(buffer Buffer) string {
+	start, end := 0, len(buffer.Samples)
+	for start < end && isSilent(buffer.Samples[start]) {
+		start++
+	}
+	for end > start && isSilent(buffer.Samples[end-1]) {
+		end--
+	}
+	hash := sha256.New()
+	header := make([]byte, 4)
+	binary.LittleEndian.PutUint32(header, uint32(buffer.Format.SampleRate))
+	hash.Write(header)
+	frame := make([]byte, 4)
+	for _, sample := range buffer.Samples[start:end] {
+		binary.LittleEndian.PutUint16(frame[:2], uint16(quantise(sample[0])))
+		binary.LittleEndian.PutUint16(frame[2:], uint16(quantise(sample[1])))
+		hash.Write(frame)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func isSilent(sample [2]float64) bool {
+	return math.Abs(sample[0]) < fingerprintSilence && math.Abs(sample[1]) < fingerprintSilence
+}
+
+// Round a sample to a signed 16 bit value
+func quantise(x float64) int16 {
+	return int16(math.Round(math.Max(-1, math.Min(1, x)) * 32767))
+}
@@ -0,0 +1,38 @@
+package audio
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// A wav and its lossless flac transcode hold the same audio, so they should fingerprint the same
+func TestFingerprintMatchesFlacTranscode(t *testing.T) {
+	for _, bitDepth := range []int{16, 24} {
+		dir := t.TempDir()
+		wavPath := filepath.Join(dir, "tone.wav")
+		flacPath := filepath.Join(dir, "tone.flac")
+		tone := make([]float64, 4410)
+		for i := range tone {
+			tone[i] = 0.8 * math.Sin(2*math.Pi*440*float64(i)/44100)
+		}
+		channels := [][]int32{Quantise(tone, bitDepth, false), Quantise(tone, bitDepth, false)}
+		if err := writePcmFile(wavPath, FormatWav, channels, 44100, bitDepth); err != nil {
+			t.Fatal(err)
+		}
+		if err := Transcode(wavPath, flacPath, TranscodeOptions{Format: FormatFlac}); err != nil {
+			t.Fatal(err)
+		}
+		wavHash, err := Fingerprint(wavPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		flacHash, err := Fingerprint(flacPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wavHash != flacHash {
+			t.Errorf("%dbit wav fingerprint %s doesn't match its flac transcode %s", bitDepth, wavHash, flacHash)
+		}
+	}
+}
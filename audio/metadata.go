@@ -0,0 +1,467 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// ////////////////////// EMBEDDED METADATA ////////////////////////
+
+// Descriptive data vendors embed in sample files. Numeric fields are zero when absent, apart from
+// RootNote and the loop points which use -1.
+type Metadata struct {
+	Title       string
+	Artist      string
+	Description string
+	Genre       string
+	Key         string
+	Tempo       float64
+	RootNote    int
+	LoopStart   int
+	LoopEnd     int
+	Fields      map[string]string // every raw field that was read, keyed by chunk or frame id
+}
+
+// Metadata with nothing known
+func NewMetadata() Metadata {
+	return Metadata{RootNote: -1, LoopStart: -1, LoopEnd: -1, Fields: make(map[string]string)}
+}
+
+var noteNames = [...]string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+// Name of a midi note, e.g. 60 is C3
+func NoteName(note int) string {
+	if note < 0 || note > 127 {
+		return ""
+	}
+	return fmt.Sprintf("%s%d", noteNames[note%12], note/12-2)
+}
+
+// A single line per known field, for display
+func (m Metadata) Lines() []string {
+	lines := make([]string, 0)
+	add := func(name string, value string) {
+		if value != "" {
+			lines = append(lines, fmt.Sprintf("%s: %s", name, value))
+		}
+	}
+	add("title", m.Title)
+	add("artist", m.Artist)
+	add("description", m.Description)
+	add("genre", m.Genre)
+	add("key", m.Key)
+	if m.Tempo > 0 {
+		add("bpm", strconv.FormatFloat(m.Tempo, 'f', -1, 64))
+	}
+	add("root note", NoteName(m.RootNote))
+	if m.LoopStart >= 0 && m.LoopEnd > m.LoopStart {
+		add("loop", fmt.Sprintf("%d - %d", m.LoopStart, m.LoopEnd))
+	}
+	return lines
+}
+
+// Every field as one lower case string, for searching
+func (m Metadata) SearchText() string {
+	parts := m.Lines()
+	keys := make([]string, 0, len(m.Fields))
+	for key := range m.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		parts = append(parts, m.Fields[key])
+	}
+	return strings.ToLower(strings.Join(parts, " "))
+}
+
+// Read the metadata embedded in an audio file
+func ReadMetadata(path string) (Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return NewMetadata(), err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".wav":
+		return readRiffMetadata(f)
+	case ".mp3":
+		return readId3Metadata(f)
+	case ".flac":
+		return readFlacMetadata(f)
+	}
+	return NewMetadata(), errors.New(fmt.Sprintf("Unsupported audio file type: %v", filepath.Ext(path)))
+}
+
+// Trim padding and terminators from a fixed width string field
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
+
+//// RIFF ////
+
+// RIFF INFO ids and the metadata fields they populate
+var riffInfoFields = map[string]string{
+	"INAM": "title",
+	"IART": "artist",
+	"ICMT": "description",
+	"ISBJ": "description",
+	"IGNR": "genre",
+	"IKEY": "keywords",
+}
+
+// Walk the chunks of a wav file, reading bext, LIST/INFO, acid and smpl
+func readRiffMetadata(r io.ReadSeeker) (Metadata, error) {
+	metadata := NewMetadata()
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return metadata, err
+	}
+	if string(header[:4]) != "RIFF" || string(header[8:]) != "WAVE" {
+		return metadata, errors.New("not a RIFF WAVE file")
+	}
+	for {
+		chunkHeader := make([]byte, 8)
+		if _, err := io.ReadFull(r, chunkHeader); err != nil {
+			break
+		}
+		id := string(chunkHeader[:4])
+		size := int64(binary.LittleEndian.Uint32(chunkHeader[4:]))
+		if id == "data" {
+			if _, err := r.Seek(size+size%2, io.SeekCurrent); err != nil {
+				break
+			}
+			continue
+		}
+		if size > 1<<24 {
+			break
+		}
+		body := make([]byte, size)
+		if _, err := io.ReadFull(r, body); err != nil {
+			break
+		}
+		if size%2 == 1 {
+			r.Seek(1, io.SeekCurrent)
+		}
+		switch id {
+		case "bext":
+			parseBext(body, &metadata)
+		case "LIST":
+			parseRiffList(body, &metadata)
+		case "acid":
+			parseAcid(body, &metadata)
+		case "smpl":
+			parseSmpl(body, &metadata)
+		}
+	}
+	return metadata, nil
+}
+
+// Broadcast wave extension: a 256 byte description followed by originator fields
+func parseBext(body []byte, metadata *Metadata) {
+	if len(body) < 256 {
+		return
+	}
+	description := cString(body[:256])
+	metadata.Fields["bext.description"] = description
+	if metadata.Description == "" {
+		metadata.Description = description
+	}
+	if len(body) >= 320 {
+		metadata.Fields["bext.originator"] = cString(body[256:288])
+	}
+}
+
+// LIST chunks; only INFO lists carry descriptive text
+func parseRiffList(body []byte, metadata *Metadata) {
+	if len(body) < 4 || string(body[:4]) != "INFO" {
+		return
+	}
+	for offset := 4; offset+8 <= len(body); {
+		id := string(body[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(body[offset+4:]))
+		start := offset + 8
+		end := start + size
+		if end > len(body) {
+			break
+		}
+		value := cString(body[start:end])
+		metadata.Fields["info."+strings.ToLower(id)] = value
+		switch riffInfoFields[id] {
+		case "title":
+			metadata.Title = value
+		case "artist":
+			metadata.Artist = value
+		case "description":
+			metadata.Description = value
+		case "genre":
+			metadata.Genre = value
+		}
+		offset = end + size%2
+	}
+}
+
+// Acidized wav loop info: root note and tempo
+func parseAcid(body []byte, metadata *Metadata) {
+	if len(body) < 24 {
+		return
+	}
+	flags := binary.LittleEndian.Uint32(body[0:])
+	rootNote := int(binary.LittleEndian.Uint16(body[4:]))
+	beats := binary.LittleEndian.Uint32(body[12:])
+	tempo := float64(math.Float32frombits(binary.LittleEndian.Uint32(body[20:])))
+	// bit 2 is set when the root note is meaningful
+	if flags&0x02 != 0 {
+		metadata.RootNote = rootNote
+	}
+	if tempo > 0 && tempo < 1000 {
+		metadata.Tempo = math.Round(tempo*100) / 100
+	}
+	metadata.Fields["acid.beats"] = strconv.Itoa(int(beats))
+	if flags&0x01 != 0 {
+		metadata.Fields["acid.type"] = "one-shot"
+	} else {
+		metadata.Fields["acid.type"] = "loop"
+	}
+}
+
+// Sampler chunk: unity note and the first loop
+func parseSmpl(body []byte, metadata *Metadata) {
+	if len(body) < 36 {
+		return
+	}
+	unityNote := int(binary.LittleEndian.Uint32(body[12:]))
+	loops := int(binary.LittleEndian.Uint32(body[28:]))
+	if metadata.RootNote == -1 && unityNote >= 0 && unityNote <= 127 {
+		metadata.RootNote = unityNote
+	}
+	if loops > 0 && len(body) >= 60 {
+		metadata.LoopStart = int(binary.LittleEndian.Uint32(body[44:]))
+		metadata.LoopEnd = int(binary.LittleEndian.Uint32(body[48:]))
+	}
+	metadata.Fields["smpl.loops"] = strconv.Itoa(loops)
+}
+
+//// ID3 ////
+
+// Decode a syncsafe integer, where each byte only uses its low seven bits
+func syncsafe(b []byte) int {
+	n := 0
+	for _, c := range b {
+		n = n<<7 | int(c&0x7f)
+	}
+	return n
+}
+
+// Decode the text of an ID3 frame according to its leading encoding byte
+func id3Text(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	encoding, text := b[0], b[1:]
+	switch encoding {
+	case 1, 2:
+		bigEndian := encoding == 2
+		if len(text) >= 2 && text[0] == 0xFE && text[1] == 0xFF {
+			bigEndian, text = true, text[2:]
+		} else if len(text) >= 2 && text[0] == 0xFF && text[1] == 0xFE {
+			bigEndian, text = false, text[2:]
+		}
+		units := make([]uint16, 0, len(text)/2)
+		for i := 0; i+1 < len(text); i += 2 {
+			var unit uint16
+			if bigEndian {
+				unit = binary.BigEndian.Uint16(text[i:])
+			} else {
+				unit = binary.LittleEndian.Uint16(text[i:])
+			}
+			if unit == 0 {
+				break
+			}
+			units = append(units, unit)
+		}
+		return strings.TrimSpace(string(utf16.Decode(units)))
+	case 0:
+		runes := make([]rune, 0, len(text))
+		for _, c := range text {
+			if c == 0 {
+				break
+			}
+			runes = append(runes, rune(c))
+		}
+		return strings.TrimSpace(string(runes))
+	default:
+		return cString(text)
+	}
+}
+
+// Comment frames are encoding, language, a short description and then the text
+func id3Comment(b []byte) string {
+	if len(b) < 4 {
+		return ""
+	}
+	encoding, rest := b[0], b[4:]
+	terminator := []byte{0}
+	if encoding == 1 || encoding == 2 {
+		terminator = []byte{0, 0}
+	}
+	for i := 0; i+len(terminator) <= len(rest); i += len(terminator) {
+		if bytes.Equal(rest[i:i+len(terminator)], terminator) {
+			return id3Text(append([]byte{encoding}, rest[i+len(terminator):]...))
+		}
+	}
+	return ""
+}
+
+// Read ID3v2.3 and v2.4 text frames from the start of an mp3
+func readId3Metadata(r io.Reader) (Metadata, error) {
+	metadata := NewMetadata()
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return metadata, err
+	}
+	if string(header[:3]) != "ID3" {
+		return metadata, nil
+	}
+	version := header[3]
+	if version < 3 {
+		return metadata, nil
+	}
+	body := make([]byte, syncsafe(header[6:10]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return metadata, err
+	}
+	for offset := 0; offset+10 <= len(body); {
+		id := string(body[offset : offset+4])
+		if id[0] == 0 {
+			break
+		}
+		var size int
+		if version == 4 {
+			size = syncsafe(body[offset+4 : offset+8])
+		} else {
+			size = int(binary.BigEndian.Uint32(body[offset+4:]))
+		}
+		start := offset + 10
+		end := start + size
+		if size < 0 || end > len(body) {
+			break
+		}
+		frame := body[start:end]
+		offset = end
+		var value string
+		switch {
+		case id == "COMM":
+			value = id3Comment(frame)
+			if metadata.Description == "" {
+				metadata.Description = value
+			}
+		case strings.HasPrefix(id, "T"):
+			value = id3Text(frame)
+		default:
+			continue
+		}
+		metadata.Fields["id3."+strings.ToLower(id)] = value
+		switch id {
+		case "TIT2":
+			metadata.Title = value
+		case "TPE1":
+			metadata.Artist = value
+		case "TCON":
+			metadata.Genre = value
+		case "TKEY":
+			metadata.Key = value
+		case "TBPM":
+			metadata.Tempo, _ = strconv.ParseFloat(value, 64)
+		}
+	}
+	return metadata, nil
+}
+
+//// FLAC ////
+
+// Read the Vorbis comment block from a flac file
+func readFlacMetadata(r io.Reader) (Metadata, error) {
+	metadata := NewMetadata()
+	marker := make([]byte, 4)
+	if _, err := io.ReadFull(r, marker); err != nil {
+		return metadata, err
+	}
+	if string(marker) != "fLaC" {
+		return metadata, errors.New("not a flac file")
+	}
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return metadata, err
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		size := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		block := make([]byte, size)
+		if _, err := io.ReadFull(r, block); err != nil {
+			return metadata, err
+		}
+		if blockType == 4 {
+			parseVorbisComments(block, &metadata)
+		}
+		if last {
+			return metadata, nil
+		}
+	}
+}
+
+// Parse a little endian Vorbis comment block of KEY=value pairs
+func parseVorbisComments(block []byte, metadata *Metadata) {
+	if len(block) < 8 {
+		return
+	}
+	vendorLength := int(binary.LittleEndian.Uint32(block))
+	offset := 4 + vendorLength
+	if offset+4 > len(block) {
+		return
+	}
+	count := int(binary.LittleEndian.Uint32(block[offset:]))
+	offset += 4
+	for i := 0; i < count && offset+4 <= len(block); i++ {
+		length := int(binary.LittleEndian.Uint32(block[offset:]))
+		offset += 4
+		if offset+length > len(block) {
+			return
+		}
+		comment := string(block[offset : offset+length])
+		offset += length
+		key, value, ok := strings.Cut(comment, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToUpper(key)
+		metadata.Fields["vorbis."+strings.ToLower(key)] = value
+		switch key {
+		case "TITLE":
+			metadata.Title = value
+		case "ARTIST":
+			metadata.Artist = value
+		case "GENRE":
+			metadata.Genre = value
+		case "COMMENT", "DESCRIPTION":
+			metadata.Description = value
+		case "KEY", "INITIALKEY":
+			metadata.Key = value
+		case "BPM", "TEMPO":
+			metadata.Tempo, _ = strconv.ParseFloat(value, 64)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ////////////////////// WRITING METADATA ////////////////////////
+
+// What excavator knows about an exported sample, written into the exported copy
+type ExportMetadata struct {
+	Name          string
+	Collection    string
+	SubCollection string
+	Notes         string
+	Category      string
+	Key           string
+	Tempo         float64
+}
+
+// A one line summary used where a format only has a free text description
+func (e ExportMetadata) Summary() string {
+	parts := make([]string, 0)
+	add := func(name string, value string) {
+		if value != "" {
+			parts = append(parts, fmt.Sprintf("%s: %s", name, value))
+		}
+	}
+	add("collection", e.Collection)
+	add("subcollection", e.SubCollection)
+	add("category", e.Category)
+	if e.Tempo > 0 {
+		add("bpm", e.tempoString())
+	}
+	add("key", e.Key)
+	add("notes", e.Notes)
+	return strings.Join(parts, "; ")
+}
+
+func (e ExportMetadata) tempoString() string {
+	if e.Tempo <= 0 {
+		return ""
+	}
+	return strconv.FormatFloat(e.Tempo, 'f', -1, 64)
+}
+
+// Write metadata into an audio file in place. Only ever call this on exported copies.
+func WriteMetadata(path string, metadata ExportMetadata) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var updated []byte
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".wav":
+		updated, err = writeRiffMetadata(data, metadata)
+	case ".flac":
+		updated, err = writeFlacMetadata(data, metadata)
+	case ".mp3":
+		updated, err = writeId3Metadata(data, metadata)
+	default:
+		err = errors.New(fmt.Sprintf("Unsupported audio file type: %v", filepath.Ext(path)))
+	}
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, updated, info.Mode())
+}
+
+//// RIFF ////
+
+// Append a chunk, padding odd sizes as RIFF requires
+func appendChunk(buf *bytes.Buffer, id string, body []byte) {
+	buf.WriteString(id)
+	binary.Write(buf, binary.LittleEndian, uint32(len(body)))
+	buf.Write(body)
+	if len(body)%2 == 1 {
+		buf.WriteByte(0)
+	}
+}
+
+// A fixed width, null padded string field
+func fixedString(s string, width int) []byte {
+	b := make([]byte, width)
+	copy(b, s)
+	return b
+}
+
+// A bext chunk carrying the summary as its description
+func bextChunk(metadata ExportMetadata) []byte {
+	body := make([]byte, 0, 602)
+	body = append(body, fixedString(metadata.Summary(), 256)...)
+	body = append(body, fixedString("excavator", 32)...)
+	body = append(body, fixedString(metadata.Collection, 32)...)
+	// date, time, time reference, version, umid, loudness fields and reserved space all left empty
+	body = append(body, make([]byte, 602-len(body))...)
+	return body
+}
+
+// A LIST/INFO chunk with the collection details
+func infoChunk(metadata ExportMetadata) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("INFO")
+	add := func(id string, value string) {
+		if value == "" {
+			return
+		}
+		appendChunk(&buf, id, append([]byte(value), 0))
+	}
+	add("INAM", metadata.Name)
+	add("IPRD", metadata.Collection)
+	add("ISBJ", metadata.SubCollection)
+	add("IGNR", metadata.Category)
+	add("ICMT", metadata.Summary())
+	add("ISFT", "excavator")
+	return buf.Bytes()
+}
+
+// Rebuild a wav file with fresh bext and INFO chunks, keeping every other chunk as it was
+func writeRiffMetadata(data []byte, metadata ExportMetadata) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, errors.New("not a RIFF WAVE file")
+	}
+	var chunks bytes.Buffer
+	wroteBext := false
+	for offset := 12; offset+8 <= len(data); {
+		id := string(data[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		start := offset + 8
+		end := min(start+size, len(data))
+		body := data[start:end]
+		offset = end + size%2
+		switch {
+		case id == "bext":
+			continue
+		case id == "LIST" && len(body) >= 4 && string(body[:4]) == "INFO":
+			continue
+		case id == "data" && !wroteBext:
+			appendChunk(&chunks, "bext", bextChunk(metadata))
+			wroteBext = true
+		}
+		appendChunk(&chunks, id, body)
+	}
+	if !wroteBext {
+		appendChunk(&chunks, "bext", bextChunk(metadata))
+	}
+	appendChunk(&chunks, "LIST", infoChunk(metadata))
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(4+chunks.Len()))
+	out.WriteString("WAVE")
+	out.Write(chunks.Bytes())
+	return out.Bytes(), nil
+}
+
+//// FLAC ////
+
+// Vorbis comments describing the export
+func vorbisComments(metadata ExportMetadata) [][2]string {
+	comments := [][2]string{
+		{"TITLE", metadata.Name},
+		{"ALBUM", metadata.Collection},
+		{"GROUPING", metadata.SubCollection},
+		{"GENRE", metadata.Category},
+		{"BPM", metadata.tempoString()},
+		{"KEY", metadata.Key},
+		{"COMMENT", metadata.Notes},
+		{"DESCRIPTION", metadata.Summary()},
+	}
+	filled := make([][2]string, 0, len(comments))
+	for _, comment := range comments {
+		if comment[1] != "" {
+			filled = append(filled, comment)
+		}
+	}
+	return filled
+}
+
+// Encode a Vorbis comment block, keeping existing comments that we aren't replacing
+func vorbisCommentBlock(existing []byte, metadata ExportMetadata) []byte {
+	comments := vorbisComments(metadata)
+	replaced := make(map[string]bool)
+	for _, comment := range comments {
+		replaced[comment[0]] = true
+	}
+	vendor := "excavator"
+	kept := make([]string, 0)
+	if len(existing) >= 8 {
+		vendorLength := int(binary.LittleEndian.Uint32(existing))
+		if 4+vendorLength+4 <= len(existing) {
+			vendor = string(existing[4 : 4+vendorLength])
+			offset := 4 + vendorLength
+			count := int(binary.LittleEndian.Uint32(existing[offset:]))
+			offset += 4
+			for i := 0; i < count && offset+4 <= len(existing); i++ {
+				length := int(binary.LittleEndian.Uint32(existing[offset:]))
+				offset += 4
+				if offset+length > len(existing) {
+					break
+				}
+				comment := string(existing[offset : offset+length])
+				offset += length
+				key, _, _ := strings.Cut(comment, "=")
+				if !replaced[strings.ToUpper(key)] {
+					kept = append(kept, comment)
+				}
+			}
+		}
+	}
+	for _, comment := range comments {
+		kept = append(kept, comment[0]+"="+comment[1])
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(len(vendor)))
+	buf.WriteString(vendor)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(kept)))
+	for _, comment := range kept {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(comment)))
+		buf.WriteString(comment)
+	}
+	return buf.Bytes()
+}
+
+// Rebuild a flac file's metadata blocks with an updated Vorbis comment block
+func writeFlacMetadata(data []byte, metadata ExportMetadata) ([]byte, error) {
+	if len(data) < 4 || string(data[:4]) != "fLaC" {
+		return nil, errors.New("not a flac file")
+	}
+	type block struct {
+		blockType byte
+		body      []byte
+	}
+	blocks := make([]block, 0)
+	offset := 4
+	var existingComments []byte
+	for {
+		if offset+4 > len(data) {
+			return nil, errors.New("truncated flac metadata")
+		}
+		header := data[offset : offset+4]
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		size := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		if offset+4+size > len(data) {
+			return nil, errors.New("truncated flac metadata")
+		}
+		body := data[offset+4 : offset+4+size]
+		offset += 4 + size
+		if blockType == 4 {
+			existingComments = body
+		} else if blockType != 1 {
+			// padding blocks are dropped, their space isn't needed once the file is rewritten
+			blocks = append(blocks, block{blockType, body})
+		}
+		if last {
+			break
+		}
+	}
+	if len(blocks) == 0 || blocks[0].blockType != 0 {
+		return nil, errors.New("flac file doesn't start with STREAMINFO")
+	}
+	comments := vorbisCommentBlock(existingComments, metadata)
+	if len(comments) >= 1<<24 {
+		return nil, errors.New("vorbis comments too large for a flac metadata block")
+	}
+	// the comment block goes straight after STREAMINFO, which must stay first
+	blocks = append(blocks[:1], append([]block{{4, comments}}, blocks[1:]...)...)
+	var out bytes.Buffer
+	out.WriteString("fLaC")
+	for i, b := range blocks {
+		header := b.blockType
+		if i == len(blocks)-1 {
+			header |= 0x80
+		}
+		size := len(b.body)
+		out.Write([]byte{header, byte(size >> 16), byte(size >> 8), byte(size)})
+		out.Write(b.body)
+	}
+	out.Write(data[offset:])
+	return out.Bytes(), nil
+}
+
+//// ID3 ////
+
+// Encode a syncsafe integer
+func syncsafeBytes(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+}
+
+// An ID3v2.3 frame with a UTF-16 body
+func id3Frame(id string, body []byte) []byte {
+	frame := make([]byte, 0, 10+len(body))
+	frame = append(frame, id...)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(body)))
+	frame = append(frame, 0, 0)
+	return append(frame, body...)
+}
+
+// UTF-16 text with a byte order mark, as ID3v2.3 expects for non latin text
+func utf16Text(s string) []byte {
+	buf := []byte{0xFF, 0xFE}
+	for _, r := range s {
+		if r > 0xFFFF {
+			r = '?'
+		}
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(r))
+	}
+	return buf
+}
+
+// Rewrite an mp3's ID3v2 tag as v2.3, keeping frames from an existing v2.3 tag that we aren't replacing
+func writeId3Metadata(data []byte, metadata ExportMetadata) ([]byte, error) {
+	audio := data
+	kept := make([]byte, 0)
+	frames := map[string]string{
+		"TIT2": metadata.Name,
+		"TALB": metadata.Collection,
+		"TIT1": metadata.SubCollection,
+		"TCON": metadata.Category,
+		"TBPM": metadata.tempoString(),
+		"TKEY": metadata.Key,
+	}
+	if len(data) >= 10 && string(data[:3]) == "ID3" {
+		size := syncsafe(data[6:10])
+		end := 10 + size
+		if data[5]&0x10 != 0 {
+			end += 10
+		}
+		if end > len(data) {
+			return nil, errors.New("truncated ID3 tag")
+		}
+		if data[3] == 3 {
+			body := data[10 : 10+size]
+			for offset := 0; offset+10 <= len(body); {
+				id := string(body[offset : offset+4])
+				if id[0] == 0 {
+					break
+				}
+				frameSize := int(binary.BigEndian.Uint32(body[offset+4:]))
+				frameEnd := offset + 10 + frameSize
+				if frameEnd > len(body) {
+					break
+				}
+				if _, replacing := frames[id]; !replacing && id != "COMM" {
+					kept = append(kept, body[offset:frameEnd]...)
+				}
+				offset = frameEnd
+			}
+		}
+		audio = data[end:]
+	}
+	var tag bytes.Buffer
+	tag.Write(kept)
+	for _, id := range []string{"TIT2", "TALB", "TIT1", "TCON", "TBPM", "TKEY"} {
+		if frames[id] == "" {
+			continue
+		}
+		tag.Write(id3Frame(id, append([]byte{1}, utf16Text(frames[id])...)))
+	}
+	comment := append([]byte{1}, "eng"...)
+	comment = append(comment, utf16Text("")...)
+	comment = append(comment, 0, 0)
+	comment = append(comment, utf16Text(metadata.Summary())...)
+	tag.Write(id3Frame("COMM", comment))
+	var out bytes.Buffer
+	out.WriteString("ID3")
+	out.Write([]byte{3, 0, 0})
+	out.Write(syncsafeBytes(tag.Len()))
+	out.Write(tag.Bytes())
+	out.Write(audio)
+	return out.Bytes(), nil
+}
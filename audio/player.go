@@ -3,14 +3,10 @@ package audio
 import (
 	"log"
 	"os"
-	"path/filepath"
 	"time"
 	// Audio
 	"github.com/gopxl/beep"
-	"github.com/gopxl/beep/flac"
-	"github.com/gopxl/beep/mp3"
 	"github.com/gopxl/beep/speaker"
-	"github.com/gopxl/beep/wav"
 )
 
 // ////////////////////// AUDIO HANDLING ////////////////////////
@@ -51,6 +47,7 @@ type Player struct {
 	Commands    chan string
 	Playing     bool
 	NextCommand *string
+	layer       []beep.StreamSeekCloser // files playing together from PlayLayer
 }
 
 // Push a play command to the audio player's commands channel
@@ -87,17 +84,7 @@ func (a *Player) Close() {
 
 // Get a streamer which will buffer playback of one file
 func (a *Player) GetStreamer(path string, f *os.File) (beep.StreamSeekCloser, beep.Format, error) {
-	var streamer beep.StreamSeekCloser
-	var format beep.Format
-	var err error
-	switch filepath.Ext(path) {
-	case ".mp3":
-		streamer, format, err = mp3.Decode(f)
-	case ".wav":
-		streamer, format, err = wav.Decode(f)
-	case ".flac":
-		streamer, format, err = flac.Decode(f)
-	}
+	streamer, format, err := GetStreamer(path, f)
 	if err != nil {
 		log.Print(err)
 		return nil, format, err
@@ -156,9 +143,58 @@ func (a *Player) Run() {
 
 // Play one audio file. If another file is already playing, close the current streamer and play the new file.
 func (a *Player) PlayAudioFile(path string) {
+	a.stopLayer()
 	if a.Playing {
 		// Close current streamer with any necessary cleanup
 		a.CloseStreamer()
 	}
 	a.pushPlayCommand(path)
 }
+
+// Stop any files playing together from PlayLayer
+func (a *Player) stopLayer() {
+	speaker.Lock()
+	for _, streamer := range a.layer {
+		streamer.Close()
+	}
+	a.layer = nil
+	speaker.Unlock()
+}
+
+// Play several audio files at once, layered on top of each other, stopping anything already playing
+func (a *Player) PlayLayer(paths []string) {
+	a.stopLayer()
+	if a.Playing {
+		a.CloseStreamer()
+	}
+	files := make([]*os.File, 0, len(paths))
+	layer := make([]beep.StreamSeekCloser, 0, len(paths))
+	resampled := make([]beep.Streamer, 0, len(paths))
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Printf("Failed to open %s for layering: %v", path, err)
+			continue
+		}
+		streamer, format, err := a.GetStreamer(path, f)
+		if err != nil {
+			f.Close()
+			continue
+		}
+		files = append(files, f)
+		layer = append(layer, streamer)
+		resampled = append(resampled, beep.Resample(4, format.SampleRate, a.Format.SampleRate, streamer))
+	}
+	if len(layer) == 0 {
+		return
+	}
+	log.Printf("Playing %d files layered", len(layer))
+	speaker.Lock()
+	a.layer = layer
+	speaker.Unlock()
+	speaker.Play(beep.Seq(beep.Mix(resampled...), beep.Callback(func() {
+		for _, f := range files {
+			f.Close()
+		}
+	})))
+}
@@ -0,0 +1,101 @@
+package audio
+
+import (
+	"errors"
+	"math"
+)
+
+// Resolution used when analysing files for the spectrogram view
+const (
+	SpectrogramFrames = 128
+	SpectrogramBands  = 24
+	spectrogramFFT    = 2048
+	spectrogramRange  = 70.0 // dB below the loudest cell that still gets a colour
+	spectrogramMinHz  = 30.0
+)
+
+// A coarse time/frequency picture of a file, quantised so it can be cached cheaply.
+// Levels are stored frame by frame, lowest band first, with 0 being silence and 255 the loudest cell.
+type Spectrogram struct {
+	Frames int
+	Bands  int
+	Levels []uint8
+}
+
+// Level at a given frame and band
+func (s Spectrogram) Level(frame int, band int) uint8 {
+	if frame < 0 || frame >= s.Frames || band < 0 || band >= s.Bands {
+		return 0
+	}
+	return s.Levels[frame*s.Bands+band]
+}
+
+// Reconstruct a spectrogram from its cached levels
+func SpectrogramFromLevels(frames int, bands int, levels []uint8) (Spectrogram, error) {
+	if frames*bands != len(levels) {
+		return Spectrogram{}, errors.New("spectrogram levels don't match its dimensions")
+	}
+	return Spectrogram{Frames: frames, Bands: bands, Levels: levels}, nil
+}
+
+// Upper frequency edges of log spaced bands between the minimum frequency and nyquist
+func bandEdges(bands int, nyquist float64) []float64 {
+	edges := make([]float64, bands)
+	ratio := math.Pow(nyquist/spectrogramMinHz, 1/float64(bands))
+	edge := spectrogramMinHz
+	for i := range edges {
+		edge *= ratio
+		edges[i] = edge
+	}
+	return edges
+}
+
+// Analyse an audio file into a spectrogram
+func NewSpectrogram(path string) (Spectrogram, error) {
+	buffer, err := DecodeFile(path)
+	if err != nil {
+		return Spectrogram{}, err
+	}
+	return NewSpectrogramFromBuffer(buffer, SpectrogramFrames, SpectrogramBands), nil
+}
+
+// Analyse decoded audio into a spectrogram with the given resolution
+func NewSpectrogramFromBuffer(buffer Buffer, frames int, bands int) Spectrogram {
+	mono := buffer.Mono()
+	window := HannWindow(spectrogramFFT)
+	nyquist := float64(buffer.Format.SampleRate) / 2
+	edges := bandEdges(bands, nyquist)
+	binHz := nyquist / float64(spectrogramFFT/2)
+	hop := float64(len(mono)) / float64(frames)
+	decibels := make([]float64, frames*bands)
+	loudest := math.Inf(-1)
+	for frame := 0; frame < frames; frame++ {
+		offset := int(float64(frame)*hop) - spectrogramFFT/2 + int(hop/2)
+		magnitudes := MagnitudeSpectrum(mono, offset, window)
+		energies := make([]float64, bands)
+		band := 0
+		for bin, magnitude := range magnitudes {
+			freq := float64(bin) * binHz
+			if freq < spectrogramMinHz {
+				continue
+			}
+			for band < bands-1 && freq > edges[band] {
+				band++
+			}
+			energies[band] += magnitude * magnitude
+		}
+		for band, energy := range energies {
+			db := 10 * math.Log10(energy+1e-12)
+			decibels[frame*bands+band] = db
+			if db > loudest {
+				loudest = db
+			}
+		}
+	}
+	levels := make([]uint8, len(decibels))
+	for i, db := range decibels {
+		level := (db - (loudest - spectrogramRange)) / spectrogramRange
+		levels[i] = uint8(math.Round(math.Max(0, math.Min(1, level)) * 255))
+	}
+	return Spectrogram{Frames: frames, Bands: bands, Levels: levels}
+}
@@ -0,0 +1,330 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gopxl/beep"
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+)
+
+// ////////////////////// TRANSCODING ////////////////////////
+
+// File formats a transcoding export can write
+const (
+	FormatWav  = "wav"
+	FormatFlac = "flac"
+)
+
+// Samples per flac frame
+const flacBlockSize = 4096
+
+// How a transcoded file should be written. Zero values keep the source's own sample rate and bit depth.
+type TranscodeOptions struct {
+	Format     string
+	SampleRate int
+	BitDepth   int
+	Mono       bool
+}
+
+// Check the options describe something we can write
+func (o TranscodeOptions) Validate() error {
+	if o.Format != FormatWav && o.Format != FormatFlac {
+		return errors.New(fmt.Sprintf("Unsupported export format: %v", o.Format))
+	}
+	if o.BitDepth != 0 && o.BitDepth != 16 && o.BitDepth != 24 {
+		return errors.New(fmt.Sprintf("Unsupported bit depth: %d", o.BitDepth))
+	}
+	if o.SampleRate < 0 || o.SampleRate > 192000 {
+		return errors.New(fmt.Sprintf("Unsupported sample rate: %d", o.SampleRate))
+	}
+	return nil
+}
+
+// A short description, e.g. "16bit 44100hz mono wav"
+func (o TranscodeOptions) String() string {
+	parts := make([]string, 0, 4)
+	if o.BitDepth > 0 {
+		parts = append(parts, fmt.Sprintf("%dbit", o.BitDepth))
+	}
+	if o.SampleRate > 0 {
+		parts = append(parts, fmt.Sprintf("%dhz", o.SampleRate))
+	}
+	if o.Mono {
+		parts = append(parts, "mono")
+	}
+	return strings.Join(append(parts, o.Format), " ")
+}
+
+// A file name with its extension swapped for the output format's
+func (o TranscodeOptions) FileName(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + "." + o.Format
+}
+
+// Decode a file and write it to destination in the requested format
+func Transcode(source string, destination string, options TranscodeOptions) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	buffer, resampled, err := decodeForExport(source, options.SampleRate)
+	if err != nil {
+		return err
+	}
+	sourceBits := buffer.Format.Precision * 8
+	bitDepth := options.BitDepth
+	if bitDepth == 0 {
+		bitDepth = 16
+		if sourceBits > 16 {
+			bitDepth = 24
+		}
+	}
+	channels, summed := buffer.exportChannels(options.Mono)
+	// anything that leaves us with more resolution than the target gets dithered on the way down
+	dither := resampled || summed || bitDepth < sourceBits
+	return writePcmFile(destination, options.Format, quantiseChannels(channels, bitDepth, dither), int(buffer.Format.SampleRate), bitDepth)
+}
+
+// Decode a file, resampling it when a sample rate is given. Reports whether it was resampled.
+func decodeForExport(source string, sampleRate int) (Buffer, bool, error) {
+	buffer, err := DecodeFile(source)
+	if err != nil {
+		return buffer, false, err
+	}
+	if sampleRate > 0 && sampleRate != int(buffer.Format.SampleRate) {
+		return buffer.Resample(sampleRate), true, nil
+	}
+	return buffer, false, nil
+}
+
+// The buffer split into the channels to be written, summed to one when asked or when the source is mono.
+// Reports whether stereo was summed.
+func (b Buffer) exportChannels(mono bool) ([][]float64, bool) {
+	if mono || b.Format.NumChannels == 1 {
+		return [][]float64{b.Mono()}, b.Format.NumChannels != 1
+	}
+	left := make([]float64, len(b.Samples))
+	right := make([]float64, len(b.Samples))
+	for i, sample := range b.Samples {
+		left[i], right[i] = sample[0], sample[1]
+	}
+	return [][]float64{left, right}, false
+}
+
+// Quantise every channel to the same bit depth
+func quantiseChannels(channels [][]float64, bitDepth int, dither bool) [][]int32 {
+	quantised := make([][]int32, len(channels))
+	for i, channel := range channels {
+		quantised[i] = Quantise(channel, bitDepth, dither)
+	}
+	return quantised
+}
+
+// Create a new file holding pcm in the given format, removing it again if writing fails. Extra riff chunks are only
+// written to wavs.
+func writePcmFile(destination string, format string, channels [][]int32, sampleRate int, bitDepth int, chunks ...[]byte) error {
+	out, err := os.OpenFile(destination, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case FormatFlac:
+		err = writeFlac(out, channels, sampleRate, bitDepth)
+	default:
+		err = writeWav(out, channels, sampleRate, bitDepth, chunks...)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(destination)
+	}
+	return err
+}
+
+// Streams a buffer's samples, so beep's resampler can read them
+type bufferStreamer struct {
+	samples  [][2]float64
+	position int
+}
+
+func (b *bufferStreamer) Stream(samples [][2]float64) (int, bool) {
+	if b.position >= len(b.samples) {
+		return 0, false
+	}
+	n := copy(samples, b.samples[b.position:])
+	b.position += n
+	return n, true
+}
+
+func (b *bufferStreamer) Err() error {
+	return nil
+}
+
+// The buffer converted to another sample rate
+func (b Buffer) Resample(sampleRate int) Buffer {
+	format := b.Format
+	format.SampleRate = beep.SampleRate(sampleRate)
+	resampler := beep.Resample(4, b.Format.SampleRate, format.SampleRate, &bufferStreamer{samples: b.Samples})
+	expected := int(math.Ceil(float64(len(b.Samples)) * float64(sampleRate) / float64(b.Format.SampleRate)))
+	samples := make([][2]float64, 0, expected)
+	chunk := make([][2]float64, 4096)
+	for {
+		n, ok := resampler.Stream(chunk)
+		samples = append(samples, chunk[:n]...)
+		if !ok {
+			break
+		}
+	}
+	return Buffer{Format: format, Samples: samples}
+}
+
+// Convert floating point samples to integers of the given bit depth, optionally with triangular dither
+// so the rounding error becomes noise rather than distortion.
+func Quantise(samples []float64, bitDepth int, dither bool) []int32 {
+	scale := float64(int64(1) << (bitDepth - 1))
+	highest, lowest := scale-1, -scale
+	quantised := make([]int32, len(samples))
+	for i, sample := range samples {
+		value := sample * scale
+		if dither {
+			value += rand.Float64() - rand.Float64()
+		}
+		quantised[i] = int32(math.Max(lowest, math.Min(highest, math.Round(value))))
+	}
+	return quantised
+}
+
+// Write interleaved pcm to a wav file, followed by any extra chunks
+func writeWav(w io.Writer, channels [][]int32, sampleRate int, bitDepth int, chunks ...[]byte) error {
+	bytesPerSample := bitDepth / 8
+	frames := 0
+	if len(channels) > 0 {
+		frames = len(channels[0])
+	}
+	dataSize := frames * len(channels) * bytesPerSample
+	extra := 0
+	for _, chunk := range chunks {
+		extra += len(chunk)
+	}
+	header := make([]byte, 44)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(36+dataSize+dataSize%2+extra))
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1)
+	binary.LittleEndian.PutUint16(header[22:], uint16(len(channels)))
+	binary.LittleEndian.PutUint32(header[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(sampleRate*len(channels)*bytesPerSample))
+	binary.LittleEndian.PutUint16(header[32:], uint16(len(channels)*bytesPerSample))
+	binary.LittleEndian.PutUint16(header[34:], uint16(bitDepth))
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(dataSize))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	data := make([]byte, dataSize+dataSize%2)
+	offset := 0
+	for i := 0; i < frames; i++ {
+		for _, channel := range channels {
+			sample := uint32(channel[i])
+			for b := 0; b < bytesPerSample; b++ {
+				data[offset] = byte(sample >> (8 * b))
+				offset++
+			}
+		}
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write pcm to a flac file using fixed second order prediction
+func writeFlac(w io.Writer, channels [][]int32, sampleRate int, bitDepth int) error {
+	info := &meta.StreamInfo{
+		BlockSizeMin:  16,
+		BlockSizeMax:  flacBlockSize,
+		SampleRate:    uint32(sampleRate),
+		NChannels:     uint8(len(channels)),
+		BitsPerSample: uint8(bitDepth),
+	}
+	encoder, err := flac.NewEncoder(w, info)
+	if err != nil {
+		return err
+	}
+	layout := frame.ChannelsLR
+	if len(channels) == 1 {
+		layout = frame.ChannelsMono
+	}
+	total := len(channels[0])
+	for start := 0; start < total; start += flacBlockSize {
+		end := min(start+flacBlockSize, total)
+		subframes := make([]*frame.Subframe, len(channels))
+		for i, channel := range channels {
+			subframes[i] = flacSubframe(channel[start:end])
+		}
+		f := &frame.Frame{
+			Header: frame.Header{
+				HasFixedBlockSize: true,
+				BlockSize:         uint16(end - start),
+				SampleRate:        uint32(sampleRate),
+				Channels:          layout,
+				BitsPerSample:     uint8(bitDepth),
+			},
+			Subframes: subframes,
+		}
+		if err := encoder.WriteFrame(f); err != nil {
+			return err
+		}
+	}
+	return encoder.Close()
+}
+
+// A subframe predicting each sample from the two before it, with a rice parameter fitted to the residuals
+func flacSubframe(samples []int32) *frame.Subframe {
+	const order = 2
+	if len(samples) <= order {
+		return &frame.Subframe{
+			SubHeader: frame.SubHeader{Pred: frame.PredVerbatim},
+			Samples:   samples,
+			NSamples:  len(samples),
+		}
+	}
+	sum := 0.0
+	for i := order; i < len(samples); i++ {
+		residual := int64(samples[i]) - 2*int64(samples[i-1]) + int64(samples[i-2])
+		sum += math.Abs(float64(residual))
+	}
+	mean := sum / float64(len(samples)-order)
+	param := uint(0)
+	if mean > 1 {
+		param = uint(math.Min(math.Floor(math.Log2(mean)), 30))
+	}
+	return &frame.Subframe{
+		SubHeader: frame.SubHeader{
+			Pred:                 frame.PredFixed,
+			Order:                order,
+			ResidualCodingMethod: frame.ResidualCodingMethodRice2,
+			RiceSubframe: &frame.RiceSubframe{
+				PartOrder:  0,
+				Partitions: []frame.RicePartition{{Param: param}},
+			},
+		},
+		Samples:  samples,
+		NSamples: len(samples),
+	}
+}
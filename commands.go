@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jesses-code-adventures/excavator/core"
+	"github.com/jesses-code-adventures/excavator/server"
+)
+
+// ////////////////////// COMMANDS ////////////////////////
+
+// A subcommand run from the shell instead of the tui
+type Command struct {
+	Usage string
+	Run   func(app App, args []string) error
+}
+
+const resolveUsage = "resolve [-yes] [-repair] [-report path] <session file>"
+const combineUsage = "combine [-conflicts first|all|root|collection] -name <new collection> <union|intersection|difference> <collection> <collection>..."
+
+// Every subcommand, keyed by name
+var Commands = map[string]Command{
+	"resolve": {
+		Usage: resolveUsage,
+		Run:   resolveCommand,
+	},
+	"combine": {
+		Usage: combineUsage,
+		Run:   combineCommand,
+	},
+}
+
+// Run the subcommand named by the first argument
+func RunCommand(app App, args []string) error {
+	command, ok := Commands[args[0]]
+	if !ok {
+		names := make([]string, 0, len(Commands))
+		for name := range Commands {
+			names = append(names, name)
+		}
+		return errors.New(fmt.Sprintf("unknown command %s, expected one of: %s", args[0], strings.Join(names, ", ")))
+	}
+	if app.needsUserAndRoot {
+		return errors.New("no user or root set, launch excavator once to set them up")
+	}
+	return command.Run(app, args[1:])
+}
+
+// Ask which candidate should replace a missing sample, returning an empty string to leave it unresolved
+func chooseCandidate(in *bufio.Reader, sample server.MissingSample) string {
+	fmt.Printf("\nmissing: %s", sample.Ref.Path)
+	if sample.Ref.Track != "" {
+		fmt.Printf(" (%s)", sample.Ref.Track)
+	}
+	fmt.Println()
+	for i, candidate := range sample.Candidates {
+		fmt.Printf("  %d) %s [%s]\n", i+1, candidate.Path, strings.Join(candidate.Reasons, ", "))
+	}
+	for {
+		fmt.Printf("choose 1-%d, enter for 1, s to skip: ", len(sample.Candidates))
+		answer, err := in.ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		switch {
+		case answer == "" && err == nil:
+			return sample.Candidates[0].Path
+		case answer == "s" || err != nil:
+			return ""
+		}
+		if choice, err := strconv.Atoi(answer); err == nil && choice >= 1 && choice <= len(sample.Candidates) {
+			return sample.Candidates[choice-1].Path
+		}
+	}
+}
+
+// Find the samples a session has lost, pick replacements from the root and write a report and optionally a
+// repaired copy of the session beside the original
+func resolveCommand(app App, args []string) error {
+	flags := flag.NewFlagSet("resolve", flag.ContinueOnError)
+	yes := flags.Bool("yes", false, "Take the best candidate for every missing sample without asking")
+	repair := flags.Bool("repair", false, "Write a copy of the session pointing at the chosen files")
+	report := flags.String("report", "", "Where to write the report, defaults to beside the session")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: excavator " + resolveUsage)
+	}
+	sessionPath, err := filepath.Abs(core.ExpandPath(flags.Arg(0)))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("searching %s for missing samples...\n", app.server.State.Root)
+	parsed, missing, err := app.server.FindMissingSamples(sessionPath)
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		fmt.Printf("all %d samples in %s were found\n", len(parsed.Samples), filepath.Base(sessionPath))
+		return nil
+	}
+	in := bufio.NewReader(os.Stdin)
+	resolved := 0
+	for i, sample := range missing {
+		switch {
+		case len(sample.Candidates) == 0:
+			fmt.Printf("\nmissing: %s, no candidates found\n", sample.Ref.Path)
+		case *yes:
+			missing[i].Choice = sample.Candidates[0].Path
+		default:
+			missing[i].Choice = chooseCandidate(in, sample)
+		}
+		if missing[i].Choice != "" {
+			resolved++
+		}
+	}
+	base := strings.TrimSuffix(sessionPath, filepath.Ext(sessionPath))
+	if *report == "" {
+		*report = base + " missing samples.txt"
+	}
+	if err := server.WriteResolveReport(core.ExpandPath(*report), parsed, missing); err != nil {
+		return err
+	}
+	fmt.Printf("\n%d of %d missing samples resolved, report written to %s\n", resolved, len(missing), *report)
+	if *repair && resolved > 0 {
+		destination := base + " (resolved)" + filepath.Ext(sessionPath)
+		repaired, err := server.RepairSession(parsed, destination, missing)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d references repaired in %s\n", repaired, destination)
+	}
+	return nil
+}
+
+// Make a new collection from the union, intersection or difference of two or more others
+func combineCommand(app App, args []string) error {
+	flags := flag.NewFlagSet("combine", flag.ContinueOnError)
+	name := flags.String("name", "", "Name of the collection to create")
+	conflicts := flags.String("conflicts", string(server.ConflictFirst), "Where files listed in different subcollections go: first, all, root or collection")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 3 || *name == "" {
+		return errors.New("usage: excavator " + combineUsage)
+	}
+	operation, err := server.ParseSetOperation(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	conflict, err := server.ParseSubCollectionConflict(*conflicts)
+	if err != nil {
+		return err
+	}
+	ids := make([]int, 0, flags.NArg()-1)
+	for _, collectionName := range flags.Args()[1:] {
+		collection, err := app.server.FindCollection(collectionName)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, collection.Id())
+	}
+	result, err := app.server.CombineCollections(operation, ids, *name, conflict)
+	if err != nil {
+		return err
+	}
+	fmt.Println(result.String())
+	return nil
+}
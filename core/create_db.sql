@@ -5,6 +5,7 @@ CREATE TABLE IF NOT EXISTS User (
     root TEXT default(''),
     selected_collection INTEGER,
     selected_subcollection TEXT default(''),
+    projects_dir TEXT default(''),
     FOREIGN KEY (selected_collection) REFERENCES Collection(id)
 );
 
@@ -40,6 +41,14 @@ CREATE TABLE IF NOT EXISTS Export (
     name TEXT NOT NULL,
     output_dir TEXT NOT NULL,
     concrete number(1) default(0),
+    write_metadata number(1) default(0),
+    format TEXT default(''),
+    sample_rate INTEGER default(0),
+    bit_depth INTEGER default(0),
+    mono number(1) default(0),
+    profile TEXT default(''),
+    kind TEXT default(''),
+    sidecar number(1) default(0),
     FOREIGN KEY (user_id) REFERENCES User(id)
 );
 
@@ -50,3 +59,117 @@ CREATE TABLE IF NOT EXISTS ExportTag (
     FOREIGN KEY (collection_tag_id) REFERENCES CollectionTag(id),
     FOREIGN KEY (export_id) REFERENCES Export(id)
 );
+
+CREATE TABLE IF NOT EXISTS Spectrogram (
+    id INTEGER PRIMARY KEY,
+    file_path TEXT UNIQUE NOT NULL,
+    mod_time INTEGER NOT NULL,
+    frames INTEGER NOT NULL,
+    bands INTEGER NOT NULL,
+    levels BLOB NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS Fingerprint (
+    id INTEGER PRIMARY KEY,
+    file_path TEXT UNIQUE NOT NULL,
+    mod_time INTEGER NOT NULL,
+    hash TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS fingerprint_hash ON Fingerprint (hash);
+
+CREATE TABLE IF NOT EXISTS ResolvedDuplicate (
+    id INTEGER PRIMARY KEY,
+    file_path TEXT UNIQUE NOT NULL,
+    hash TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS Features (
+    id INTEGER PRIMARY KEY,
+    file_path TEXT UNIQUE NOT NULL,
+    mod_time INTEGER NOT NULL,
+    centroid REAL NOT NULL,
+    rolloff REAL NOT NULL,
+    duration REAL NOT NULL,
+    attack REAL NOT NULL,
+    envelope BLOB NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS Category (
+    id INTEGER PRIMARY KEY,
+    file_path TEXT UNIQUE NOT NULL,
+    mod_time INTEGER NOT NULL,
+    category TEXT NOT NULL,
+    confidence REAL NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS category_category ON Category (category);
+
+CREATE TABLE IF NOT EXISTS Metadata (
+    id INTEGER PRIMARY KEY,
+    file_path TEXT UNIQUE NOT NULL,
+    mod_time INTEGER NOT NULL,
+    title TEXT default(''),
+    artist TEXT default(''),
+    description TEXT default(''),
+    genre TEXT default(''),
+    key TEXT default(''),
+    tempo REAL default(0),
+    root_note INTEGER default(-1),
+    loop_start INTEGER default(-1),
+    loop_end INTEGER default(-1),
+    fields TEXT default('{}'),
+    search_text TEXT default('')
+);
+
+CREATE TABLE IF NOT EXISTS Project (
+    id INTEGER PRIMARY KEY,
+    file_path TEXT UNIQUE NOT NULL,
+    mod_time INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS ProjectSample (
+    id INTEGER PRIMARY KEY,
+    project_id INTEGER NOT NULL,
+    file_path TEXT NOT NULL,
+    FOREIGN KEY (project_id) REFERENCES Project(id),
+    UNIQUE (project_id, file_path)
+);
+
+CREATE INDEX IF NOT EXISTS project_sample_file_path ON ProjectSample (file_path);
+
+CREATE TABLE IF NOT EXISTS Journal (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    created INTEGER NOT NULL,
+    description TEXT NOT NULL,
+    changes TEXT NOT NULL,
+    undone number(1) default(0),
+    FOREIGN KEY (user_id) REFERENCES User(id)
+);
+
+CREATE TABLE IF NOT EXISTS Recipe (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES User(id),
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS RecipeRule (
+    id INTEGER PRIMARY KEY,
+    recipe_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    count INTEGER NOT NULL,
+    source TEXT NOT NULL,
+    value TEXT NOT NULL,
+    sub_collection TEXT NOT NULL,
+    FOREIGN KEY (recipe_id) REFERENCES Recipe(id)
+);
+
+CREATE TABLE IF NOT EXISTS Kit (
+    collection_id INTEGER PRIMARY KEY,
+    recipe_id INTEGER NOT NULL,
+    FOREIGN KEY (collection_id) REFERENCES Collection(id),
+    FOREIGN KEY (recipe_id) REFERENCES Recipe(id)
+);
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/textinput"
@@ -18,8 +19,9 @@ var createSqlCommands []byte
 
 // A singular form input control
 type FormInput struct {
-	Name  string
-	Input textinput.Model
+	Name     string
+	Input    textinput.Model
+	Optional bool // the form can be submitted with this left empty
 }
 
 // Constructor for a form input
@@ -98,6 +100,111 @@ func GetCreateTagForm(defaultName string, defaultSubCollection string) Form {
 	return NewForm("create tag", GetCreateCollectionTagInputs(defaultName, defaultSubCollection))
 }
 
+// Get the form for tagging a whole directory. Mirroring adds each file's subfolder to the end of the subcollection.
+func GetTagDirectoryForm(defaultSubCollection string) Form {
+	subCollection := NewFormInput("subcollection")
+	subCollection.Input.SetValue(defaultSubCollection)
+	subCollection.Optional = true
+	mirror := NewFormInput("mirror subfolders")
+	mirror.Input.SetValue("true")
+	return NewForm("tag directory", []FormInput{subCollection, mirror})
+}
+
+// Get the import session form, prefilled with a session file when one is selected
+func GetImportSessionForm(defaultPath string) Form {
+	sessionPath := NewFormInput("session path")
+	sessionPath.Input.SetValue(defaultPath)
+	return NewForm("import session", []FormInput{sessionPath})
+}
+
+// Get the rename form, prefilled with the current name
+func GetRenameForm(name string) Form {
+	input := NewFormInput("new name")
+	input.Input.SetValue(name)
+	return NewForm("rename", []FormInput{input})
+}
+
+// Get the move form, prefilled with the directory the file is in now
+func GetMoveForm(dir string) Form {
+	input := NewFormInput("move to directory")
+	input.Input.SetValue(dir)
+	return NewForm("move", []FormInput{input})
+}
+
+// Get the form for changing a collection tag's export name
+func GetRenameTagForm(name string) Form {
+	input := NewFormInput("export name")
+	input.Input.SetValue(name)
+	return NewForm("rename tag", []FormInput{input})
+}
+
+// Get the form for moving a collection tag to another subcollection. Leaving it empty moves the tag to the root.
+func GetMoveTagForm(subCollection string) Form {
+	input := NewFormInput("subcollection")
+	input.Input.SetValue(subCollection)
+	input.Optional = true
+	return NewForm("move tag", []FormInput{input})
+}
+
+// Get the form for renaming a collection
+func GetRenameCollectionForm(name string) Form {
+	input := NewFormInput("name")
+	input.Input.SetValue(name)
+	return NewForm("rename collection", []FormInput{input})
+}
+
+// Get the form for changing a collection's description
+func GetDescribeCollectionForm(description string) Form {
+	input := NewFormInput("description")
+	input.Input.SetValue(description)
+	input.Optional = true
+	return NewForm("describe collection", []FormInput{input})
+}
+
+// Get the form for duplicating a collection, prefilled with a name for the copy
+func GetDuplicateCollectionForm(name string) Form {
+	input := NewFormInput("name of the copy")
+	input.Input.SetValue(name + " copy")
+	return NewForm("duplicate collection", []FormInput{input})
+}
+
+// Get the form confirming a collection should be deleted, which asks for its name to be typed out
+func GetDeleteCollectionForm(name string) Form {
+	return NewForm("delete collection", []FormInput{NewFormInput(fmt.Sprintf("type %s to delete it", name))})
+}
+
+// Get the form for combining collections into a new one. Collections are listed by name, separated by commas.
+func GetCombineCollectionsForm(collections string) Form {
+	operation := NewFormInput("union, intersection or difference")
+	operation.Input.SetValue("union")
+	names := NewFormInput("collections")
+	names.Input.SetValue(collections)
+	conflicts := NewFormInput("subcollection conflicts: first, all, root or collection")
+	conflicts.Input.SetValue("first")
+	return NewForm("combine collections", []FormInput{operation, names, NewFormInput("new collection name"), conflicts})
+}
+
+// Get the form for writing a kit recipe. Rules are separated by semicolons, see ParseKitRules.
+func GetRecipeForm(name string, rules string) Form {
+	nameInput := NewFormInput("recipe name")
+	nameInput.Input.SetValue(name)
+	rulesInput := NewFormInput("rules, e.g. 1 dir:Drums/Kicks; 2 search:hat closed > /hats; 1 collection:Favourites")
+	rulesInput.Input.SetValue(rules)
+	rulesInput.Input.CharLimit = 0
+	return NewForm("kit recipe", []FormInput{nameInput, rulesInput})
+}
+
+// Get the batch rename form. Find and replace are an optional regular expression run over each new name.
+func GetBatchRenameForm() Form {
+	template := NewFormInput("template")
+	template.Input.SetValue("{name}")
+	find := NewFormInput("find (regex)")
+	find.Optional = true
+	replace := NewFormInput("replace")
+	replace.Optional = true
+	return NewForm("batch rename", []FormInput{template, find, replace})
+}
+
 /// List selection ///
 
 // Interface for list selection items so the list can easily be reused
@@ -184,6 +291,8 @@ type TaggedDirEntry struct {
 	FilePath string
 	Tags     []CollectionTag
 	Dir      bool
+	Category string
+	Projects int // how many scanned DAW projects use the file
 }
 
 func NewTaggedDirEntry(filePath string, tags []CollectionTag, dir bool) TaggedDirEntry {
@@ -245,6 +354,7 @@ type User struct {
 	TargetCollection    *CollectionMetadata
 	TargetSubCollection string
 	Root                string
+	ProjectsDir         string
 }
 
 // Struct holding the app's configuration
@@ -390,11 +500,30 @@ func (s SubCollection) TaggedDirEntry() (TaggedDirEntry, error) {
 	return TaggedDirEntry{}, errors.New("Subcollection doesnt have collection tags")
 }
 
+// What an export writes
+const (
+	ExportFiles       = ""             // one file per tag
+	ExportChain       = "chain"        // one wav per subcollection, with every slice padded to the same length
+	ExportPackedChain = "packed chain" // one wav per subcollection, with slices back to back
+
+	ExportSfz                 = "sfz"                   // files plus an sfz instrument per collection
+	ExportSfzPerSubCollection = "sfz per subcollection" // files plus an sfz instrument per subcollection
+	ExportDrumRack            = "drum rack"             // files plus an ableton drum rack preset per subcollection
+)
+
 type Export struct {
-	id        int
-	name      string
-	outputDir string
-	concrete  bool
+	id            int
+	name          string
+	outputDir     string
+	concrete      bool
+	WriteMetadata bool   // write collection details into exported copies, concrete exports only
+	Format        string // wav or flac to decode and re-encode every file, empty to copy or link the originals
+	SampleRate    int    // transcoding only, 0 keeps the source rate
+	BitDepth      int    // transcoding only, 0 keeps the source depth
+	Mono          bool   // transcoding only, sum both channels into one
+	Profile       string // a device profile whose format and limits override the settings above
+	Kind          string // one of the export kinds above
+	Sidecar       bool   // chains only, write the slice positions to a csv next to each chain
 }
 
 func NewExport(id int, name string, outputDir string, concrete bool) Export {
@@ -421,14 +550,288 @@ func (e Export) Path() string {
 	return e.outputDir
 }
 
+func (e Export) Concrete() bool {
+	return e.concrete
+}
+
+// Whether the export writes new files rather than copying or linking the originals. Profiles set the
+// format when the export runs.
+func (e Export) Transcodes() bool {
+	return e.Format != ""
+}
+
+// Whether the export writes sfz instruments alongside its files
+func (e Export) WritesSfz() bool {
+	return e.Kind == ExportSfz || e.Kind == ExportSfzPerSubCollection
+}
+
+// Whether the export joins each subcollection into a sample chain
+func (e Export) Chains() bool {
+	return e.Kind == ExportChain || e.Kind == ExportPackedChain
+}
+
 func (e Export) Description() string {
+	description := "abstract"
 	if e.concrete {
-		return "concrete"
-	} else {
-		return "abstract"
+		description = "concrete"
+	}
+	if e.Profile != "" {
+		description = "profile " + e.Profile
+	} else if e.Transcodes() {
+		description = "transcodes to " + e.Format
+		if e.BitDepth > 0 {
+			description += fmt.Sprintf(", %dbit", e.BitDepth)
+		}
+		if e.SampleRate > 0 {
+			description += fmt.Sprintf(", %dhz", e.SampleRate)
+		}
+		if e.Mono {
+			description += ", mono"
+		}
 	}
+	if e.Chains() {
+		description += ", " + e.Kind + "s"
+	} else if e.WritesSfz() || e.Kind == ExportDrumRack {
+		description += ", " + e.Kind
+	}
+	if e.concrete && e.WriteMetadata {
+		description += ", writes metadata"
+	}
+	return description
 }
 
 func (e Export) TaggedDirEntry() (TaggedDirEntry, error) {
 	return TaggedDirEntry{}, errors.New("Exports do not have collection tags")
 }
+
+// A file whose decoded audio is identical to at least one other file in the root
+type Duplicate struct {
+	FilePath string
+	Hash     string
+	Group    int
+	Copies   int
+	display  string
+}
+
+func NewDuplicate(filePath string, hash string, group int, copies int, display string) Duplicate {
+	return Duplicate{FilePath: filePath, Hash: hash, Group: group, Copies: copies, display: display}
+}
+
+func (d Duplicate) Id() int {
+	return d.Group
+}
+
+func (d Duplicate) Name() string {
+	return fmt.Sprintf("[%d] %s", d.Group, d.display)
+}
+
+func (d Duplicate) Path() string {
+	return d.FilePath
+}
+
+func (d Duplicate) Description() string {
+	return fmt.Sprintf("%d copies", d.Copies)
+}
+
+func (d Duplicate) IsDir() bool {
+	return false
+}
+
+func (d Duplicate) IsFile() bool {
+	return true
+}
+
+func (d Duplicate) TaggedDirEntry() (TaggedDirEntry, error) {
+	return TaggedDirEntry{}, errors.New("Duplicates do not have collection tags")
+}
+
+// A search result ranked by how close it sounds to a reference sample
+type SimilarSound struct {
+	FilePath string
+	Distance float64
+}
+
+func NewSimilarSound(filePath string, distance float64) SimilarSound {
+	return SimilarSound{FilePath: filePath, Distance: distance}
+}
+
+func (s SimilarSound) Id() int {
+	return 0
+}
+
+func (s SimilarSound) Name() string {
+	return path.Base(s.FilePath)
+}
+
+func (s SimilarSound) Path() string {
+	return s.FilePath
+}
+
+func (s SimilarSound) Description() string {
+	return fmt.Sprintf("distance %.2f • %s", s.Distance, path.Dir(s.FilePath))
+}
+
+func (s SimilarSound) IsDir() bool {
+	return false
+}
+
+func (s SimilarSound) IsFile() bool {
+	return true
+}
+
+func (s SimilarSound) TaggedDirEntry() (TaggedDirEntry, error) {
+	return TaggedDirEntry{}, errors.New("Similar sounds do not have collection tags")
+}
+
+// One file's part in a batch rename, with the reason it'll be skipped if there is one
+type RenamePlan struct {
+	From    string
+	To      string
+	Problem string
+}
+
+func (r RenamePlan) Id() int {
+	return 0
+}
+
+func (r RenamePlan) Name() string {
+	if r.Problem != "" {
+		return fmt.Sprintf("%s → %s [skipped: %s]", path.Base(r.From), path.Base(r.To), r.Problem)
+	}
+	return fmt.Sprintf("%s → %s", path.Base(r.From), path.Base(r.To))
+}
+
+func (r RenamePlan) Path() string {
+	return r.From
+}
+
+func (r RenamePlan) Description() string {
+	return path.Dir(r.From)
+}
+
+func (r RenamePlan) IsDir() bool {
+	return false
+}
+
+func (r RenamePlan) IsFile() bool {
+	return true
+}
+
+func (r RenamePlan) TaggedDirEntry() (TaggedDirEntry, error) {
+	return TaggedDirEntry{}, errors.New("Rename plans do not have collection tags")
+}
+
+// Where a kit recipe rule draws its samples from
+const (
+	KitFromDir        = "dir"        // a directory beneath the root
+	KitFromSearch     = "search"     // files anywhere beneath the root matching a search
+	KitFromCollection = "collection" // files tagged in a collection
+)
+
+// One slot of a kit recipe: how many samples to draw, where from, and the subcollection they go in
+type KitRule struct {
+	Count         int
+	Source        string
+	Value         string
+	SubCollection string
+}
+
+func (r KitRule) String() string {
+	return fmt.Sprintf("%d %s:%s > %s", r.Count, r.Source, r.Value, r.SubCollection)
+}
+
+// Read kit rules separated by semicolons or new lines. Each is "[count] [dir:|search:|collection:]value [> subcollection]",
+// counting one and searching when they're left out. Every rule fills its own subcollection, named after what it
+// draws from unless one is given.
+func ParseKitRules(text string) ([]KitRule, error) {
+	rules := make([]KitRule, 0)
+	seen := make(map[string]bool)
+	for _, line := range strings.FieldsFunc(text, func(r rune) bool { return r == ';' || r == '\n' }) {
+		line, subCollection, _ := strings.Cut(line, ">")
+		rule := KitRule{Count: 1, Source: KitFromSearch, SubCollection: strings.TrimSpace(subCollection)}
+		line = strings.TrimSpace(line)
+		if first, rest, found := strings.Cut(line, " "); found {
+			if count, err := strconv.Atoi(first); err == nil {
+				rule.Count = count
+				line = strings.TrimSpace(rest)
+			}
+		}
+		if source, value, found := strings.Cut(line, ":"); found {
+			switch source = strings.ToLower(strings.TrimSpace(source)); source {
+			case KitFromDir, KitFromSearch, KitFromCollection:
+				rule.Source = source
+				line = strings.TrimSpace(value)
+			}
+		}
+		rule.Value = line
+		if rule.Value == "" {
+			continue
+		}
+		if rule.Count < 1 {
+			return rules, errors.New(fmt.Sprintf("%s draws %d samples, it needs at least one", rule.Value, rule.Count))
+		}
+		if rule.SubCollection == "" {
+			rule.SubCollection = path.Base(rule.Value)
+		}
+		if !strings.HasPrefix(rule.SubCollection, "/") {
+			rule.SubCollection = "/" + rule.SubCollection
+		}
+		if seen[rule.SubCollection] {
+			return rules, errors.New(fmt.Sprintf("two rules fill %s, give one its own subcollection with > /name", rule.SubCollection))
+		}
+		seen[rule.SubCollection] = true
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return rules, errors.New("a recipe needs at least one rule")
+	}
+	return rules, nil
+}
+
+// Write kit rules back out in the form ParseKitRules reads
+func FormatKitRules(rules []KitRule) string {
+	lines := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		lines = append(lines, rule.String())
+	}
+	return strings.Join(lines, "; ")
+}
+
+// A named list of kit rules
+type Recipe struct {
+	id    int
+	name  string
+	Rules []KitRule
+}
+
+func NewRecipe(id int, name string, rules []KitRule) Recipe {
+	return Recipe{id: id, name: name, Rules: rules}
+}
+
+func (r Recipe) Id() int {
+	return r.id
+}
+
+func (r Recipe) Name() string {
+	return r.name
+}
+
+func (r Recipe) Path() string {
+	return ""
+}
+
+func (r Recipe) Description() string {
+	return FormatKitRules(r.Rules)
+}
+
+func (r Recipe) IsDir() bool {
+	return false
+}
+
+func (r Recipe) IsFile() bool {
+	return false
+}
+
+func (r Recipe) TaggedDirEntry() (TaggedDirEntry, error) {
+	return TaggedDirEntry{}, errors.New("Recipes do not have collection tags")
+}
@@ -0,0 +1,16 @@
+package core
+
+// Columns added to tables after they were first released. sqlite has no "add column if not exists", so
+// these run on every launch and the duplicate column error from an up to date db is ignored. New columns
+// are also added to create_db.sql so the schema there stays complete.
+var Migrations = []string{
+	`ALTER TABLE Export ADD COLUMN write_metadata number(1) default(0)`,
+	`ALTER TABLE Export ADD COLUMN format TEXT default('')`,
+	`ALTER TABLE Export ADD COLUMN sample_rate INTEGER default(0)`,
+	`ALTER TABLE Export ADD COLUMN bit_depth INTEGER default(0)`,
+	`ALTER TABLE Export ADD COLUMN mono number(1) default(0)`,
+	`ALTER TABLE Export ADD COLUMN profile TEXT default('')`,
+	`ALTER TABLE Export ADD COLUMN kind TEXT default('')`,
+	`ALTER TABLE Export ADD COLUMN sidecar number(1) default(0)`,
+	`ALTER TABLE User ADD COLUMN projects_dir TEXT default('')`,
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 func ExpandPath(dir string) string {
@@ -19,3 +20,12 @@ func ExpandPath(dir string) string {
 	}
 	return dir
 }
+
+// Whether a file name has an extension excavator can play
+func IsAudioFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".wav", ".mp3", ".flac":
+		return true
+	}
+	return false
+}
@@ -54,6 +54,31 @@ type KeyMap struct {
 	NextLocalSearchResult      key.Binding
 	PreviousLocalSearchResult  key.Binding
 	ShowHelp                   key.Binding
+	ToggleSpectrogram          key.Binding
+	FindDuplicates             key.Binding
+	FindSimilarFromCurrent     key.Binding
+	FindSimilarFromRoot        key.Binding
+	FindSimilarInCollection    key.Binding
+	AnalyseDir                 key.Binding
+	ToggleDetails              key.Binding
+	ImportSession              key.Binding
+	ScanProjects               key.Binding
+	SyncAbletonLabels          key.Binding
+	Rename                     key.Binding
+	Move                       key.Binding
+	BatchRename                key.Binding
+	Undo                       key.Binding
+	Redo                       key.Binding
+	Untag                      key.Binding
+	ToggleMark                 key.Binding
+	VisualMode                 key.Binding
+	ClearSelection             key.Binding
+	AuditionLayered            key.Binding
+	ManageCollections          key.Binding
+	DuplicateCollection        key.Binding
+	CombineCollections         key.Binding
+	KitRecipes                 key.Binding
+	RerollKitSlot              key.Binding
 }
 
 // The actual help text
@@ -65,11 +90,13 @@ func (k KeyMap) ShortHelp() []key.Binding {
 func (k KeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
 		{k.Up, k.Down, k.JumpUp, k.JumpDown, k.JumpBottom},
-		{k.Audition, k.AuditionRandom, k.ToggleAutoAudition, k.ToggleShowCollections},
-		{k.NewCollection, k.SetTargetCollection, k.SetTargetSubCollection, k.BrowseTargetCollection},
-		{k.CreateQuickTag, k.CreateTag, k.CreateExport, k.RunExport},
+		{k.ToggleMark, k.VisualMode, k.ClearSelection, k.AuditionLayered, k.Undo, k.Redo},
+		{k.Audition, k.AuditionRandom, k.ToggleAutoAudition, k.ToggleShowCollections, k.ToggleSpectrogram, k.ToggleDetails},
+		{k.NewCollection, k.SetTargetCollection, k.SetTargetSubCollection, k.BrowseTargetCollection, k.ManageCollections, k.KitRecipes, k.ImportSession, k.SyncAbletonLabels},
+		{k.CreateQuickTag, k.CreateTag, k.Untag, k.CreateExport, k.RunExport, k.Rename, k.Move, k.BatchRename},
 		{k.SearchBuf, k.FuzzySearchFromRoot, k.FuzzySearchFromCurrent, k.InsertMode},
-		{k.NextLocalSearchResult, k.PreviousLocalSearchResult, k.Quit},
+		{k.FindSimilarFromCurrent, k.FindSimilarFromRoot, k.FindSimilarInCollection, k.AnalyseDir, k.ScanProjects},
+		{k.NextLocalSearchResult, k.PreviousLocalSearchResult, k.FindDuplicates, k.Quit},
 		{},
 	}
 }
@@ -184,4 +211,104 @@ var DefaultKeyMap = KeyMap{
 		key.WithKeys("?"),
 		key.WithHelp("?", "show help"),
 	),
+	ToggleSpectrogram: key.NewBinding(
+		key.WithKeys("s"),
+		key.WithHelp("s", "toggle spectrogram"),
+	),
+	FindDuplicates: key.NewBinding(
+		key.WithKeys("X"),
+		key.WithHelp("X", "find duplicates"),
+	),
+	FindSimilarFromCurrent: key.NewBinding(
+		key.WithKeys("m"),
+		key.WithHelp("m", "similar sounds from current dir"),
+	),
+	FindSimilarFromRoot: key.NewBinding(
+		key.WithKeys("M"),
+		key.WithHelp("M", "similar sounds from root"),
+	),
+	FindSimilarInCollection: key.NewBinding(
+		key.WithKeys("alt+m"),
+		key.WithHelp("alt+m", "similar sounds in target collection"),
+	),
+	AnalyseDir: key.NewBinding(
+		key.WithKeys("L"),
+		key.WithHelp("L", "analyse current dir"),
+	),
+	ToggleDetails: key.NewBinding(
+		key.WithKeys("I"),
+		key.WithHelp("I", "toggle details"),
+	),
+	ImportSession: key.NewBinding(
+		key.WithKeys("O"),
+		key.WithHelp("O", "import daw session"),
+	),
+	ScanProjects: key.NewBinding(
+		key.WithKeys("P"),
+		key.WithHelp("P", "scan projects for sample usage"),
+	),
+	SyncAbletonLabels: key.NewBinding(
+		key.WithKeys("S"),
+		key.WithHelp("S", "sync ableton browser labels"),
+	),
+	Rename: key.NewBinding(
+		key.WithKeys("R"),
+		key.WithHelp("R", "rename file or directory"),
+	),
+	Move: key.NewBinding(
+		key.WithKeys("W"),
+		key.WithHelp("W", "move file or directory"),
+	),
+	BatchRename: key.NewBinding(
+		key.WithKeys("B"),
+		key.WithHelp("B", "batch rename listed files"),
+	),
+	Undo: key.NewBinding(
+		key.WithKeys("u"),
+		key.WithHelp("u", "undo"),
+	),
+	Redo: key.NewBinding(
+		key.WithKeys("ctrl+r"),
+		key.WithHelp("ctrl+r", "redo"),
+	),
+	Untag: key.NewBinding(
+		key.WithKeys("x"),
+		key.WithHelp("x", "untag file or directory"),
+	),
+	ToggleMark: key.NewBinding(
+		key.WithKeys(" "),
+		key.WithHelp("space", "mark or unmark"),
+	),
+	VisualMode: key.NewBinding(
+		key.WithKeys("v"),
+		key.WithHelp("v", "visual select"),
+	),
+	ClearSelection: key.NewBinding(
+		key.WithKeys("V"),
+		key.WithHelp("V", "clear selection"),
+	),
+	AuditionLayered: key.NewBinding(
+		key.WithKeys("alt+a"),
+		key.WithHelp("alt+a", "audition selection layered"),
+	),
+	ManageCollections: key.NewBinding(
+		key.WithKeys("o"),
+		key.WithHelp("o", "manage collections"),
+	),
+	DuplicateCollection: key.NewBinding(
+		key.WithKeys("y"),
+		key.WithHelp("y", "duplicate collection"),
+	),
+	CombineCollections: key.NewBinding(
+		key.WithKeys("+"),
+		key.WithHelp("+", "combine collections"),
+	),
+	KitRecipes: key.NewBinding(
+		key.WithKeys("z"),
+		key.WithHelp("z", "random kit recipes"),
+	),
+	RerollKitSlot: key.NewBinding(
+		key.WithKeys("Z"),
+		key.WithHelp("Z", "re-roll kit slot"),
+	),
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
@@ -16,9 +18,10 @@ import (
 
 // ////////////////////// APP ////////////////////////
 type App struct {
-	server         *server.Server
-	bubbleTeaModel window.Model
-	logFile        *os.File
+	server           *server.Server
+	bubbleTeaModel   window.Model
+	logFile          *os.File
+	needsUserAndRoot bool
 }
 
 // Construct the app
@@ -37,9 +40,10 @@ func NewApp(cliFlags *server.Flags) App {
 		needsUserAndRoot = true
 	}
 	return App{
-		server:         &server,
-		bubbleTeaModel: window.ExcavatorModel(&server, needsUserAndRoot),
-		logFile:        f,
+		server:           &server,
+		bubbleTeaModel:   window.ExcavatorModel(&server, needsUserAndRoot),
+		logFile:          f,
+		needsUserAndRoot: needsUserAndRoot,
 	}
 }
 
@@ -51,6 +55,16 @@ func main() {
 	if cliFlags.Watch {
 		core.Watch(logFilePath, 10)
 		select {}
+	} else if len(flag.Args()) > 0 {
+		app := NewApp(cliFlags)
+		err := RunCommand(app, flag.Args())
+		app.server.Db.Close()
+		app.server.Player.Close()
+		app.logFile.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 	} else {
 		app := NewApp(cliFlags)
 		defer app.logFile.Close()
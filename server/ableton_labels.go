@@ -0,0 +1,177 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jesses-code-adventures/excavator/ableton"
+	"github.com/jesses-code-adventures/excavator/core"
+)
+
+// ////////////////////// ABLETON BROWSER LABELS ////////////////////////
+
+// How a sync with Live's browser labels went
+type LabelSync struct {
+	Imported int
+	Exported int
+	Failed   int
+}
+
+// A one line summary for the status bar
+func (l LabelSync) String() string {
+	summary := fmt.Sprintf("%d imported, %d exported", l.Imported, l.Exported)
+	if l.Failed > 0 {
+		summary += fmt.Sprintf(", %d folders failed", l.Failed)
+	}
+	return summary
+}
+
+// The collection and subcollection a label maps to, "Drums|Kick" being the Kick subcollection of Drums
+func labelToCollection(label string) (string, string) {
+	parts := strings.Split(label, ableton.LabelSeparator)
+	subCollection := ""
+	if len(parts) > 1 {
+		subCollection = "/" + strings.Join(parts[1:], "/")
+	}
+	return strings.TrimSpace(parts[0]), subCollection
+}
+
+// The label for a collection tag, the reverse of labelToCollection
+func collectionToLabel(collection string, subCollection string) string {
+	parts := []string{collection}
+	for _, part := range strings.Split(subCollection, "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ableton.LabelSeparator)
+}
+
+// Tag every file Live has labelled beneath the root into the collection named by its label, creating collections
+// as needed
+func (s *Server) importAbletonLabels(sync *LabelSync) error {
+	type labelled struct {
+		filePath      string
+		collection    string
+		subCollection string
+	}
+	found := make([]labelled, 0)
+	err := filepath.WalkDir(s.State.Root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || d.Name() != ableton.FolderInfoDir {
+			return nil
+		}
+		dir := filepath.Dir(p)
+		labels, err := ableton.ReadFolderLabels(dir)
+		if err != nil {
+			log.Printf("Failed to read ableton labels in %s: %v", dir, err)
+			sync.Failed++
+			return filepath.SkipDir
+		}
+		for file, fileLabels := range labels.Labels {
+			filePath := filepath.Join(dir, file)
+			if !core.IsAudioFile(filePath) {
+				continue
+			}
+			if _, err := os.Stat(filePath); err != nil {
+				continue
+			}
+			for _, label := range fileLabels {
+				collection, subCollection := labelToCollection(label)
+				if collection != "" {
+					found = append(found, labelled{filePath: filePath, collection: collection, subCollection: subCollection})
+				}
+			}
+		}
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return err
+	}
+	// collections are made before the transaction, which would otherwise hold the db
+	collectionIds := make(map[string]int)
+	changes := make([]JournalChange, 0)
+	for _, l := range found {
+		if _, ok := collectionIds[l.collection]; ok {
+			continue
+		}
+		collectionIds[l.collection] = s.getCollectionIdByName(l.collection)
+		if collectionIds[l.collection] == 0 {
+			description := "imported from ableton labels"
+			collectionIds[l.collection] = s.createCollection(l.collection, description)
+			changes = append(changes, JournalChange{Kind: changeCreateCollection, CollectionId: collectionIds[l.collection], Name: l.collection, Description: description})
+		}
+	}
+	tx, err := s.Db.Begin()
+	if err != nil {
+		log.Fatalf("Failed to begin transaction in importAbletonLabels: %v", err)
+	}
+	for _, l := range found {
+		if addCollectionTagInTx(tx, s.User.Id, l.filePath, collectionIds[l.collection], filepath.Base(l.filePath), l.subCollection) {
+			changes = append(changes, tagChange(l.filePath, collectionIds[l.collection], filepath.Base(l.filePath), l.subCollection))
+			sync.Imported++
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("Failed to commit transaction in importAbletonLabels: %v", err)
+	}
+	s.journal("import ableton labels", changes...)
+	return nil
+}
+
+// Label every tagged file with its collections in the sidecar beside it, keeping the labels already there
+func (s *Server) exportAbletonLabels(sync *LabelSync) {
+	added := make(map[string]map[string][]string)
+	for _, collection := range s.GetCollections() {
+		for _, tag := range s.GetCollectionTags(collection.Id()) {
+			dir := filepath.Dir(tag.FilePath)
+			if added[dir] == nil {
+				added[dir] = make(map[string][]string)
+			}
+			file := filepath.Base(tag.FilePath)
+			added[dir][file] = append(added[dir][file], collectionToLabel(tag.CollectionName, tag.SubCollection))
+		}
+	}
+	for dir, files := range added {
+		labels, err := ableton.ReadFolderLabels(dir)
+		if err != nil {
+			log.Printf("Failed to read ableton labels in %s: %v", dir, err)
+			sync.Failed++
+			continue
+		}
+		changed := 0
+		for file, fileLabels := range files {
+			for _, label := range fileLabels {
+				if labels.Add(file, label) {
+					changed++
+				}
+			}
+		}
+		if changed == 0 {
+			continue
+		}
+		if err := labels.Write(); err != nil {
+			log.Printf("Failed to write ableton labels to %s: %v", labels.Path, err)
+			sync.Failed++
+			continue
+		}
+		sync.Exported += changed
+	}
+}
+
+// Bring Live's browser labels into excavator's collections, then write excavator's collections out as labels, so
+// tagging in either shows up in the other. Nothing is removed on either side.
+func (s *Server) SyncAbletonLabels() (LabelSync, error) {
+	sync := LabelSync{}
+	if err := s.importAbletonLabels(&sync); err != nil {
+		return sync, err
+	}
+	s.exportAbletonLabels(&sync)
+	return sync, nil
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+
+	"github.com/jesses-code-adventures/excavator/audio"
+)
+
+// ////////////////////// ANALYSIS CACHE ////////////////////////
+
+// Modification time used to decide whether a cached analysis result is stale
+func fileModTime(filePath string) (int64, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return 0, err
+	}
+	return info.ModTime().UnixNano(), nil
+}
+
+// Get the spectrogram for a file, analysing it only if the cached result is missing or stale
+func (s *Server) GetSpectrogram(filePath string) (audio.Spectrogram, error) {
+	modTime, err := fileModTime(filePath)
+	if err != nil {
+		return audio.Spectrogram{}, err
+	}
+	spectrogram, err := s.GetSpectrogramFromDb(filePath, modTime)
+	if err == nil {
+		return spectrogram, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return audio.Spectrogram{}, err
+	}
+	log.Printf("analysing spectrogram for %s", filePath)
+	spectrogram, err = audio.NewSpectrogram(filePath)
+	if err != nil {
+		return audio.Spectrogram{}, err
+	}
+	if err := s.UpsertSpectrogramInDb(filePath, modTime, spectrogram); err != nil {
+		return audio.Spectrogram{}, err
+	}
+	return spectrogram, nil
+}
+
+// Get a cached spectrogram, returning sql.ErrNoRows if there isn't one for this version of the file
+func (s *Server) GetSpectrogramFromDb(filePath string, modTime int64) (audio.Spectrogram, error) {
+	statement := `select frames, bands, levels from Spectrogram where file_path = ? and mod_time = ?`
+	row := s.Db.QueryRow(statement, filePath, modTime)
+	var frames, bands int
+	var levels []byte
+	if err := row.Scan(&frames, &bands, &levels); err != nil {
+		return audio.Spectrogram{}, err
+	}
+	return audio.SpectrogramFromLevels(frames, bands, levels)
+}
+
+// Store a spectrogram, replacing any stale result for the same file
+func (s *Server) UpsertSpectrogramInDb(filePath string, modTime int64, spectrogram audio.Spectrogram) error {
+	statement := `insert or replace into Spectrogram (file_path, mod_time, frames, bands, levels) values (?, ?, ?, ?, ?)`
+	_, err := s.Db.Exec(statement, filePath, modTime, spectrogram.Frames, spectrogram.Bands, spectrogram.Levels)
+	return err
+}
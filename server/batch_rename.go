@@ -0,0 +1,193 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jesses-code-adventures/excavator/core"
+)
+
+// ////////////////////// BATCH RENAMING ////////////////////////
+
+// Matches a template token such as {name} or {index:02}
+var templateToken = regexp.MustCompile(`\{([a-z]+)(?::(\d+))?\}`)
+
+// Runs of separators left behind by empty tokens
+var repeatedSeparators = regexp.MustCompile(`([ _-])[ _-]+`)
+
+// How a batch rename went
+type BatchRename struct {
+	Renamed int
+	Skipped int
+	Failed  int
+}
+
+// A one line summary for the status bar
+func (b BatchRename) String() string {
+	summary := fmt.Sprintf("%d renamed", b.Renamed)
+	if b.Skipped > 0 {
+		summary += fmt.Sprintf(", %d skipped", b.Skipped)
+	}
+	if b.Failed > 0 {
+		summary += fmt.Sprintf(", %d failed", b.Failed)
+	}
+	return summary
+}
+
+// The value of one template token for a file, the index counting from 1
+func (s *Server) templateValue(filePath string, index int, token string, width string) (string, error) {
+	switch token {
+	case "name":
+		return strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath)), nil
+	case "index":
+		if width == "" {
+			return strconv.Itoa(index), nil
+		}
+		padding, _ := strconv.Atoi(width)
+		return fmt.Sprintf("%0*d", padding, index), nil
+	case "dir":
+		return filepath.Base(filepath.Dir(filePath)), nil
+	case "category":
+		return s.GetCategory(filePath), nil
+	case "bpm", "key":
+		metadata, err := s.GetMetadata(filePath)
+		if err != nil {
+			return "", nil
+		}
+		if token == "key" {
+			return metadata.Key, nil
+		}
+		if metadata.Tempo <= 0 {
+			return "", nil
+		}
+		return strconv.Itoa(int(math.Round(metadata.Tempo))), nil
+	}
+	return "", errors.New(fmt.Sprintf("unknown template token {%s}", token))
+}
+
+// Work out the new name of every file without touching anything. The template is filled in for each file, then
+// find, a regular expression, is replaced in the result. Extensions are kept. Files whose new name would clash or
+// doesn't change are marked with a problem and left alone when the plan is applied.
+func (s *Server) PlanBatchRename(files []string, template string, find string, replace string) ([]core.RenamePlan, error) {
+	if strings.TrimSpace(template) == "" {
+		return nil, errors.New("the template is empty")
+	}
+	var pattern *regexp.Regexp
+	if find != "" {
+		var err error
+		pattern, err = regexp.Compile(find)
+		if err != nil {
+			return nil, err
+		}
+	}
+	plans := make([]core.RenamePlan, 0, len(files))
+	for i, filePath := range files {
+		var tokenErr error
+		name := templateToken.ReplaceAllStringFunc(template, func(match string) string {
+			parts := templateToken.FindStringSubmatch(match)
+			value, err := s.templateValue(filePath, i+1, parts[1], parts[2])
+			if err != nil {
+				tokenErr = err
+			}
+			return strings.ReplaceAll(value, string(filepath.Separator), "-")
+		})
+		if tokenErr != nil {
+			return nil, tokenErr
+		}
+		if pattern != nil {
+			name = pattern.ReplaceAllString(name, replace)
+		}
+		name = strings.Trim(repeatedSeparators.ReplaceAllString(name, "$1"), " _-")
+		plan := core.RenamePlan{From: filePath, To: filepath.Join(filepath.Dir(filePath), name+filepath.Ext(filePath))}
+		switch {
+		case name == "" || strings.ContainsRune(name, filepath.Separator):
+			plan.Problem = "invalid name"
+		case plan.To == plan.From:
+			plan.Problem = "unchanged"
+		}
+		plans = append(plans, plan)
+	}
+	// targets are checked once every plan is known, as renames within the batch can free up a name
+	sources := make(map[string]bool)
+	targets := make(map[string]int)
+	for _, plan := range plans {
+		if plan.Problem == "" {
+			sources[plan.From] = true
+			targets[plan.To]++
+		}
+	}
+	for i, plan := range plans {
+		if plan.Problem != "" {
+			continue
+		}
+		if targets[plan.To] > 1 {
+			plans[i].Problem = "clashes with another new name"
+		} else if _, err := os.Lstat(plan.To); err == nil && !sources[plan.To] {
+			plans[i].Problem = "already exists"
+		}
+	}
+	return plans, nil
+}
+
+// Rename each file in a batch so no rename lands on a name another file still holds. Returns the renames that were
+// made, in the order they were made.
+func (s *Server) applyRenames(plans []core.RenamePlan, result *BatchRename) []core.RenamePlan {
+	applied := make([]core.RenamePlan, 0, len(plans))
+	pending := make([]core.RenamePlan, 0, len(plans))
+	for _, plan := range plans {
+		if plan.Problem != "" {
+			result.Skipped++
+		} else {
+			pending = append(pending, plan)
+		}
+	}
+	for len(pending) > 0 {
+		held := make(map[string]bool)
+		for _, plan := range pending {
+			held[plan.From] = true
+		}
+		waiting := make([]core.RenamePlan, 0)
+		for _, plan := range pending {
+			// wait for whichever file holds the name to move first
+			if held[plan.To] {
+				waiting = append(waiting, plan)
+				continue
+			}
+			delete(held, plan.From)
+			if err := s.movePath(plan.From, plan.To); err != nil {
+				log.Printf("Failed to rename %s: %v", plan.From, err)
+				result.Failed++
+				continue
+			}
+			applied = append(applied, plan)
+			result.Renamed++
+		}
+		if len(waiting) == len(pending) {
+			// a cycle of names, which is left as it is
+			result.Failed += len(waiting)
+			break
+		}
+		pending = waiting
+	}
+	return applied
+}
+
+// Rename every file in the plan that has no problem, keeping tags and cached results with their files. The whole
+// batch is undone in one step.
+func (s *Server) ApplyBatchRename(plans []core.RenamePlan) BatchRename {
+	result := BatchRename{}
+	applied := s.applyRenames(plans, &result)
+	changes := make([]JournalChange, 0, len(applied))
+	for _, plan := range applied {
+		changes = append(changes, JournalChange{Kind: changeMove, From: plan.From, To: plan.To})
+	}
+	s.journal(fmt.Sprintf("batch rename of %d files", len(applied)), changes...)
+	return result
+}
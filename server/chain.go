@@ -0,0 +1,76 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/jesses-code-adventures/excavator/audio"
+	"github.com/jesses-code-adventures/excavator/core"
+)
+
+// ////////////////////// SAMPLE CHAIN EXPORTS ////////////////////////
+
+// The samples that go into one chain, in slice order
+type chainGroup struct {
+	sources []string
+	names   []string
+}
+
+// Write one chain per subcollection in the plan. Each chain takes the place of its subcollection's folder, so
+// kicks/ becomes kicks.wav, with the optional slice list beside it as kicks.csv.
+func (s *Server) exportChains(plan exportPlan, export core.Export, profile *ExportProfile, report *ExportReport) {
+	groups := make(map[string]*chainGroup)
+	destinations := make([]string, 0)
+	for _, item := range plan.items {
+		dir := path.Dir(item.destination)
+		destination := dir + ".wav"
+		if profile != nil {
+			destination = path.Join(path.Dir(dir), profile.FixName(path.Base(destination)))
+		}
+		group, ok := groups[destination]
+		if !ok {
+			group = &chainGroup{}
+			groups[destination] = group
+			destinations = append(destinations, destination)
+		}
+		name := item.tag.Name()
+		group.sources = append(group.sources, item.tag.FilePath)
+		group.names = append(group.names, strings.TrimSuffix(name, path.Ext(name)))
+	}
+	options := audio.TranscodeOptions{SampleRate: export.SampleRate, BitDepth: export.BitDepth, Mono: export.Mono}
+	var mu sync.Mutex
+	forEachFileParallel(destinations, func(destination string) {
+		group := groups[destination]
+		err := os.MkdirAll(path.Dir(destination), 0755)
+		if err == nil {
+			if _, statErr := os.Stat(destination); statErr == nil {
+				err = os.ErrExist
+			}
+		}
+		var chain audio.Chain
+		if err == nil {
+			chain, err = audio.WriteChain(destination, group.sources, group.names, options, export.Kind == core.ExportChain)
+		}
+		if err == nil && export.Sidecar {
+			if sidecarErr := chain.WriteSliceList(strings.TrimSuffix(destination, ".wav") + ".csv"); sidecarErr != nil {
+				log.Printf("Failed to write slice list for %s: %v", destination, sidecarErr)
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case errors.Is(err, os.ErrExist):
+			log.Printf("Destination already exists: %s", destination)
+			report.Skipped++
+		case err != nil:
+			report.Fail(destination, err)
+		default:
+			log.Printf("Exported a chain of %d samples to %s", len(group.sources), destination)
+			report.Exported++
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jesses-code-adventures/excavator/audio"
+)
+
+// ////////////////////// CLASSIFICATION ////////////////////////
+
+// Search prefixes that filter results by category rather than filename
+var categorySearchPrefixes = []string{"category:", "cat:"}
+
+// Read embedded metadata from every file beneath dir and label each with a category
+func (s *Server) AnalyseDir(dir string) error {
+	files, err := ListAudioFiles(dir)
+	if err != nil {
+		return err
+	}
+	if err := s.IndexMetadata(files); err != nil {
+		return err
+	}
+	return s.ClassifyFiles(files)
+}
+
+// Label files with a category, storing the result with its confidence
+func (s *Server) ClassifyFiles(files []string) error {
+	features, err := s.IndexFeatures(files)
+	if err != nil {
+		return err
+	}
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	statement := `insert or replace into Category (file_path, mod_time, category, confidence) values (?, ?, ?, ?)`
+	for file, f := range features {
+		modTime, err := fileModTime(file)
+		if err != nil {
+			continue
+		}
+		category, confidence := audio.Classify(file, f)
+		if _, err := tx.Exec(statement, file, modTime, category.String(), confidence); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("classified %d files", len(features))
+	return nil
+}
+
+// Categories of every classified file beneath a directory, keyed by path
+func (s *Server) GetDirectoryCategories(dir string) map[string]string {
+	categories := make(map[string]string)
+	prefix := dirPrefix(dir)
+	s.readCategories(categories, `select file_path, category from Category where substr(file_path, 1, length(?)) = ?`, prefix, prefix)
+	return categories
+}
+
+// Categories of whichever of the files have been classified, keyed by path
+func (s *Server) GetCategories(paths []string) map[string]string {
+	categories := make(map[string]string)
+	forEachPathBatch(paths, func(placeholders string, args []any) {
+		s.readCategories(categories, fmt.Sprintf(`select file_path, category from Category where file_path in (%s)`, placeholders), args...)
+	})
+	return categories
+}
+
+// Add the categories a query returns to categories
+func (s *Server) readCategories(categories map[string]string, statement string, args ...any) {
+	rows, err := s.Db.Query(statement, args...)
+	if err != nil {
+		log.Fatalf("Failed to execute SQL statement in readCategories: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var filePath, category string
+		if err := rows.Scan(&filePath, &category); err != nil {
+			log.Fatalf("Failed to scan row in readCategories: %v", err)
+		}
+		categories[filePath] = category
+	}
+}
+
+// Get the category of a file, or an empty string if it hasn't been classified
+func (s *Server) GetCategory(filePath string) string {
+	row := s.Db.QueryRow(`select category from Category where file_path = ?`, filePath)
+	var category string
+	if err := row.Scan(&category); err != nil {
+		return ""
+	}
+	return category
+}
+
+// Pull a category filter such as "cat:kick" out of a search, returning the remaining words and the category
+func SplitCategorySearch(search string) (string, string) {
+	words := make([]string, 0)
+	category := ""
+	for _, word := range strings.Fields(search) {
+		matched := false
+		for _, prefix := range categorySearchPrefixes {
+			if strings.HasPrefix(strings.ToLower(word), prefix) {
+				category = strings.ToLower(word[len(prefix):])
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			words = append(words, word)
+		}
+	}
+	return strings.Join(words, " "), category
+}
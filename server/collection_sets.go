@@ -0,0 +1,164 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jesses-code-adventures/excavator/core"
+)
+
+// ////////////////////// COLLECTION SET OPERATIONS ////////////////////////
+
+// How two or more collections are combined. Files are compared by path.
+type SetOperation string
+
+const (
+	SetUnion        SetOperation = "union"        // everything in any of the collections
+	SetIntersection SetOperation = "intersection" // only what's in every collection
+	SetDifference   SetOperation = "difference"   // what's in the first collection and none of the others
+)
+
+// Where a file goes when the collections it comes from disagree about its subcollection
+type SubCollectionConflict string
+
+const (
+	ConflictFirst      SubCollectionConflict = "first"      // the first collection listing it wins
+	ConflictAll        SubCollectionConflict = "all"        // it's tagged in every subcollection it was in
+	ConflictRoot       SubCollectionConflict = "root"       // it goes in the root of the new collection
+	ConflictCollection SubCollectionConflict = "collection" // every subcollection it was in, beneath the name of the collection it came from
+)
+
+// Read a set operation typed by the user
+func ParseSetOperation(value string) (SetOperation, error) {
+	switch operation := SetOperation(strings.ToLower(strings.TrimSpace(value))); operation {
+	case SetUnion, SetIntersection, SetDifference:
+		return operation, nil
+	}
+	return "", errors.New(fmt.Sprintf("unknown set operation %s, expected union, intersection or difference", value))
+}
+
+// Read a subcollection conflict rule typed by the user
+func ParseSubCollectionConflict(value string) (SubCollectionConflict, error) {
+	switch conflict := SubCollectionConflict(strings.ToLower(strings.TrimSpace(value))); conflict {
+	case ConflictFirst, ConflictAll, ConflictRoot, ConflictCollection:
+		return conflict, nil
+	}
+	return "", errors.New(fmt.Sprintf("unknown subcollection rule %s, expected first, all, root or collection", value))
+}
+
+// The collection a set operation made
+type CollectionSet struct {
+	Id     int
+	Name   string
+	Tagged int
+}
+
+func (c CollectionSet) String() string {
+	return fmt.Sprintf("%s: %d tagged", c.Name, c.Tagged)
+}
+
+// Work out the tags a set operation leaves, given each collection's tags in order
+func combineTags(operation SetOperation, collections [][]core.CollectionTag, conflict SubCollectionConflict) []core.CollectionTag {
+	membership := make(map[string]map[int]bool)
+	for i, tags := range collections {
+		for _, tag := range tags {
+			if membership[tag.FilePath] == nil {
+				membership[tag.FilePath] = make(map[int]bool)
+			}
+			membership[tag.FilePath][i] = true
+		}
+	}
+	keep := func(filePath string) bool {
+		switch operation {
+		case SetIntersection:
+			return len(membership[filePath]) == len(collections)
+		case SetDifference:
+			return len(membership[filePath]) == 1 && membership[filePath][0]
+		}
+		return true
+	}
+	sources := collections
+	if operation == SetDifference {
+		sources = collections[:1]
+	}
+	// the subcollections each file is in across the collections it's taken from, to tell which disagree
+	subCollections := make(map[string]map[string]bool)
+	for _, tags := range sources {
+		for _, tag := range tags {
+			if subCollections[tag.FilePath] == nil {
+				subCollections[tag.FilePath] = make(map[string]bool)
+			}
+			subCollections[tag.FilePath][tag.SubCollection] = true
+		}
+	}
+	combined := make([]core.CollectionTag, 0)
+	seenFiles := make(map[string]bool)
+	seenTags := make(map[string]bool)
+	for _, tags := range sources {
+		for _, tag := range tags {
+			if !keep(tag.FilePath) {
+				continue
+			}
+			subCollection := tag.SubCollection
+			switch conflict {
+			case ConflictFirst:
+				if seenFiles[tag.FilePath] {
+					continue
+				}
+			case ConflictRoot:
+				if len(subCollections[tag.FilePath]) > 1 {
+					subCollection = ""
+				}
+			case ConflictCollection:
+				subCollection = "/" + tag.CollectionName + subCollection
+			}
+			if key := tag.FilePath + "\x00" + subCollection; !seenTags[key] {
+				seenTags[key] = true
+				seenFiles[tag.FilePath] = true
+				combined = append(combined, core.NewCollectionTag(0, tag.Name(), tag.FilePath, "", subCollection))
+			}
+		}
+	}
+	return combined
+}
+
+// Find one of the current user's collections by name
+func (s *Server) FindCollection(name string) (core.CollectionMetadata, error) {
+	id := s.getCollectionIdByName(strings.TrimSpace(name))
+	if id == 0 {
+		return core.CollectionMetadata{}, errors.New(fmt.Sprintf("no collection called %s", name))
+	}
+	return s.getCollectionMetadata(id)
+}
+
+// Combine two or more collections into a new one called name
+func (s *Server) CombineCollections(operation SetOperation, ids []int, name string, conflict SubCollectionConflict) (CollectionSet, error) {
+	name = strings.TrimSpace(name)
+	result := CollectionSet{Name: name}
+	if len(ids) < 2 {
+		return result, errors.New("pick at least two collections")
+	}
+	if err := s.validCollectionName(0, name); err != nil {
+		return result, err
+	}
+	names := make([]string, 0, len(ids))
+	collections := make([][]core.CollectionTag, 0, len(ids))
+	for _, id := range ids {
+		collection, err := s.getCollectionMetadata(id)
+		if err != nil {
+			return result, err
+		}
+		names = append(names, collection.Name())
+		collections = append(collections, s.GetCollectionTags(id))
+	}
+	tags := combineTags(operation, collections, conflict)
+	description := fmt.Sprintf("%s of %s", operation, strings.Join(names, ", "))
+	result.Id = s.createCollection(name, description)
+	changes := []JournalChange{{Kind: changeCreateCollection, CollectionId: result.Id, Name: name, Description: description}}
+	for _, tag := range tags {
+		changes = append(changes, tagChange(tag.FilePath, result.Id, tag.Name(), tag.SubCollection))
+	}
+	result.Tagged = len(tags)
+	return result, s.makeChanges(fmt.Sprintf("%s as %s", description, name), changes)
+}
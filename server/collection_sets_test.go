@@ -0,0 +1,55 @@
+package server
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"testing"
+
+	"github.com/jesses-code-adventures/excavator/core"
+)
+
+// A collection's tags from file paths and subcollections in pairs
+func collectionTags(name string, pairs ...string) []core.CollectionTag {
+	tags := make([]core.CollectionTag, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		tags = append(tags, core.NewCollectionTag(i, path.Base(pairs[i]), pairs[i], name, pairs[i+1]))
+	}
+	return tags
+}
+
+func TestCombineTags(t *testing.T) {
+	collections := [][]core.CollectionTag{
+		collectionTags("A", "/kick.wav", "/drums", "/snare.wav", "/drums", "/pad.wav", "/keys"),
+		collectionTags("B", "/kick.wav", "/kicks", "/snare.wav", "/drums", "/hat.wav", "/hats"),
+	}
+	tests := []struct {
+		operation SetOperation
+		conflict  SubCollectionConflict
+		want      []string
+	}{
+		{SetUnion, ConflictFirst, []string{"/kick.wav /drums", "/snare.wav /drums", "/pad.wav /keys", "/hat.wav /hats"}},
+		{SetUnion, ConflictAll, []string{"/kick.wav /drums", "/snare.wav /drums", "/pad.wav /keys", "/kick.wav /kicks", "/hat.wav /hats"}},
+		{SetUnion, ConflictRoot, []string{"/kick.wav ", "/snare.wav /drums", "/pad.wav /keys", "/hat.wav /hats"}},
+		{SetUnion, ConflictCollection, []string{"/kick.wav /A/drums", "/snare.wav /A/drums", "/pad.wav /A/keys", "/kick.wav /B/kicks", "/snare.wav /B/drums", "/hat.wav /B/hats"}},
+		{SetIntersection, ConflictFirst, []string{"/kick.wav /drums", "/snare.wav /drums"}},
+		{SetIntersection, ConflictAll, []string{"/kick.wav /drums", "/snare.wav /drums", "/kick.wav /kicks"}},
+		{SetIntersection, ConflictRoot, []string{"/kick.wav ", "/snare.wav /drums"}},
+		{SetIntersection, ConflictCollection, []string{"/kick.wav /A/drums", "/snare.wav /A/drums", "/kick.wav /B/kicks", "/snare.wav /B/drums"}},
+		{SetDifference, ConflictFirst, []string{"/pad.wav /keys"}},
+		{SetDifference, ConflictAll, []string{"/pad.wav /keys"}},
+		{SetDifference, ConflictRoot, []string{"/pad.wav /keys"}},
+		{SetDifference, ConflictCollection, []string{"/pad.wav /A/keys"}},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s %s", test.operation, test.conflict), func(t *testing.T) {
+			got := make([]string, 0)
+			for _, tag := range combineTags(test.operation, collections, test.conflict) {
+				got = append(got, tag.FilePath+" "+tag.SubCollection)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// ////////////////////// EDITING COLLECTION TAGS ////////////////////////
+
+// Change what a tagged file is called when its collection is exported
+func (s *Server) RenameCollectionTag(id int, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("a tag needs a name")
+	}
+	old, err := s.getCollectionTagChange(id)
+	if err != nil {
+		return err
+	}
+	if old.Name == name {
+		return nil
+	}
+	change := JournalChange{Kind: changeRenameTag, FilePath: old.FilePath, CollectionId: old.CollectionId, SubCollection: old.SubCollection, From: old.Name, To: name}
+	return s.makeChanges(fmt.Sprintf("rename tag %s to %s", old.Name, name), []JournalChange{change})
+}
+
+// Move a tag to another subcollection of its collection
+func (s *Server) MoveCollectionTag(id int, subCollection string) error {
+	if len(subCollection) > 0 && !strings.HasPrefix(subCollection, "/") {
+		subCollection = "/" + subCollection
+	}
+	old, err := s.getCollectionTagChange(id)
+	if err != nil {
+		return err
+	}
+	if old.SubCollection == subCollection {
+		return nil
+	}
+	if s.findCollectionTagId(old.FilePath, old.CollectionId, subCollection) != -1 {
+		return errors.New(fmt.Sprintf("%s is already in %s", old.Name, subCollection))
+	}
+	change := JournalChange{Kind: changeMoveTag, FilePath: old.FilePath, CollectionId: old.CollectionId, Name: old.Name, From: old.SubCollection, To: subCollection}
+	return s.makeChanges(fmt.Sprintf("move tag %s to %s", old.Name, subCollection), []JournalChange{change})
+}
+
+// Take a tag out of its collection, along with any exports of it
+func (s *Server) RemoveCollectionTag(id int) error {
+	old, err := s.getCollectionTagChange(id)
+	if err != nil {
+		return err
+	}
+	tx, err := s.Db.Begin()
+	if err != nil {
+		log.Fatalf("Failed to begin transaction in removeCollectionTag: %v", err)
+	}
+	removeCollectionTagInTx(tx, old.FilePath, old.CollectionId, old.SubCollection)
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("Failed to commit transaction in removeCollectionTag: %v", err)
+	}
+	s.journal("untag "+old.Name, old)
+	return nil
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+)
+
+// ////////////////////// SAMPLE DETAILS ////////////////////////
+
+// Lines describing everything excavator knows about a sample, for the details pane
+func (s *Server) GetSampleDetails(filePath string) []string {
+	lines := make([]string, 0)
+	var category string
+	var confidence float64
+	row := s.Db.QueryRow(`select category, confidence from Category where file_path = ?`, filePath)
+	if err := row.Scan(&category, &confidence); err == nil {
+		lines = append(lines, fmt.Sprintf("category: %s (%.0f%%)", category, confidence*100))
+	}
+	metadata, err := s.GetMetadata(filePath)
+	if err != nil {
+		log.Printf("Failed to read metadata from %s: %v", filePath, err)
+	}
+	lines = append(lines, metadata.Lines()...)
+	if projects := s.GetSampleProjects(filePath); len(projects) > 0 {
+		lines = append(lines, fmt.Sprintf("used in %d projects:", len(projects)))
+		for _, project := range projects {
+			lines = append(lines, "  "+filepath.Base(project))
+		}
+	}
+	return lines
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path"
+
+	"github.com/jesses-code-adventures/excavator/ableton"
+	"github.com/jesses-code-adventures/excavator/audio"
+)
+
+// ////////////////////// DRUM RACK EXPORTS ////////////////////////
+
+// The pad the first sample of a rack lands on, C1 in Live
+const drumRackFirstNote = 36
+
+// Write a drum rack preset per subcollection referencing the files an export has just written, with a pad per
+// sample in subcollection order. Each preset sits beside its folder, so kicks/ gets kicks.adg.
+func (s *Server) exportDrumRacks(plan exportPlan, profile *ExportProfile, report *ExportReport) {
+	pads := make(map[string][]ableton.DrumPad)
+	order := make([]string, 0)
+	for _, item := range plan.items {
+		frames, format, err := audio.Length(item.destination)
+		if err != nil {
+			// the file failed to export, which has already been reported
+			continue
+		}
+		dir := path.Dir(item.destination)
+		destination := dir + ".adg"
+		if profile != nil {
+			destination = path.Join(path.Dir(dir), profile.FixName(path.Base(destination)))
+		}
+		if _, ok := pads[destination]; !ok {
+			order = append(order, destination)
+		}
+		pads[destination] = append(pads[destination], ableton.NewDrumPad(item.tag.Name(), item.destination, drumRackFirstNote+len(pads[destination]), frames, int(format.SampleRate)))
+	}
+	for _, destination := range order {
+		err := ableton.WriteDrumRack(destination, pads[destination])
+		switch {
+		case errors.Is(err, os.ErrExist):
+			log.Printf("Destination already exists: %s", destination)
+			report.Skipped++
+		case err != nil:
+			report.Fail(destination, err)
+		default:
+			log.Printf("Wrote drum rack %s with %d pads", destination, len(pads[destination]))
+			report.Exported++
+		}
+	}
+}
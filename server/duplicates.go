@@ -0,0 +1,225 @@
+package server
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/jesses-code-adventures/excavator/audio"
+	"github.com/jesses-code-adventures/excavator/core"
+)
+
+// ////////////////////// DUPLICATES ////////////////////////
+
+// Fingerprint every file beneath dir that hasn't been fingerprinted since it last changed
+func (s *Server) IndexFingerprints(dir string) error {
+	files, err := ListAudioFiles(dir)
+	if err != nil {
+		return err
+	}
+	cached, err := s.GetFingerprintModTimes()
+	if err != nil {
+		return err
+	}
+	modTimes := make(map[string]int64)
+	stale := make([]string, 0)
+	for _, file := range files {
+		modTime, err := fileModTime(file)
+		if err != nil {
+			continue
+		}
+		if cachedModTime, ok := cached[file]; ok && cachedModTime == modTime {
+			continue
+		}
+		modTimes[file] = modTime
+		stale = append(stale, file)
+	}
+	log.Printf("fingerprinting %d of %d files in %s", len(stale), len(files), dir)
+	hashes := make(map[string]string)
+	var mu sync.Mutex
+	forEachFileParallel(stale, func(file string) {
+		hash, err := audio.Fingerprint(file)
+		if err != nil {
+			log.Printf("Failed to fingerprint %s: %v", file, err)
+			return
+		}
+		mu.Lock()
+		hashes[file] = hash
+		mu.Unlock()
+	})
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	for file, hash := range hashes {
+		_, err := tx.Exec("insert or replace into Fingerprint (file_path, mod_time, hash) values (?, ?, ?)", file, modTimes[file], hash)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Modification times of every fingerprinted file, keyed by path
+func (s *Server) GetFingerprintModTimes() (map[string]int64, error) {
+	rows, err := s.Db.Query(`select file_path, mod_time from Fingerprint`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	modTimes := make(map[string]int64)
+	for rows.Next() {
+		var filePath string
+		var modTime int64
+		if err := rows.Scan(&filePath, &modTime); err != nil {
+			return nil, err
+		}
+		modTimes[filePath] = modTime
+	}
+	return modTimes, rows.Err()
+}
+
+// Get the stored fingerprint of a file, or an empty string if it hasn't been indexed
+func (s *Server) GetFingerprint(filePath string) string {
+	row := s.Db.QueryRow(`select hash from Fingerprint where file_path = ?`, filePath)
+	var hash string
+	if err := row.Scan(&hash); err != nil {
+		return ""
+	}
+	return hash
+}
+
+// Get all files beneath the root which share their audio with another file, grouped by fingerprint
+func (s *Server) GetDuplicates() []core.SelectableListItem {
+	// copies passed over in favour of another stay resolved until their audio changes
+	statement := `select f.hash, f.file_path from Fingerprint f
+left join ResolvedDuplicate r on r.file_path = f.file_path and r.hash = f.hash
+where r.id is null and f.hash in (select hash from Fingerprint group by hash having count(*) > 1)
+order by f.hash asc, f.file_path asc`
+	rows, err := s.Db.Query(statement)
+	if err != nil {
+		log.Fatalf("Failed to execute SQL statement in getDuplicates: %v", err)
+	}
+	defer rows.Close()
+	groups := make([][]string, 0)
+	hashes := make([]string, 0)
+	for rows.Next() {
+		var hash, filePath string
+		if err := rows.Scan(&hash, &filePath); err != nil {
+			log.Fatalf("Failed to scan row in getDuplicates: %v", err)
+		}
+		if !strings.HasPrefix(filePath, s.State.Root) {
+			continue
+		}
+		if _, err := os.Stat(filePath); err != nil {
+			continue
+		}
+		if len(hashes) == 0 || hashes[len(hashes)-1] != hash {
+			hashes = append(hashes, hash)
+			groups = append(groups, make([]string, 0))
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], filePath)
+	}
+	duplicates := make([]core.SelectableListItem, 0)
+	group := 0
+	for i, files := range groups {
+		if len(files) < 2 {
+			continue
+		}
+		group++
+		for _, file := range files {
+			display, err := filepath.Rel(s.State.Root, file)
+			if err != nil {
+				display = file
+			}
+			duplicates = append(duplicates, core.NewDuplicate(file, hashes[i], group, len(files), display))
+		}
+	}
+	return duplicates
+}
+
+// Keep one copy of a duplicated sound, pointing every tag of the other copies at it. The other copies are left on
+// disk and marked resolved, so they're no longer listed as duplicates.
+func (s *Server) KeepDuplicate(survivor string) error {
+	hash := s.GetFingerprint(survivor)
+	if hash == "" {
+		return nil
+	}
+	rows, err := s.Db.Query(`select file_path from Fingerprint where hash = ? and file_path != ?`, hash, survivor)
+	if err != nil {
+		return err
+	}
+	others := make([]string, 0)
+	for rows.Next() {
+		var filePath string
+		if err := rows.Scan(&filePath); err != nil {
+			rows.Close()
+			return err
+		}
+		others = append(others, filePath)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	// the survivor may have been passed over before, and is a live copy again now
+	if _, err := tx.Exec(`delete from ResolvedDuplicate where file_path = ?`, survivor); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, other := range others {
+		if err := repointTagInTx(tx, other, survivor); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec(`insert or replace into ResolvedDuplicate (file_path, hash) values (?, ?)`, other, hash); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Move every collection tag for one file onto another. If the target is already tagged, the two
+// tags are merged and collection tags that would collide with an existing one are dropped.
+func repointTagInTx(tx *sql.Tx, from string, to string) error {
+	var fromId int
+	if err := tx.QueryRow(`select id from Tag where file_path = ?`, from).Scan(&fromId); err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return err
+	}
+	var toId int
+	err := tx.QueryRow(`select id from Tag where file_path = ?`, to).Scan(&toId)
+	if err == sql.ErrNoRows {
+		_, err = tx.Exec(`update Tag set file_path = ? where id = ?`, to, fromId)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	statements := []string{
+		`update or ignore CollectionTag set tag_id = ? where tag_id = ?`,
+		`delete from ExportTag where collection_tag_id in (select id from CollectionTag where tag_id = ?)`,
+		`delete from CollectionTag where tag_id = ?`,
+		`delete from Tag where id = ?`,
+	}
+	if _, err := tx.Exec(statements[0], toId, fromId); err != nil {
+		return err
+	}
+	for _, statement := range statements[1:] {
+		if _, err := tx.Exec(statement, fromId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
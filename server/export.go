@@ -0,0 +1,111 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/jesses-code-adventures/excavator/audio"
+	"github.com/jesses-code-adventures/excavator/core"
+)
+
+// ////////////////////// EXPORT HELPERS ////////////////////////
+
+// What happened to each file in an export run
+type ExportReport struct {
+	Exported int
+	Skipped  int
+	Failures []ExportFailure
+	Fixes    []string // names changed to suit the export's profile
+	Problems []string // reasons the export didn't write anything
+}
+
+// A source file that couldn't be exported
+type ExportFailure struct {
+	Path string
+	Err  error
+}
+
+func NewExportReport() ExportReport {
+	return ExportReport{Failures: make([]ExportFailure, 0), Fixes: make([]string, 0), Problems: make([]string, 0)}
+}
+
+// Record a file that couldn't be exported
+func (r *ExportReport) Fail(path string, err error) {
+	log.Printf("Failed to export %s: %v", path, err)
+	r.Failures = append(r.Failures, ExportFailure{Path: path, Err: err})
+}
+
+// A one line summary, e.g. "12 exported, 1 skipped, 2 failed, 3 renamed"
+func (r ExportReport) String() string {
+	if len(r.Problems) > 0 {
+		return fmt.Sprintf("nothing written, %d problems: %s", len(r.Problems), r.Problems[0])
+	}
+	summary := fmt.Sprintf("%d exported, %d skipped, %d failed", r.Exported, r.Skipped, len(r.Failures))
+	if len(r.Fixes) > 0 {
+		summary += fmt.Sprintf(", %d renamed", len(r.Fixes))
+	}
+	return summary
+}
+
+// Create the destination's directory and write one file into it. Returns os.ErrExist if the destination is already there.
+func exportFile(source string, destination string, copyFn func(source string, destination string) error) error {
+	if _, err := os.Stat(source); err != nil {
+		return errors.New(fmt.Sprintf("source doesn't exist: %v", err))
+	}
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(destination); err == nil {
+		return os.ErrExist
+	}
+	return copyFn(source, destination)
+}
+
+// Copy a file's contents to a new file, used where an export must not share data with the original
+func copyFile(source string, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Everything excavator knows about a collection tag, for writing into an exported copy
+func (s *Server) GetExportMetadata(tag core.CollectionTag) audio.ExportMetadata {
+	metadata := audio.ExportMetadata{
+		Name:          tag.Name(),
+		Collection:    tag.CollectionName,
+		SubCollection: tag.SubCollection,
+		Category:      s.GetCategory(tag.FilePath),
+	}
+	if s.User.TargetCollection != nil && s.User.TargetCollection.Name() == tag.CollectionName {
+		metadata.Notes = s.User.TargetCollection.Description()
+	}
+	embedded, err := s.GetMetadata(tag.FilePath)
+	if err != nil {
+		log.Printf("Failed to read metadata from %s: %v", tag.FilePath, err)
+	}
+	metadata.Tempo = embedded.Tempo
+	metadata.Key = embedded.Key
+	if embedded.Key == "" && embedded.RootNote >= 0 {
+		metadata.Key = audio.NoteName(embedded.RootNote)
+	}
+	return metadata
+}
@@ -22,6 +22,22 @@ func ContainsAllSubstrings(s1 string, s2 string) bool {
 	return true
 }
 
+// A test for whether an audio file matches a search, given what's known about the files being searched. Words are
+// matched against the file name and its metadata, and filters such as "cat:kick" and "used:no" are understood.
+func searchMatcher(search string, categories map[string]string, usage map[string]int, metadataText map[string]string) func(p string) bool {
+	search, category := SplitCategorySearch(search)
+	search, usageFilter := SplitUsageSearch(search)
+	return func(p string) bool {
+		if category != "" && categories[p] != category {
+			return false
+		}
+		if usageFilter != nil && !usageFilter(usage[p]) {
+			return false
+		}
+		return ContainsAllSubstrings(path.Base(p), search) || ContainsAllSubstrings(metadataText[p], search)
+	}
+}
+
 // Standard function for getting the necessary files from a dir with their associated tags
 func (s *Server) FuzzyFind(search string, fromRoot bool) {
 	var dir string
@@ -34,22 +50,35 @@ func (s *Server) FuzzyFind(search string, fromRoot bool) {
 	} else {
 		dir = s.State.Dir
 	}
-	collectionTags := s.FuzzyFindCollectionTags(search)
+	categories := s.GetDirectoryCategories(dir)
+	usage := s.GetDirectoryUsage(dir)
+	matches := searchMatcher(search, categories, usage, s.GetDirectoryMetadataText(dir))
+	search, _ = SplitCategorySearch(search)
+	search, _ = SplitUsageSearch(search)
+	var collectionTags []core.CollectionTag
+	if len(search) == 0 {
+		collectionTags = s.GetDirectoryTags(dir)
+	} else {
+		collectionTags = s.FuzzyFindCollectionTags(search)
+	}
 	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if !ContainsAllSubstrings(path.Base(p), search) || strings.HasPrefix(p, ".") || strings.HasSuffix(p, ".asd") || strings.HasSuffix(p, ".nki") {
+		if d.IsDir() || !matches(p) || strings.HasPrefix(p, ".") || strings.HasSuffix(p, ".asd") || strings.HasSuffix(p, ".nki") {
 			return nil
 		}
-		if (strings.HasSuffix(p, ".wav") || strings.HasSuffix(p, ".mp3") || strings.HasSuffix(p, ".flac")) && !d.IsDir() {
+		if strings.HasSuffix(p, ".wav") || strings.HasSuffix(p, ".mp3") || strings.HasSuffix(p, ".flac") {
 			matchedTags := make([]core.CollectionTag, 0)
 			for _, tag := range collectionTags {
 				if strings.Contains(tag.FilePath, p) {
 					matchedTags = append(matchedTags, tag)
 				}
 			}
-			s.State.pushChoice(core.NewTaggedDirEntry(p, matchedTags, false))
+			entry := core.NewTaggedDirEntry(p, matchedTags, false)
+			entry.Category = categories[p]
+			entry.Projects = usage[p]
+			s.State.pushChoice(entry)
 		}
 		return nil
 	})
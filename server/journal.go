@@ -0,0 +1,257 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jesses-code-adventures/excavator/core"
+)
+
+// ////////////////////// UNDO JOURNAL ////////////////////////
+
+// The kinds of change the journal knows how to undo
+const (
+	changeTag                = "tag"                 // a file added to a collection
+	changeUntag              = "untag"               // a file taken out of a collection
+	changeCreateCollection   = "create collection"   // a collection made, with nothing in it yet
+	changeDeleteCollection   = "delete collection"   // a collection removed
+	changeRenameCollection   = "rename collection"   // From and To are the old and new names
+	changeDescribeCollection = "describe collection" // From and To are the old and new descriptions
+	changeSubCollection      = "subcollection"       // the target subcollection, From and To are the old and new values
+	changeRenameTag          = "rename tag"          // a tag's name, From and To are the old and new names
+	changeMoveTag            = "move tag"            // a tag's subcollection within its collection, From and To are the old and new values
+	changeMove               = "move"                // a file or directory moved on disk, From and To are paths
+)
+
+// How many entries are kept, the oldest are forgotten beyond this
+const journalLength = 500
+
+// One change to the database or the files beneath the root, with enough detail to make it again or reverse it
+type JournalChange struct {
+	Kind          string `json:"kind"`
+	FilePath      string `json:"file_path,omitempty"`
+	CollectionId  int    `json:"collection_id,omitempty"`
+	Name          string `json:"name,omitempty"`
+	SubCollection string `json:"sub_collection,omitempty"`
+	Description   string `json:"description,omitempty"`
+	From          string `json:"from,omitempty"`
+	To            string `json:"to,omitempty"`
+}
+
+// A file added to a collection
+func tagChange(filePath string, collectionId int, name string, subCollection string) JournalChange {
+	return JournalChange{Kind: changeTag, FilePath: filePath, CollectionId: collectionId, Name: name, SubCollection: subCollection}
+}
+
+// The change that reverses this one
+func (c JournalChange) inverse() JournalChange {
+	switch c.Kind {
+	case changeTag:
+		c.Kind = changeUntag
+	case changeUntag:
+		c.Kind = changeTag
+	case changeCreateCollection:
+		c.Kind = changeDeleteCollection
+	case changeDeleteCollection:
+		c.Kind = changeCreateCollection
+	default:
+		c.From, c.To = c.To, c.From
+	}
+	return c
+}
+
+// Record something the user did so it can be undone. Anything undone since the last change can no longer be
+// redone, as history has moved on.
+func (s *Server) journal(description string, changes ...JournalChange) {
+	if len(changes) == 0 {
+		return
+	}
+	encoded, err := json.Marshal(changes)
+	if err != nil {
+		log.Fatalf("Failed to encode journal changes: %v", err)
+	}
+	tx, err := s.Db.Begin()
+	if err != nil {
+		log.Fatalf("Failed to begin transaction in journal: %v", err)
+	}
+	statements := []struct {
+		statement string
+		args      []any
+	}{
+		{`delete from Journal where user_id = ? and undone = 1`, []any{s.User.Id}},
+		{`insert into Journal (user_id, created, description, changes) values (?, ?, ?, ?)`, []any{s.User.Id, time.Now().Unix(), description, string(encoded)}},
+		{`delete from Journal where user_id = ? and id not in (select id from Journal where user_id = ? order by id desc limit ?)`, []any{s.User.Id, s.User.Id, journalLength}},
+	}
+	for _, st := range statements {
+		if _, err := tx.Exec(st.statement, st.args...); err != nil {
+			tx.Rollback()
+			log.Fatalf("Failed to execute SQL statement in journal: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("Failed to commit transaction in journal: %v", err)
+	}
+}
+
+// Take a file out of a collection's subcollection, along with any exports of it
+func removeCollectionTagInTx(tx *sql.Tx, filePath string, collectionId int, subCollection string) {
+	tagged := `select ct.id from CollectionTag ct join Tag t on ct.tag_id = t.id
+where t.file_path = ? and ct.collection_id = ? and ct.sub_collection = ?`
+	for _, statement := range []string{
+		`delete from ExportTag where collection_tag_id in (` + tagged + `)`,
+		`delete from CollectionTag where id in (` + tagged + `)`,
+	} {
+		if _, err := tx.Exec(statement, filePath, collectionId, subCollection); err != nil {
+			tx.Rollback()
+			log.Fatalf("Failed to execute SQL statement in removeCollectionTagInTx: %v", err)
+		}
+	}
+}
+
+// Make a change recorded in the journal. Moves are left to the caller, as they happen outside the transaction.
+func (s *Server) applyChangeInTx(tx *sql.Tx, c JournalChange) {
+	var statements []string
+	var args []any
+	switch c.Kind {
+	case changeTag:
+		addCollectionTagInTx(tx, s.User.Id, c.FilePath, c.CollectionId, c.Name, c.SubCollection)
+		return
+	case changeUntag:
+		removeCollectionTagInTx(tx, c.FilePath, c.CollectionId, c.SubCollection)
+		return
+	case changeCreateCollection:
+		// the original id is kept so later entries still point at it
+		statements, args = []string{`insert or ignore into Collection (id, user_id, name, description) values (?, ?, ?, ?)`}, []any{c.CollectionId, s.User.Id, c.Name, c.Description}
+	case changeDeleteCollection:
+		// anything still in the collection goes with it, though the entry that deleted it will have untagged it first
+		statements = []string{
+			`delete from ExportTag where collection_tag_id in (select id from CollectionTag where collection_id = ?)`,
+			`delete from CollectionTag where collection_id = ?`,
+			`delete from Kit where collection_id = ?`,
+			`update User set selected_collection = null where selected_collection = ?`,
+			`delete from Collection where id = ?`,
+		}
+		args = []any{c.CollectionId}
+	case changeRenameCollection:
+		statements, args = []string{`update Collection set name = ? where id = ?`}, []any{c.To, c.CollectionId}
+	case changeDescribeCollection:
+		statements, args = []string{`update Collection set description = ? where id = ?`}, []any{c.To, c.CollectionId}
+	case changeSubCollection:
+		statements, args = []string{`update User set selected_subcollection = ? where id = ?`}, []any{c.To, s.User.Id}
+	case changeRenameTag:
+		// tags are found by what they tag rather than their id, which changes if an untag is undone
+		statements = []string{`update CollectionTag set name = ? where collection_id = ? and sub_collection = ?
+and tag_id in (select id from Tag where file_path = ?)`}
+		args = []any{c.To, c.CollectionId, c.SubCollection, c.FilePath}
+	case changeMoveTag:
+		statements = []string{`update CollectionTag set sub_collection = ? where collection_id = ? and sub_collection = ?
+and tag_id in (select id from Tag where file_path = ?)`}
+		args = []any{c.To, c.CollectionId, c.From, c.FilePath}
+	default:
+		log.Printf("Unknown journal change %s", c.Kind)
+		return
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, args...); err != nil {
+			tx.Rollback()
+			log.Fatalf("Failed to execute SQL statement in applyChangeInTx: %v", err)
+		}
+	}
+}
+
+// Make a list of changes in order, the database ones in one transaction and then any moves
+func (s *Server) applyChanges(changes []JournalChange) error {
+	moves := make([]core.RenamePlan, 0)
+	tx, err := s.Db.Begin()
+	if err != nil {
+		log.Fatalf("Failed to begin transaction in applyChanges: %v", err)
+	}
+	for _, c := range changes {
+		if c.Kind == changeMove {
+			moves = append(moves, core.RenamePlan{From: c.From, To: c.To})
+		} else {
+			s.applyChangeInTx(tx, c)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("Failed to commit transaction in applyChanges: %v", err)
+	}
+	// the target collection or subcollection may have changed underneath the user
+	s.User = s.GetUser(s.User.Id)
+	if len(moves) > 0 {
+		result := BatchRename{}
+		s.applyRenames(moves, &result)
+		if result.Failed > 0 {
+			return errors.New(fmt.Sprintf("%d of %d files couldn't be moved", result.Failed, len(moves)))
+		}
+	}
+	return nil
+}
+
+// Make a list of changes and record them in the journal as one entry
+func (s *Server) makeChanges(description string, changes []JournalChange) error {
+	err := s.applyChanges(changes)
+	s.journal(description, changes...)
+	return err
+}
+
+// Step through the journal. Undoing reverses the most recent entry that's still in effect, redoing makes the
+// earliest undone entry again.
+func (s *Server) stepJournal(undo bool) (string, error) {
+	statement := `select id, description, changes from Journal where user_id = ? and undone = 1 order by id asc limit 1`
+	if undo {
+		statement = `select id, description, changes from Journal where user_id = ? and undone = 0 order by id desc limit 1`
+	}
+	var id int
+	var description string
+	var encoded string
+	if err := s.Db.QueryRow(statement, s.User.Id).Scan(&id, &description, &encoded); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			if undo {
+				return "", errors.New("nothing to undo")
+			}
+			return "", errors.New("nothing to redo")
+		}
+		log.Fatalf("Failed to scan row in stepJournal: %v", err)
+	}
+	var changes []JournalChange
+	if err := json.Unmarshal([]byte(encoded), &changes); err != nil {
+		return description, err
+	}
+	if undo {
+		reversed := make([]JournalChange, 0, len(changes))
+		for i := len(changes) - 1; i >= 0; i-- {
+			reversed = append(reversed, changes[i].inverse())
+		}
+		changes = reversed
+	}
+	// the entry moves even if a file couldn't, so the journal can't get stuck on it
+	err := s.applyChanges(changes)
+	if _, dbErr := s.Db.Exec(`update Journal set undone = ? where id = ?`, undo, id); dbErr != nil {
+		log.Fatalf("Failed to execute SQL statement in stepJournal: %v", dbErr)
+	}
+	return description, err
+}
+
+// Reverse the most recent change, returning what it was
+func (s *Server) Undo() (string, error) {
+	return s.stepJournal(true)
+}
+
+// Make the most recently undone change again, returning what it was
+func (s *Server) Redo() (string, error) {
+	return s.stepJournal(false)
+}
+
+// The details of a collection tag, for recording its removal
+func (s *Server) getCollectionTagChange(id int) (JournalChange, error) {
+	statement := `select t.file_path, ct.collection_id, ct.name, ct.sub_collection from CollectionTag ct
+join Tag t on ct.tag_id = t.id where ct.id = ?`
+	change := JournalChange{Kind: changeUntag}
+	err := s.Db.QueryRow(statement, id).Scan(&change.FilePath, &change.CollectionId, &change.Name, &change.SubCollection)
+	return change, err
+}
@@ -0,0 +1,319 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/jesses-code-adventures/excavator/core"
+)
+
+// ////////////////////// RANDOM KITS ////////////////////////
+
+// How generating or re-rolling a kit went
+type KitResult struct {
+	Id    int
+	Name  string
+	Drawn int
+	Short []string // subcollections that couldn't be filled
+}
+
+func (k KitResult) String() string {
+	if len(k.Short) > 0 {
+		return fmt.Sprintf("%s: %d drawn, not enough for %s", k.Name, k.Drawn, strings.Join(k.Short, ", "))
+	}
+	return fmt.Sprintf("%s: %d drawn", k.Name, k.Drawn)
+}
+
+// Get the current user's recipes
+func (s *Server) GetRecipes() []core.Recipe {
+	rows, err := s.Db.Query(`select id, name from Recipe where user_id = ? order by name asc`, s.User.Id)
+	if err != nil {
+		log.Fatalf("Failed to execute SQL statement in getRecipes: %v", err)
+	}
+	recipes := make([]core.Recipe, 0)
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			log.Fatalf("Failed to scan row in getRecipes: %v", err)
+		}
+		recipes = append(recipes, core.NewRecipe(id, name, nil))
+	}
+	rows.Close()
+	for i, recipe := range recipes {
+		recipes[i].Rules = s.getRecipeRules(recipe.Id())
+	}
+	return recipes
+}
+
+// Get a recipe's rules in order
+func (s *Server) getRecipeRules(recipeId int) []core.KitRule {
+	rows, err := s.Db.Query(`select count, source, value, sub_collection from RecipeRule where recipe_id = ? order by position asc`, recipeId)
+	if err != nil {
+		log.Fatalf("Failed to execute SQL statement in getRecipeRules: %v", err)
+	}
+	defer rows.Close()
+	rules := make([]core.KitRule, 0)
+	for rows.Next() {
+		var rule core.KitRule
+		if err := rows.Scan(&rule.Count, &rule.Source, &rule.Value, &rule.SubCollection); err != nil {
+			log.Fatalf("Failed to scan row in getRecipeRules: %v", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// Get one of the current user's recipes
+func (s *Server) getRecipe(id int) (core.Recipe, error) {
+	var name string
+	err := s.Db.QueryRow(`select name from Recipe where id = ? and user_id = ?`, id, s.User.Id).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return core.Recipe{}, errors.New("that recipe no longer exists")
+	} else if err != nil {
+		log.Fatalf("Failed to scan row in getRecipe: %v", err)
+	}
+	return core.NewRecipe(id, name, s.getRecipeRules(id)), nil
+}
+
+// Save a recipe from its name and rules, creating it when id is 0. Returns the recipe's id.
+func (s *Server) SaveRecipe(id int, name string, rulesText string) (int, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return id, errors.New("a recipe needs a name")
+	}
+	rules, err := core.ParseKitRules(rulesText)
+	if err != nil {
+		return id, err
+	}
+	var existing int
+	err = s.Db.QueryRow(`select id from Recipe where user_id = ? and name = ?`, s.User.Id, name).Scan(&existing)
+	if err == nil && existing != id {
+		return id, errors.New(fmt.Sprintf("there's already a recipe called %s", name))
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Fatalf("Failed to scan row in saveRecipe: %v", err)
+	}
+	tx, err := s.Db.Begin()
+	if err != nil {
+		log.Fatalf("Failed to begin transaction in saveRecipe: %v", err)
+	}
+	if id == 0 {
+		res, err := tx.Exec(`insert into Recipe (user_id, name) values (?, ?)`, s.User.Id, name)
+		if err != nil {
+			tx.Rollback()
+			log.Fatalf("Failed to execute SQL statement in saveRecipe: %v", err)
+		}
+		newId, err := res.LastInsertId()
+		if err != nil {
+			tx.Rollback()
+			log.Fatalf("Failed to get last insert ID: %v", err)
+		}
+		id = int(newId)
+	} else {
+		statements := []struct {
+			statement string
+			args      []any
+		}{
+			{`update Recipe set name = ? where id = ?`, []any{name, id}},
+			{`delete from RecipeRule where recipe_id = ?`, []any{id}},
+		}
+		for _, st := range statements {
+			if _, err := tx.Exec(st.statement, st.args...); err != nil {
+				tx.Rollback()
+				log.Fatalf("Failed to execute SQL statement in saveRecipe: %v", err)
+			}
+		}
+	}
+	for i, rule := range rules {
+		if _, err := tx.Exec(`insert into RecipeRule (recipe_id, position, count, source, value, sub_collection) values (?, ?, ?, ?, ?, ?)`, id, i, rule.Count, rule.Source, rule.Value, rule.SubCollection); err != nil {
+			tx.Rollback()
+			log.Fatalf("Failed to execute SQL statement in saveRecipe: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("Failed to commit transaction in saveRecipe: %v", err)
+	}
+	return id, nil
+}
+
+// Delete a recipe. Kits made from it stay, but can no longer be re-rolled.
+func (s *Server) DeleteRecipe(id int) {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		log.Fatalf("Failed to begin transaction in deleteRecipe: %v", err)
+	}
+	for _, statement := range []string{
+		`delete from RecipeRule where recipe_id = ?`,
+		`delete from Kit where recipe_id = ?`,
+		`delete from Recipe where id = ?`,
+	} {
+		if _, err := tx.Exec(statement, id); err != nil {
+			tx.Rollback()
+			log.Fatalf("Failed to execute SQL statement in deleteRecipe: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("Failed to commit transaction in deleteRecipe: %v", err)
+	}
+}
+
+// Every file a rule could draw
+func (s *Server) kitCandidates(rule core.KitRule) ([]string, error) {
+	switch rule.Source {
+	case core.KitFromDir:
+		dir := core.ExpandPath(rule.Value)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(s.State.Root, dir)
+		}
+		if !s.isInRoot(dir) {
+			return nil, errors.New(fmt.Sprintf("%s isn't beneath the root", rule.Value))
+		}
+		return ListAudioFiles(dir)
+	case core.KitFromCollection:
+		collection, err := s.FindCollection(rule.Value)
+		if err != nil {
+			return nil, err
+		}
+		files := make([]string, 0)
+		seen := make(map[string]bool)
+		for _, tag := range s.GetCollectionTags(collection.Id()) {
+			if !seen[tag.FilePath] {
+				seen[tag.FilePath] = true
+				files = append(files, tag.FilePath)
+			}
+		}
+		return files, nil
+	}
+	files, err := ListAudioFiles(s.State.Root)
+	if err != nil {
+		return nil, err
+	}
+	matches := searchMatcher(rule.Value, s.GetDirectoryCategories(s.State.Root), s.GetDirectoryUsage(s.State.Root), s.GetDirectoryMetadataText(s.State.Root))
+	matched := make([]string, 0)
+	for _, file := range files {
+		if matches(file) {
+			matched = append(matched, file)
+		}
+	}
+	return matched, nil
+}
+
+// Draw a rule's samples at random, leaving out anything already drawn. Fewer come back when there aren't enough.
+func (s *Server) drawKitSlot(rule core.KitRule, drawn map[string]bool) ([]string, error) {
+	candidates, err := s.kitCandidates(rule)
+	if err != nil {
+		return nil, err
+	}
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	picked := make([]string, 0, rule.Count)
+	for _, candidate := range candidates {
+		if len(picked) == rule.Count {
+			break
+		}
+		if !drawn[candidate] {
+			drawn[candidate] = true
+			picked = append(picked, candidate)
+		}
+	}
+	return picked, nil
+}
+
+// Draw a new kit from a recipe into a new collection, each rule filling its own subcollection
+func (s *Server) GenerateKit(recipeId int) (KitResult, error) {
+	result := KitResult{}
+	recipe, err := s.getRecipe(recipeId)
+	if err != nil {
+		return result, err
+	}
+	drawn := make(map[string]bool)
+	changes := make([]JournalChange, 0)
+	for _, rule := range recipe.Rules {
+		picked, err := s.drawKitSlot(rule, drawn)
+		if err != nil {
+			return result, err
+		}
+		if len(picked) < rule.Count {
+			result.Short = append(result.Short, rule.SubCollection)
+		}
+		for _, file := range picked {
+			changes = append(changes, tagChange(file, 0, path.Base(file), rule.SubCollection))
+		}
+	}
+	if len(changes) == 0 {
+		return result, errors.New(fmt.Sprintf("nothing matches the rules in %s", recipe.Name()))
+	}
+	result.Name = recipe.Name() + " kit"
+	for i := 2; s.getCollectionIdByName(result.Name) != 0; i++ {
+		result.Name = fmt.Sprintf("%s kit %d", recipe.Name(), i)
+	}
+	description := "drawn from the recipe " + recipe.Name()
+	result.Id = s.createCollection(result.Name, description)
+	if _, err := s.Db.Exec(`insert into Kit (collection_id, recipe_id) values (?, ?)`, result.Id, recipeId); err != nil {
+		log.Fatalf("Failed to execute SQL statement in generateKit: %v", err)
+	}
+	for i := range changes {
+		changes[i].CollectionId = result.Id
+	}
+	result.Drawn = len(changes)
+	changes = append([]JournalChange{{Kind: changeCreateCollection, CollectionId: result.Id, Name: result.Name, Description: description}}, changes...)
+	return result, s.makeChanges("generate kit "+result.Name, changes)
+}
+
+// Draw a kit's subcollection again from its rule, keeping the rest of the kit. Nothing already in the kit is drawn.
+func (s *Server) RerollKitSlot(collectionId int, subCollection string) (KitResult, error) {
+	result := KitResult{Id: collectionId}
+	collection, err := s.getCollectionMetadata(collectionId)
+	if err != nil {
+		return result, err
+	}
+	result.Name = collection.Name() + " " + subCollection
+	var recipeId int
+	if err := s.Db.QueryRow(`select recipe_id from Kit where collection_id = ?`, collectionId).Scan(&recipeId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return result, errors.New(fmt.Sprintf("%s wasn't drawn from a recipe", collection.Name()))
+		}
+		log.Fatalf("Failed to scan row in rerollKitSlot: %v", err)
+	}
+	recipe, err := s.getRecipe(recipeId)
+	if err != nil {
+		return result, err
+	}
+	var rule *core.KitRule
+	for i := range recipe.Rules {
+		if recipe.Rules[i].SubCollection == subCollection {
+			rule = &recipe.Rules[i]
+		}
+	}
+	if rule == nil {
+		return result, errors.New(fmt.Sprintf("%s has no rule for %s", recipe.Name(), subCollection))
+	}
+	drawn := make(map[string]bool)
+	changes := make([]JournalChange, 0)
+	for _, tag := range s.GetCollectionTags(collectionId) {
+		drawn[tag.FilePath] = true
+		if tag.SubCollection == subCollection {
+			changes = append(changes, tagChange(tag.FilePath, collectionId, tag.Name(), subCollection).inverse())
+		}
+	}
+	picked, err := s.drawKitSlot(*rule, drawn)
+	if err != nil {
+		return result, err
+	}
+	if len(picked) == 0 {
+		return result, errors.New(fmt.Sprintf("nothing else matches %s", rule.Value))
+	}
+	if len(picked) < rule.Count {
+		result.Short = append(result.Short, subCollection)
+	}
+	for _, file := range picked {
+		changes = append(changes, tagChange(file, collectionId, path.Base(file), subCollection))
+	}
+	result.Drawn = len(picked)
+	return result, s.makeChanges("re-roll "+result.Name, changes)
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jesses-code-adventures/excavator/core"
+)
+
+// ////////////////////// MANAGING COLLECTIONS ////////////////////////
+
+// How a merge went
+type CollectionMerge struct {
+	Added   int
+	Skipped int // already in the collection merged into
+}
+
+func (m CollectionMerge) String() string {
+	if m.Skipped > 0 {
+		return fmt.Sprintf("%d added, %d already there", m.Added, m.Skipped)
+	}
+	return fmt.Sprintf("%d added", m.Added)
+}
+
+// Get a collection's name and description
+func (s *Server) getCollectionMetadata(id int) (core.CollectionMetadata, error) {
+	var name string
+	var description sql.NullString
+	err := s.Db.QueryRow(`select name, description from Collection where id = ? and user_id = ?`, id, s.User.Id).Scan(&name, &description)
+	if errors.Is(err, sql.ErrNoRows) {
+		return core.CollectionMetadata{}, errors.New("that collection no longer exists")
+	} else if err != nil {
+		log.Fatalf("Failed to scan row in getCollectionMetadata: %v", err)
+	}
+	return core.NewCollection(id, name, description.String), nil
+}
+
+// Check a name can be given to a collection
+func (s *Server) validCollectionName(id int, name string) error {
+	if name == "" {
+		return errors.New("a collection needs a name")
+	}
+	if existing := s.getCollectionIdByName(name); existing != 0 && existing != id {
+		return errors.New(fmt.Sprintf("there's already a collection called %s", name))
+	}
+	return nil
+}
+
+// The changes that would tag everything in one collection into another
+func (s *Server) copyTagChanges(fromId int, toId int) []JournalChange {
+	changes := make([]JournalChange, 0)
+	for _, tag := range s.GetCollectionTags(fromId) {
+		changes = append(changes, tagChange(tag.FilePath, toId, tag.Name(), tag.SubCollection))
+	}
+	return changes
+}
+
+// The changes that would take everything out of a collection
+func (s *Server) clearTagChanges(id int) []JournalChange {
+	changes := s.copyTagChanges(id, id)
+	for i := range changes {
+		changes[i] = changes[i].inverse()
+	}
+	return changes
+}
+
+// Rename a collection
+func (s *Server) RenameCollection(id int, name string) error {
+	name = strings.TrimSpace(name)
+	collection, err := s.getCollectionMetadata(id)
+	if err != nil {
+		return err
+	}
+	if name == collection.Name() {
+		return nil
+	}
+	if err := s.validCollectionName(id, name); err != nil {
+		return err
+	}
+	change := JournalChange{Kind: changeRenameCollection, CollectionId: id, From: collection.Name(), To: name}
+	return s.makeChanges(fmt.Sprintf("rename collection %s to %s", collection.Name(), name), []JournalChange{change})
+}
+
+// Change a collection's description
+func (s *Server) DescribeCollection(id int, description string) error {
+	collection, err := s.getCollectionMetadata(id)
+	if err != nil {
+		return err
+	}
+	if description == collection.Description() {
+		return nil
+	}
+	change := JournalChange{Kind: changeDescribeCollection, CollectionId: id, From: collection.Description(), To: description}
+	return s.makeChanges("describe collection "+collection.Name(), []JournalChange{change})
+}
+
+// Make a new collection holding everything in another, returning its id
+func (s *Server) DuplicateCollection(id int, name string) (int, error) {
+	name = strings.TrimSpace(name)
+	collection, err := s.getCollectionMetadata(id)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.validCollectionName(0, name); err != nil {
+		return 0, err
+	}
+	newId := s.createCollection(name, collection.Description())
+	changes := append([]JournalChange{{Kind: changeCreateCollection, CollectionId: newId, Name: name, Description: collection.Description()}}, s.copyTagChanges(id, newId)...)
+	return newId, s.makeChanges(fmt.Sprintf("duplicate collection %s as %s", collection.Name(), name), changes)
+}
+
+// Move everything in one collection into another and delete the emptied collection. Tags already in the other
+// collection's same subcollection are left as they are.
+func (s *Server) MergeCollection(fromId int, intoId int) (CollectionMerge, error) {
+	result := CollectionMerge{}
+	if fromId == intoId {
+		return result, errors.New("a collection can't be merged into itself")
+	}
+	from, err := s.getCollectionMetadata(fromId)
+	if err != nil {
+		return result, err
+	}
+	into, err := s.getCollectionMetadata(intoId)
+	if err != nil {
+		return result, err
+	}
+	changes := make([]JournalChange, 0)
+	for _, change := range s.copyTagChanges(fromId, intoId) {
+		if s.findCollectionTagId(change.FilePath, intoId, change.SubCollection) != -1 {
+			result.Skipped++
+			continue
+		}
+		changes = append(changes, change)
+		result.Added++
+	}
+	changes = append(changes, s.clearTagChanges(fromId)...)
+	changes = append(changes, JournalChange{Kind: changeDeleteCollection, CollectionId: fromId, Name: from.Name(), Description: from.Description()})
+	return result, s.makeChanges(fmt.Sprintf("merge collection %s into %s", from.Name(), into.Name()), changes)
+}
+
+// Delete a collection along with everything tagged in it and any exports of its tags. It stops being the target
+// collection if it was.
+func (s *Server) DeleteCollection(id int) error {
+	collection, err := s.getCollectionMetadata(id)
+	if err != nil {
+		return err
+	}
+	changes := append(s.clearTagChanges(id), JournalChange{Kind: changeDeleteCollection, CollectionId: id, Name: collection.Name(), Description: collection.Description()})
+	return s.makeChanges("delete collection "+collection.Name(), changes)
+}
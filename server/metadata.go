@@ -0,0 +1,148 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/jesses-code-adventures/excavator/audio"
+)
+
+// ////////////////////// EMBEDDED METADATA ////////////////////////
+
+// Get the embedded metadata of a file, reading it only if the cached result is missing or stale
+func (s *Server) GetMetadata(filePath string) (audio.Metadata, error) {
+	modTime, err := fileModTime(filePath)
+	if err != nil {
+		return audio.NewMetadata(), err
+	}
+	metadata, err := s.GetMetadataFromDb(filePath, modTime)
+	if err == nil {
+		return metadata, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return audio.NewMetadata(), err
+	}
+	metadata, err = audio.ReadMetadata(filePath)
+	if err != nil {
+		return metadata, err
+	}
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return metadata, err
+	}
+	if err := upsertMetadataInTx(tx, filePath, modTime, metadata); err != nil {
+		tx.Rollback()
+		return metadata, err
+	}
+	return metadata, tx.Commit()
+}
+
+// Get cached metadata, returning sql.ErrNoRows if there isn't any for this version of the file
+func (s *Server) GetMetadataFromDb(filePath string, modTime int64) (audio.Metadata, error) {
+	statement := `select title, artist, description, genre, key, tempo, root_note, loop_start, loop_end, fields
+from Metadata where file_path = ? and mod_time = ?`
+	row := s.Db.QueryRow(statement, filePath, modTime)
+	metadata := audio.NewMetadata()
+	var fields string
+	if err := row.Scan(&metadata.Title, &metadata.Artist, &metadata.Description, &metadata.Genre, &metadata.Key, &metadata.Tempo, &metadata.RootNote, &metadata.LoopStart, &metadata.LoopEnd, &fields); err != nil {
+		return metadata, err
+	}
+	if err := json.Unmarshal([]byte(fields), &metadata.Fields); err != nil {
+		return metadata, err
+	}
+	return metadata, nil
+}
+
+// Store metadata, replacing any stale result for the same file
+func upsertMetadataInTx(tx *sql.Tx, filePath string, modTime int64, metadata audio.Metadata) error {
+	fields, err := json.Marshal(metadata.Fields)
+	if err != nil {
+		return err
+	}
+	statement := `insert or replace into Metadata
+(file_path, mod_time, title, artist, description, genre, key, tempo, root_note, loop_start, loop_end, fields, search_text)
+values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = tx.Exec(statement, filePath, modTime, metadata.Title, metadata.Artist, metadata.Description, metadata.Genre, metadata.Key, metadata.Tempo, metadata.RootNote, metadata.LoopStart, metadata.LoopEnd, string(fields), metadata.SearchText())
+	return err
+}
+
+// Read and store the metadata of every file that is new or has changed
+func (s *Server) IndexMetadata(files []string) error {
+	cached := make(map[string]int64)
+	rows, err := s.Db.Query(`select file_path, mod_time from Metadata`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var filePath string
+		var modTime int64
+		if err := rows.Scan(&filePath, &modTime); err != nil {
+			rows.Close()
+			return err
+		}
+		cached[filePath] = modTime
+	}
+	rows.Close()
+	modTimes := make(map[string]int64)
+	stale := make([]string, 0)
+	for _, file := range files {
+		modTime, err := fileModTime(file)
+		if err != nil {
+			continue
+		}
+		if cachedModTime, ok := cached[file]; ok && cachedModTime == modTime {
+			continue
+		}
+		modTimes[file] = modTime
+		stale = append(stale, file)
+	}
+	read := make(map[string]audio.Metadata)
+	var mu sync.Mutex
+	forEachFileParallel(stale, func(file string) {
+		metadata, err := audio.ReadMetadata(file)
+		if err != nil {
+			log.Printf("Failed to read metadata from %s: %v", file, err)
+			return
+		}
+		mu.Lock()
+		read[file] = metadata
+		mu.Unlock()
+	})
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	for file, metadata := range read {
+		if err := upsertMetadataInTx(tx, file, modTimes[file], metadata); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("read metadata from %d files", len(read))
+	return nil
+}
+
+// Searchable metadata text of every file beneath a directory, keyed by path
+func (s *Server) GetDirectoryMetadataText(dir string) map[string]string {
+	prefix := dirPrefix(dir)
+	rows, err := s.Db.Query(`select file_path, search_text from Metadata where substr(file_path, 1, length(?)) = ? and search_text != ''`, prefix, prefix)
+	if err != nil {
+		log.Fatalf("Failed to execute SQL statement in getDirectoryMetadataText: %v", err)
+	}
+	defer rows.Close()
+	texts := make(map[string]string)
+	for rows.Next() {
+		var filePath, text string
+		if err := rows.Scan(&filePath, &text); err != nil {
+			log.Fatalf("Failed to scan row in getDirectoryMetadataText: %v", err)
+		}
+		texts[filePath] = text
+	}
+	return texts
+}
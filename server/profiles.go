@@ -0,0 +1,277 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/jesses-code-adventures/excavator/audio"
+	"github.com/jesses-code-adventures/excavator/core"
+)
+
+// ////////////////////// EXPORT PROFILES ////////////////////////
+
+// The limits of a piece of hardware an export is destined for. Zero values mean no limit.
+type ExportProfile struct {
+	Name          string
+	Options       audio.TranscodeOptions
+	MaxNameLength int    // characters in a file or folder name, including the extension
+	Characters    string // allowed on top of ascii letters and digits, everything else becomes an underscore
+	MaxDepth      int    // folders below the export directory
+	Capacity      int64  // bytes
+}
+
+const gigabyte = 1 << 30
+
+// Profiles for the machines we fill most often
+var ExportProfiles = []ExportProfile{
+	{
+		Name:          "digitakt",
+		Options:       audio.TranscodeOptions{Format: audio.FormatWav, SampleRate: 48000, BitDepth: 16, Mono: true},
+		MaxNameLength: 24,
+		Characters:    " -_.",
+		MaxDepth:      2,
+		Capacity:      1 * gigabyte,
+	},
+	{
+		Name:          "octatrack",
+		Options:       audio.TranscodeOptions{Format: audio.FormatWav, SampleRate: 44100, BitDepth: 16},
+		MaxNameLength: 31,
+		Characters:    " -_.",
+		MaxDepth:      3,
+		Capacity:      16 * gigabyte,
+	},
+	{
+		Name:          "sp-404",
+		Options:       audio.TranscodeOptions{Format: audio.FormatWav, SampleRate: 48000, BitDepth: 16},
+		MaxNameLength: 16,
+		Characters:    "-_.",
+		MaxDepth:      1,
+		Capacity:      16 * gigabyte,
+	},
+	{
+		Name:          "mpc",
+		Options:       audio.TranscodeOptions{Format: audio.FormatWav, SampleRate: 44100, BitDepth: 16},
+		MaxNameLength: 32,
+		Characters:    " -_.()",
+		Capacity:      16 * gigabyte,
+	},
+	{
+		Name:          "generic",
+		Options:       audio.TranscodeOptions{Format: audio.FormatWav, SampleRate: 44100, BitDepth: 16},
+		MaxNameLength: 64,
+		Characters:    " -_.()",
+	},
+}
+
+// Look up a profile by name
+func GetExportProfile(name string) (ExportProfile, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, profile := range ExportProfiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return ExportProfile{}, false
+}
+
+// Names of every profile, for prompts and errors
+func ExportProfileNames() []string {
+	names := make([]string, 0, len(ExportProfiles))
+	for _, profile := range ExportProfiles {
+		names = append(names, profile.Name)
+	}
+	return names
+}
+
+// The export with the profile's format settings in place of its own
+func (p ExportProfile) Apply(export core.Export) core.Export {
+	export.Format = p.Options.Format
+	export.SampleRate = p.Options.SampleRate
+	export.BitDepth = p.Options.BitDepth
+	export.Mono = p.Options.Mono
+	return export
+}
+
+// Replace characters the device can't display
+func (p ExportProfile) cleanCharacters(name string) string {
+	if p.Characters == "" {
+		return name
+	}
+	var b strings.Builder
+	for _, r := range name {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(p.Characters, r)) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// A file name the device will accept, keeping the extension when it has to be shortened
+func (p ExportProfile) FixName(name string) string {
+	ext := filepath.Ext(name)
+	if ext == name {
+		// a hidden file, which has no extension to keep
+		ext = ""
+	}
+	return p.fixName(strings.TrimSuffix(name, ext), ext)
+}
+
+// A folder name the device will accept. Folders have no extension, so a dot is just part of the name.
+func (p ExportProfile) FixDirName(name string) string {
+	return p.fixName(name, "")
+}
+
+// Clean both parts of a name and shorten the stem to fit. A name whose extension alone is too long is left too
+// long, for checkName to catch.
+func (p ExportProfile) fixName(stem string, ext string) string {
+	stem, ext = p.cleanCharacters(stem), p.cleanCharacters(ext)
+	if room := p.MaxNameLength - len(ext); p.MaxNameLength > 0 && len(stem) > room && room > 0 {
+		stem = strings.TrimSpace(stem[:room])
+	}
+	return stem + ext
+}
+
+// Why a fixed name still won't do for the device, or nil if it will
+func (p ExportProfile) checkName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("nothing is left of the name once it's fixed")
+	}
+	if p.MaxNameLength > 0 && len(name) > p.MaxNameLength {
+		return errors.New(fmt.Sprintf("%s can't be shortened to %d characters", name, p.MaxNameLength))
+	}
+	return nil
+}
+
+// Folders the device will accept. Anything deeper than the limit is merged into the last allowed folder.
+func (p ExportProfile) FixDirs(dirs []string) []string {
+	if p.MaxDepth > 0 && len(dirs) > p.MaxDepth {
+		merged := strings.Join(dirs[p.MaxDepth-1:], "_")
+		dirs = append(append(make([]string, 0, p.MaxDepth), dirs[:p.MaxDepth-1]...), merged)
+	}
+	fixed := make([]string, len(dirs))
+	for i, dir := range dirs {
+		fixed[i] = p.FixDirName(dir)
+	}
+	return fixed
+}
+
+// Roughly how many bytes a transcoded file will take up
+func estimateExportSize(source string, options audio.TranscodeOptions) (int64, error) {
+	seconds, err := audio.Duration(source)
+	if err != nil {
+		return 0, err
+	}
+	channels := 2
+	if options.Mono {
+		channels = 1
+	}
+	bitDepth := max(options.BitDepth, 16)
+	size := int64(seconds * float64(options.SampleRate*channels*bitDepth/8))
+	if options.Format == audio.FormatFlac {
+		// lossless compression usually lands around 60% of the pcm size
+		size = size * 6 / 10
+	}
+	return size + 44, nil
+}
+
+// A file an export will write, once every name has been fixed up
+type exportItem struct {
+	tag         core.CollectionTag
+	destination string
+}
+
+// Everything an export will do, worked out before anything is written
+type exportPlan struct {
+	items    []exportItem
+	fixes    []string
+	problems []string
+}
+
+// Work out where every tag will be written. With a profile, names and folders are fixed to suit the device and
+// anything that can't be fixed is listed as a problem.
+func planExport(tags []core.CollectionTag, export core.Export, profile *ExportProfile) exportPlan {
+	plan := exportPlan{items: make([]exportItem, 0, len(tags)), fixes: make([]string, 0), problems: make([]string, 0)}
+	used := make(map[string]bool, len(tags))
+	root := core.ExpandPath(export.Path())
+	var total int64
+	for _, tag := range tags {
+		dirs := []string{tag.CollectionName}
+		for _, dir := range strings.Split(tag.SubCollection, "/") {
+			if dir != "" {
+				dirs = append(dirs, dir)
+			}
+		}
+		name := tag.Name()
+		if export.Transcodes() {
+			name = audio.TranscodeOptions{Format: export.Format}.FileName(name)
+		}
+		if profile != nil {
+			fixedDirs, fixedName := profile.FixDirs(dirs), profile.FixName(name)
+			var nameErr error
+			for _, fixed := range append(fixedDirs, fixedName) {
+				if nameErr = profile.checkName(fixed); nameErr != nil {
+					break
+				}
+			}
+			if nameErr != nil {
+				plan.problems = append(plan.problems, fmt.Sprintf("%s: %v", tag.FilePath, nameErr))
+				continue
+			}
+			if before, after := path.Join(append(dirs, name)...), path.Join(append(fixedDirs, fixedName)...); before != after {
+				plan.fixes = append(plan.fixes, fmt.Sprintf("renamed %s to %s", before, after))
+			}
+			dirs, name = fixedDirs, fixedName
+			size, err := estimateExportSize(tag.FilePath, profile.Options)
+			if err != nil {
+				plan.problems = append(plan.problems, fmt.Sprintf("%s: %v", tag.FilePath, err))
+				continue
+			}
+			total += size
+		}
+		destination := path.Join(root, path.Join(dirs...), name)
+		if used[destination] {
+			unique, err := uniqueDestination(destination, used, profile)
+			if err != nil {
+				plan.problems = append(plan.problems, fmt.Sprintf("%s: %v", tag.FilePath, err))
+				continue
+			}
+			plan.fixes = append(plan.fixes, fmt.Sprintf("renamed %s to %s to avoid a clash", path.Base(destination), path.Base(unique)))
+			destination = unique
+		}
+		used[destination] = true
+		plan.items = append(plan.items, exportItem{tag: tag, destination: destination})
+	}
+	if profile != nil && profile.Capacity > 0 && total > profile.Capacity {
+		plan.problems = append(plan.problems, fmt.Sprintf("about %.1fgb won't fit on the %s's %.1fgb", float64(total)/gigabyte, profile.Name, float64(profile.Capacity)/gigabyte))
+	}
+	return plan
+}
+
+// A numbered variant of a destination that nothing else in the export is using
+func uniqueDestination(destination string, used map[string]bool, profile *ExportProfile) (string, error) {
+	dir, name := path.Split(destination)
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 2; i < 1000; i++ {
+		suffix := fmt.Sprintf("_%d", i)
+		candidateStem := stem
+		if profile != nil && profile.MaxNameLength > 0 && len(stem)+len(suffix)+len(ext) > profile.MaxNameLength {
+			room := profile.MaxNameLength - len(suffix) - len(ext)
+			if room < 1 {
+				break
+			}
+			candidateStem = stem[:room]
+		}
+		candidate := path.Join(dir, candidateStem+suffix+ext)
+		if !used[candidate] {
+			return candidate, nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf("couldn't find a free name for %s", name))
+}
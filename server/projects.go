@@ -0,0 +1,280 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jesses-code-adventures/excavator/session"
+)
+
+// ////////////////////// PROJECT USAGE ////////////////////////
+
+var usageSearchPrefix = "used:"
+
+// How a scan of the projects directory went
+type ProjectScan struct {
+	Scanned   int
+	Unchanged int
+	Removed   int
+	Failed    int
+}
+
+// A one line summary for the status bar
+func (p ProjectScan) String() string {
+	summary := fmt.Sprintf("%d scanned, %d unchanged", p.Scanned, p.Unchanged)
+	if p.Removed > 0 {
+		summary += fmt.Sprintf(", %d removed", p.Removed)
+	}
+	if p.Failed > 0 {
+		summary += fmt.Sprintf(", %d failed", p.Failed)
+	}
+	return summary
+}
+
+// Set the current user's projects directory and update in db
+func (s *Server) SetProjectsDir(dir string) {
+	s.User.ProjectsDir = dir
+	_, err := s.Db.Exec("update User set projects_dir = ? where id = ?", dir, s.User.Id)
+	if err != nil {
+		log.Fatalf("Failed to execute SQL statement in setProjectsDir: %v", err)
+	}
+}
+
+// Every session file beneath a directory that a parser understands, skipping hidden folders and the backups Live
+// keeps beside each set
+func ListSessionFiles(dir string) ([]string, error) {
+	files := make([]string, 0)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != dir && (strings.HasPrefix(d.Name(), ".") || (d.IsDir() && d.Name() == "Backup")) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && session.IsSessionFile(p) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Modification times of every scanned project beneath a directory, keyed by path
+func (s *Server) getProjectModTimes(dir string) (map[string]int64, error) {
+	prefix := dirPrefix(dir)
+	rows, err := s.Db.Query(`select file_path, mod_time from Project where substr(file_path, 1, length(?)) = ?`, prefix, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	modTimes := make(map[string]int64)
+	for rows.Next() {
+		var filePath string
+		var modTime int64
+		if err := rows.Scan(&filePath, &modTime); err != nil {
+			return nil, err
+		}
+		modTimes[filePath] = modTime
+	}
+	return modTimes, rows.Err()
+}
+
+// Parse every project beneath the user's projects directory that has changed since it was last scanned, and record
+// which samples each one uses. Projects that have been deleted are forgotten.
+func (s *Server) ScanProjects() (ProjectScan, error) {
+	scan := ProjectScan{}
+	dir := s.User.ProjectsDir
+	if dir == "" {
+		return scan, errors.New("no projects directory set, launch with --projects")
+	}
+	files, err := ListSessionFiles(dir)
+	if err != nil {
+		return scan, err
+	}
+	cached, err := s.getProjectModTimes(dir)
+	if err != nil {
+		return scan, err
+	}
+	modTimes := make(map[string]int64)
+	stale := make([]string, 0)
+	for _, file := range files {
+		modTime, err := fileModTime(file)
+		if err != nil {
+			continue
+		}
+		if cachedModTime, ok := cached[file]; ok && cachedModTime == modTime {
+			scan.Unchanged++
+		} else {
+			modTimes[file] = modTime
+			stale = append(stale, file)
+		}
+		delete(cached, file)
+	}
+	log.Printf("scanning %d of %d projects in %s", len(stale), len(files), dir)
+	parsed := make(map[string]session.Session)
+	var mu sync.Mutex
+	forEachFileParallel(stale, func(file string) {
+		project, err := session.Parse(file)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			log.Printf("Failed to scan project %s: %v", file, err)
+			scan.Failed++
+			return
+		}
+		parsed[file] = project
+	})
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return scan, err
+	}
+	for file, project := range parsed {
+		if _, err := tx.Exec(`insert or ignore into Project (file_path, mod_time) values (?, ?)`, file, modTimes[file]); err != nil {
+			tx.Rollback()
+			return scan, err
+		}
+		var projectId int
+		if err := tx.QueryRow(`select id from Project where file_path = ?`, file).Scan(&projectId); err != nil {
+			tx.Rollback()
+			return scan, err
+		}
+		if _, err := tx.Exec(`update Project set mod_time = ? where id = ?`, modTimes[file], projectId); err != nil {
+			tx.Rollback()
+			return scan, err
+		}
+		if _, err := tx.Exec(`delete from ProjectSample where project_id = ?`, projectId); err != nil {
+			tx.Rollback()
+			return scan, err
+		}
+		for _, sample := range project.Samples {
+			if sample.Missing {
+				continue
+			}
+			if _, err := tx.Exec(`insert or ignore into ProjectSample (project_id, file_path) values (?, ?)`, projectId, sample.Path); err != nil {
+				tx.Rollback()
+				return scan, err
+			}
+		}
+		scan.Scanned++
+	}
+	// anything left in the cache wasn't found on disk
+	for file := range cached {
+		if _, err := tx.Exec(`delete from ProjectSample where project_id in (select id from Project where file_path = ?)`, file); err != nil {
+			tx.Rollback()
+			return scan, err
+		}
+		if _, err := tx.Exec(`delete from Project where file_path = ?`, file); err != nil {
+			tx.Rollback()
+			return scan, err
+		}
+		scan.Removed++
+	}
+	if err := tx.Commit(); err != nil {
+		return scan, err
+	}
+	return scan, nil
+}
+
+// How many of the user's projects use each file beneath a directory, keyed by path. Unused files are left out.
+func (s *Server) GetDirectoryUsage(dir string) map[string]int {
+	usage := make(map[string]int)
+	if s.User.ProjectsDir == "" {
+		return usage
+	}
+	prefix := dirPrefix(dir)
+	s.readUsage(usage, `and substr(ps.file_path, 1, length(?)) = ?`, prefix, prefix)
+	return usage
+}
+
+// How many of the user's projects use each of the files, keyed by path. Unused files are left out.
+func (s *Server) GetUsage(paths []string) map[string]int {
+	usage := make(map[string]int)
+	if s.User.ProjectsDir == "" {
+		return usage
+	}
+	forEachPathBatch(paths, func(placeholders string, args []any) {
+		s.readUsage(usage, fmt.Sprintf(`and ps.file_path in (%s)`, placeholders), args...)
+	})
+	return usage
+}
+
+// Count the projects beneath the user's projects directory using each sample matched by filter
+func (s *Server) readUsage(usage map[string]int, filter string, args ...any) {
+	statement := fmt.Sprintf(`select ps.file_path, count(distinct p.id) from ProjectSample ps
+join Project p on ps.project_id = p.id
+where substr(p.file_path, 1, length(?)) = ? %s
+group by ps.file_path`, filter)
+	projectsPrefix := dirPrefix(s.User.ProjectsDir)
+	rows, err := s.Db.Query(statement, append([]any{projectsPrefix, projectsPrefix}, args...)...)
+	if err != nil {
+		log.Fatalf("Failed to execute SQL statement in readUsage: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var filePath string
+		var count int
+		if err := rows.Scan(&filePath, &count); err != nil {
+			log.Fatalf("Failed to scan row in readUsage: %v", err)
+		}
+		usage[filePath] = count
+	}
+}
+
+// The user's projects that use a file
+func (s *Server) GetSampleProjects(filePath string) []string {
+	projects := make([]string, 0)
+	if s.User.ProjectsDir == "" {
+		return projects
+	}
+	statement := `select p.file_path from ProjectSample ps
+join Project p on ps.project_id = p.id
+where ps.file_path = ? and substr(p.file_path, 1, length(?)) = ?
+order by p.file_path asc`
+	projectsPrefix := dirPrefix(s.User.ProjectsDir)
+	rows, err := s.Db.Query(statement, filePath, projectsPrefix, projectsPrefix)
+	if err != nil {
+		log.Fatalf("Failed to execute SQL statement in getSampleProjects: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var project string
+		if err := rows.Scan(&project); err != nil {
+			log.Fatalf("Failed to scan row in getSampleProjects: %v", err)
+		}
+		projects = append(projects, project)
+	}
+	return projects
+}
+
+// Pull a usage filter out of a search, returning the remaining words and a test for a file's project count.
+// "used:yes" matches samples used in any project, "used:no" those never used and "used:3" those used in at least 3.
+func SplitUsageSearch(search string) (string, func(count int) bool) {
+	words := make([]string, 0)
+	var filter func(count int) bool
+	for _, word := range strings.Fields(search) {
+		if !strings.HasPrefix(strings.ToLower(word), usageSearchPrefix) {
+			words = append(words, word)
+			continue
+		}
+		switch value := strings.ToLower(word[len(usageSearchPrefix):]); value {
+		case "yes", "y", "true":
+			filter = func(count int) bool { return count > 0 }
+		case "no", "n", "false", "0":
+			filter = func(count int) bool { return count == 0 }
+		default:
+			if minimum, err := strconv.Atoi(value); err == nil {
+				filter = func(count int) bool { return count >= minimum }
+			}
+		}
+	}
+	return strings.Join(words, " "), filter
+}
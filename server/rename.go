@@ -0,0 +1,122 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jesses-code-adventures/excavator/core"
+)
+
+// ////////////////////// RENAMING AND MOVING ////////////////////////
+
+// Tables recording something about a file by its path. Renames keep a file's mod time, so the caches stay valid.
+var pathTables = []string{"Spectrogram", "Fingerprint", "Features", "Category", "Metadata", "ProjectSample", "ResolvedDuplicate"}
+
+// Rename a file or directory in place
+func (s *Server) RenamePath(from string, name string) error {
+	if name == "" || strings.ContainsRune(name, filepath.Separator) {
+		return errors.New(fmt.Sprintf("invalid name %q", name))
+	}
+	return s.MovePath(from, filepath.Join(filepath.Dir(from), name))
+}
+
+// Move a file or directory somewhere else beneath the root and point every tag and cached result at the new
+// location. The database is updated in one transaction, and the move is undone on disk if that fails.
+func (s *Server) MovePath(from string, to string) error {
+	from, to = filepath.Clean(from), filepath.Clean(core.ExpandPath(to))
+	if from == to {
+		return nil
+	}
+	if err := s.movePath(from, to); err != nil {
+		return err
+	}
+	s.journal(fmt.Sprintf("move %s", filepath.Base(from)), JournalChange{Kind: changeMove, From: from, To: to})
+	return nil
+}
+
+// Move a file or directory without recording it in the journal
+func (s *Server) movePath(from string, to string) error {
+	from, to = filepath.Clean(from), filepath.Clean(to)
+	if !s.isInRoot(from) || !s.isInRoot(to) {
+		return errors.New("can only move files beneath the root")
+	}
+	if strings.HasPrefix(to, from+string(filepath.Separator)) {
+		return errors.New(fmt.Sprintf("can't move %s inside itself", filepath.Base(from)))
+	}
+	info, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(to); err == nil {
+		return errors.New(fmt.Sprintf("%s already exists", to))
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(from, to); err != nil {
+		return err
+	}
+	if err := s.movePathInDb(from, to, info.IsDir()); err != nil {
+		if undoErr := os.Rename(to, from); undoErr != nil {
+			log.Printf("Failed to move %s back to %s after a db error: %v", to, from, undoErr)
+		}
+		return err
+	}
+	log.Printf("moved %s to %s", from, to)
+	return nil
+}
+
+// Rewrite every path at or beneath from to sit beneath to instead
+func (s *Server) movePathInDb(from string, to string, dir bool) error {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	prefix := from + string(filepath.Separator)
+	moved := []string{from}
+	if dir {
+		rows, err := tx.Query(`select file_path from Tag where substr(file_path, 1, length(?)) = ?`, prefix, prefix)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		for rows.Next() {
+			var filePath string
+			if err := rows.Scan(&filePath); err != nil {
+				rows.Close()
+				tx.Rollback()
+				return err
+			}
+			moved = append(moved, filePath)
+		}
+		rows.Close()
+	}
+	for _, filePath := range moved {
+		// an orphaned tag may already sit at the new path, in which case the two are merged
+		if err := repointTagInTx(tx, filePath, to+strings.TrimPrefix(filePath, from)); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	toPrefix := to + string(filepath.Separator)
+	for _, table := range pathTables {
+		statements := []string{
+			// anything already at the destination describes a file that's gone
+			fmt.Sprintf(`delete from %s where file_path = ? or substr(file_path, 1, length(?)) = ?`, table),
+			fmt.Sprintf(`update %s set file_path = ? || substr(file_path, length(?) + 1) where file_path = ? or substr(file_path, 1, length(?)) = ?`, table),
+		}
+		if _, err := tx.Exec(statements[0], to, toPrefix, toPrefix); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec(statements[1], to, from, from, prefix, prefix); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
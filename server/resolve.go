@@ -0,0 +1,185 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jesses-code-adventures/excavator/audio"
+	"github.com/jesses-code-adventures/excavator/core"
+	"github.com/jesses-code-adventures/excavator/session"
+)
+
+// ////////////////////// MISSING SAMPLES ////////////////////////
+
+// How much each kind of match counts towards a candidate's score
+const (
+	nameMatchScore  = 1
+	sizeMatchScore  = 2
+	audioMatchScore = 4
+)
+
+// A file that might be a missing sample, and why we think so
+type ResolveCandidate struct {
+	Path    string
+	Reasons []string
+	score   int
+}
+
+// A sample a session can't find and the files in the root that might be it
+type MissingSample struct {
+	Ref        session.SampleRef
+	Candidates []ResolveCandidate
+	Choice     string // the file replacing it, empty when unresolved
+}
+
+// Note another reason a file might be the missing sample
+func addCandidate(candidates map[string]*ResolveCandidate, filePath string, reason string, score int) {
+	candidate, ok := candidates[filePath]
+	if !ok {
+		candidate = &ResolveCandidate{Path: filePath, Reasons: make([]string, 0, 3)}
+		candidates[filePath] = candidate
+	}
+	if slices.Contains(candidate.Reasons, reason) {
+		return
+	}
+	candidate.Reasons = append(candidate.Reasons, reason)
+	candidate.score += score
+}
+
+// Files in the root with the given fingerprint
+func (s *Server) getFilesWithFingerprint(hash string) []string {
+	rows, err := s.Db.Query(`select file_path from Fingerprint where hash = ?`, hash)
+	if err != nil {
+		log.Fatalf("Failed to execute SQL statement in getFilesWithFingerprint: %v", err)
+	}
+	defer rows.Close()
+	files := make([]string, 0)
+	for rows.Next() {
+		var filePath string
+		if err := rows.Scan(&filePath); err != nil {
+			log.Fatalf("Failed to scan row in getFilesWithFingerprint: %v", err)
+		}
+		if _, err := os.Stat(filePath); err == nil && s.isInRoot(filePath) {
+			files = append(files, filePath)
+		}
+	}
+	return files
+}
+
+// Find the samples a session can't, and search the root for files that could replace them by name, by the size
+// the session recorded and by the fingerprint stored for the old path before it moved
+func (s *Server) FindMissingSamples(path string) (session.Session, []MissingSample, error) {
+	parsed, err := session.Parse(core.ExpandPath(path))
+	if err != nil {
+		return parsed, nil, err
+	}
+	missing := make([]MissingSample, 0)
+	seen := make(map[string]bool)
+	needSizes := false
+	for _, ref := range parsed.Samples {
+		if !ref.Missing || seen[ref.Path] {
+			continue
+		}
+		seen[ref.Path] = true
+		needSizes = needSizes || ref.Size > 0
+		missing = append(missing, MissingSample{Ref: ref})
+	}
+	if len(missing) == 0 {
+		return parsed, missing, nil
+	}
+	files, err := ListAudioFiles(s.State.Root)
+	if err != nil {
+		return parsed, nil, err
+	}
+	byName := make(map[string][]string)
+	bySize := make(map[int64][]string)
+	for _, file := range files {
+		name := strings.ToLower(filepath.Base(file))
+		byName[name] = append(byName[name], file)
+		if needSizes {
+			if info, err := os.Stat(file); err == nil {
+				bySize[info.Size()] = append(bySize[info.Size()], file)
+			}
+		}
+	}
+	for i, sample := range missing {
+		candidates := make(map[string]*ResolveCandidate)
+		for _, file := range byName[strings.ToLower(filepath.Base(sample.Ref.Path))] {
+			addCandidate(candidates, file, "same name", nameMatchScore)
+		}
+		if sample.Ref.Size > 0 {
+			for _, file := range bySize[sample.Ref.Size] {
+				addCandidate(candidates, file, "same size", sizeMatchScore)
+			}
+		}
+		if hash := s.GetFingerprint(sample.Ref.Path); hash != "" {
+			for _, file := range s.getFilesWithFingerprint(hash) {
+				addCandidate(candidates, file, "same audio", audioMatchScore)
+			}
+			// anything not fingerprinted yet is checked directly
+			for file := range candidates {
+				if s.GetFingerprint(file) != "" {
+					continue
+				}
+				if fileHash, err := audio.Fingerprint(file); err == nil && fileHash == hash {
+					addCandidate(candidates, file, "same audio", audioMatchScore)
+				}
+			}
+		}
+		sorted := make([]ResolveCandidate, 0, len(candidates))
+		for _, candidate := range candidates {
+			sorted = append(sorted, *candidate)
+		}
+		slices.SortFunc(sorted, func(a, b ResolveCandidate) int {
+			if a.score != b.score {
+				return b.score - a.score
+			}
+			return strings.Compare(a.Path, b.Path)
+		})
+		missing[i].Candidates = sorted
+	}
+	return parsed, missing, nil
+}
+
+// Write a plain text report of what was missing and what it was resolved to
+func WriteResolveReport(destination string, parsed session.Session, missing []MissingSample) error {
+	resolved := 0
+	for _, sample := range missing {
+		if sample.Choice != "" {
+			resolved++
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "missing samples in %s\n", parsed.Path)
+	fmt.Fprintf(&b, "%d of %d samples missing, %d resolved\n", len(missing), len(parsed.Samples), resolved)
+	for _, sample := range missing {
+		fmt.Fprintf(&b, "\n%s\n", sample.Ref.Path)
+		if sample.Ref.Track != "" {
+			fmt.Fprintf(&b, "  track: %s\n", sample.Ref.Track)
+		}
+		if sample.Choice != "" {
+			fmt.Fprintf(&b, "  resolved: %s\n", sample.Choice)
+		} else {
+			b.WriteString("  unresolved\n")
+		}
+		for _, candidate := range sample.Candidates {
+			fmt.Fprintf(&b, "  candidate: %s (%s)\n", candidate.Path, strings.Join(candidate.Reasons, ", "))
+		}
+	}
+	return os.WriteFile(destination, []byte(b.String()), 0644)
+}
+
+// Write a copy of the session with every resolved sample pointed at its replacement
+func RepairSession(parsed session.Session, destination string, missing []MissingSample) (int, error) {
+	replacements := make(map[string]string)
+	for _, sample := range missing {
+		if sample.Choice != "" {
+			replacements[sample.Ref.Path] = sample.Choice
+		}
+	}
+	return session.Repair(parsed.Path, destination, replacements)
+}
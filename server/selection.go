@@ -0,0 +1,102 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/jesses-code-adventures/excavator/core"
+)
+
+// ////////////////////// SELECTIONS ////////////////////////
+
+// The audio files a selection covers, with every selected directory replaced by the files beneath it
+func expandSelection(paths []string) []string {
+	files := make([]string, 0, len(paths))
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		found := []string{p}
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			if found, err = ListAudioFiles(p); err != nil {
+				log.Printf("Failed to list %s: %v", p, err)
+				continue
+			}
+		} else if !core.IsAudioFile(p) {
+			continue
+		}
+		for _, f := range found {
+			if !seen[f] {
+				seen[f] = true
+				files = append(files, f)
+			}
+		}
+	}
+	return files
+}
+
+// Tag every selected file, and everything beneath each selected directory, into the target collection and
+// subcollection in one transaction. Returns how many tags were added.
+func (s *Server) TagSelection(paths []string) (int, error) {
+	if s.User.TargetCollection.Id() == 0 {
+		return 0, errors.New("no target collection set")
+	}
+	files := expandSelection(paths)
+	tx, err := s.Db.Begin()
+	if err != nil {
+		log.Fatalf("Failed to begin transaction in tagSelection: %v", err)
+	}
+	changes := make([]JournalChange, 0, len(files))
+	for _, filePath := range files {
+		if addCollectionTagInTx(tx, s.User.Id, filePath, s.User.TargetCollection.Id(), filepath.Base(filePath), s.User.TargetSubCollection) {
+			changes = append(changes, tagChange(filePath, s.User.TargetCollection.Id(), filepath.Base(filePath), s.User.TargetSubCollection))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("Failed to commit transaction in tagSelection: %v", err)
+	}
+	s.journal(fmt.Sprintf("tag %d selected files", len(changes)), changes...)
+	return len(changes), nil
+}
+
+// Take every selected file, and everything beneath each selected directory, out of the target collection in one
+// transaction. Returns how many tags were removed.
+func (s *Server) UntagSelection(paths []string) (int, error) {
+	if s.User.TargetCollection.Id() == 0 {
+		return 0, errors.New("no target collection set")
+	}
+	tx, err := s.Db.Begin()
+	if err != nil {
+		log.Fatalf("Failed to begin transaction in untagSelection: %v", err)
+	}
+	removed := make([]JournalChange, 0)
+	for _, p := range paths {
+		removed = append(removed, untagPathInTx(tx, s.User.TargetCollection.Id(), p)...)
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("Failed to commit transaction in untagSelection: %v", err)
+	}
+	s.journal(fmt.Sprintf("untag %d selected files", len(removed)), removed...)
+	return len(removed), nil
+}
+
+// Tags to export a selection with. Files already in the target collection keep their name and subcollection, the
+// rest go in the target subcollection under their own name.
+func (s *Server) SelectionTags(paths []string) []core.CollectionTag {
+	existing := make(map[string]core.CollectionTag)
+	for _, tag := range s.GetCollectionTags(s.User.TargetCollection.Id()) {
+		if _, ok := existing[tag.FilePath]; !ok {
+			existing[tag.FilePath] = tag
+		}
+	}
+	tags := make([]core.CollectionTag, 0, len(paths))
+	for _, filePath := range expandSelection(paths) {
+		if tag, ok := existing[filePath]; ok {
+			tags = append(tags, tag)
+		} else {
+			tags = append(tags, core.NewCollectionTag(0, filepath.Base(filePath), filePath, s.User.TargetCollection.Name(), s.User.TargetSubCollection))
+		}
+	}
+	return tags
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"flag"
+	"fmt"
 
 	// "io/fs"
 	"log"
@@ -12,6 +13,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	// Database
 	_ "github.com/mattn/go-sqlite3"
@@ -23,6 +25,7 @@ import (
 //////////////////////// LOCAL SERVER ////////////////////////
 
 type State struct {
+	Categories         func(paths []string) map[string]string
 	Choices            []core.SelectableListItem
 	choiceChannel      chan core.SelectableListItem
 	CollectionTags     func(path string) []core.CollectionTag
@@ -30,9 +33,10 @@ type State struct {
 	MatchingIndexes    []int
 	localSearchChannel chan string
 	Root               string
+	Usage              func(paths []string) map[string]int
 }
 
-func NewState(root string, currentDir string, collectionTags func(path string) []core.CollectionTag) *State {
+func NewState(root string, currentDir string, collectionTags func(path string) []core.CollectionTag, categories func(paths []string) map[string]string, usage func(paths []string) map[string]int) *State {
 	choiceChannel := make(chan core.SelectableListItem)
 	navState := State{
 		Root:            root,
@@ -40,6 +44,8 @@ func NewState(root string, currentDir string, collectionTags func(path string) [
 		choiceChannel:   choiceChannel,
 		Choices:         make([]core.SelectableListItem, 0),
 		CollectionTags:  collectionTags,
+		Categories:      categories,
+		Usage:           usage,
 		MatchingIndexes: make([]int, 0),
 	}
 	go navState.Run()
@@ -162,6 +168,14 @@ func (f *State) ListDirEntries() []core.SelectableListItem {
 		log.Fatalf("Failed to read samples directory in ListDirEntries: %v", err)
 	}
 	files = f.FilterDirEntries(files)
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		if !file.IsDir() {
+			paths = append(paths, path.Join(f.Dir, file.Name()))
+		}
+	}
+	categories := f.Categories(paths)
+	usage := f.Usage(paths)
 	var samples []core.SelectableListItem
 	for _, file := range files {
 		matchedTags := make([]core.CollectionTag, 0)
@@ -173,7 +187,10 @@ func (f *State) ListDirEntries() []core.SelectableListItem {
 				}
 			}
 		}
-		samples = append(samples, core.NewTaggedDirEntry(path.Join(f.Dir, file.Name()), matchedTags, isDir))
+		entry := core.NewTaggedDirEntry(path.Join(f.Dir, file.Name()), matchedTags, isDir)
+		entry.Category = categories[entry.FilePath]
+		entry.Projects = usage[entry.FilePath]
+		samples = append(samples, entry)
 	}
 	return samples
 }
@@ -336,6 +353,7 @@ type Flags struct {
 	Root       string
 	User       string
 	Watch      bool
+	Projects   string
 }
 
 func ParseFlags() *Flags {
@@ -345,8 +363,9 @@ func ParseFlags() *Flags {
 	var samples = flag.String("root", "", "Root samples directory")
 	var userArg = flag.String("user", "", "User name to launch with")
 	var watch = flag.Bool("watch", false, "Watch for changes in the samples directory")
+	var projects = flag.String("projects", "", "DAW projects directory to scan for sample usage")
 	flag.Parse()
-	return &Flags{Data: core.ExpandPath(*data), DbFileName: *dbFileName, LogFile: *logFile, Root: core.ExpandPath(*samples), User: *userArg, Watch: *watch}
+	return &Flags{Data: core.ExpandPath(*data), DbFileName: *dbFileName, LogFile: *logFile, Root: core.ExpandPath(*samples), User: *userArg, Watch: *watch, Projects: core.ExpandPath(*projects)}
 }
 
 // Part of newServer constructor
@@ -376,10 +395,15 @@ func NewServer(audioPlayer *audio.Player, flags *Flags) (Server, error) {
 	if err != nil {
 		log.Fatalf("failed to create sqlite file %v", err)
 	}
-	if _, err := os.Stat(config.GetDbPath()); os.IsNotExist(err) {
-		_, innerErr := db.Exec(string(config.CreateSqlCommands))
-		if innerErr != nil {
-			log.Fatalf("Failed to execute SQL commands: %v", innerErr)
+	// Every statement is idempotent, so tables added since the db was created get picked up here
+	_, err = db.Exec(string(config.CreateSqlCommands))
+	if err != nil {
+		log.Fatalf("Failed to execute SQL commands: %v", err)
+	}
+	for _, migration := range core.Migrations {
+		_, err = db.Exec(migration)
+		if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			log.Fatalf("Failed to execute migration %s: %v", migration, err)
 		}
 	}
 	if db == nil {
@@ -407,7 +431,10 @@ func (s Server) AddUserAndRoot() (Server, error) {
 	if err != nil {
 		return s, err
 	}
-	s.State = NewState(s.Config.Root, s.Config.Root, s.GetDirectoryTags)
+	if s.Flags.Projects != "" {
+		s.SetProjectsDir(s.Flags.Projects)
+	}
+	s.State = NewState(s.Config.Root, s.Config.Root, s.GetDirectoryTags, s.GetCategories, s.GetUsage)
 	s.State.UpdateChoices()
 	return s, nil
 }
@@ -434,7 +461,7 @@ func (s *Server) UpdateChoices() {
 func (s *Server) UpdateTargetCollection(collection core.CollectionMetadata) {
 	s.User.TargetCollection = &collection
 	s.UpdateSelectedCollectionInDb(collection.Id())
-	s.UpdateTargetSubCollection("")
+	s.UpdateTargetSubCollectionInDb("")
 	s.User.TargetSubCollection = ""
 }
 
@@ -443,14 +470,22 @@ func (s *Server) UpdateTargetSubCollection(subCollection string) {
 	if len(subCollection) > 0 && !strings.HasPrefix(subCollection, "/") {
 		subCollection = "/" + subCollection
 	}
+	if subCollection != s.User.TargetSubCollection {
+		s.journal("target subcollection "+subCollection, JournalChange{Kind: changeSubCollection, From: s.User.TargetSubCollection, To: subCollection})
+	}
 	s.User.TargetSubCollection = subCollection
 	s.UpdateTargetSubCollectionInDb(subCollection)
 }
 
 func (s *Server) GetCollectionTagId(filepath string) int {
 	log.Printf("getting collection tag for filepath %s, collection id %d, subcollection %s", filepath, s.User.TargetCollection.Id(), s.User.TargetSubCollection)
+	return s.findCollectionTagId(filepath, s.User.TargetCollection.Id(), s.User.TargetSubCollection)
+}
+
+// The id of a file's tag in a collection's subcollection, or -1 if it isn't there
+func (s *Server) findCollectionTagId(filepath string, collectionId int, subCollection string) int {
 	statement := `select ct.id from CollectionTag ct left join Tag t on ct.tag_id = t.id where t.file_path = ? and ct.collection_id = ? and ct.sub_collection = ?`
-	row := s.Db.QueryRow(statement, filepath, s.User.TargetCollection.Id(), s.User.TargetSubCollection)
+	row := s.Db.QueryRow(statement, filepath, collectionId, subCollection)
 	var id int
 	if err := row.Scan(&id); err != nil {
 		return -1
@@ -510,11 +545,19 @@ func (s *Server) removeTagFromChoice(path string, tagId int) {
 
 // Create a tag with the defaults based on the current state
 func (s *Server) CreateQuickTag(filepath string) {
+	if s.User.TargetCollection.Id() == 0 {
+		log.Println("No target collection to tag into")
+		return
+	}
 	existingId := s.GetCollectionTagId(filepath)
 	if existingId == -1 {
 		_, ctId := s.CreateCollectionTagInDb(filepath, s.User.TargetCollection.Id(), path.Base(filepath), s.User.TargetSubCollection)
+		s.journal("tag "+path.Base(filepath), tagChange(filepath, s.User.TargetCollection.Id(), path.Base(filepath), s.User.TargetSubCollection))
 		s.addTagToChoice(filepath, core.NewCollectionTag(ctId, path.Base(filepath), filepath, s.User.TargetCollection.Name(), s.User.TargetSubCollection))
 	} else {
+		if change, err := s.getCollectionTagChange(existingId); err == nil {
+			s.journal("untag "+path.Base(filepath), change)
+		}
 		s.DeleteCollectionTag(existingId)
 		s.removeTagFromChoice(filepath, existingId)
 	}
@@ -522,20 +565,33 @@ func (s *Server) CreateQuickTag(filepath string) {
 
 // Create a tag with all possible args
 func (s *Server) CreateTag(filepath string, name string, subCollection string) {
+	if s.User.TargetCollection.Id() == 0 {
+		log.Println("No target collection to tag into")
+		return
+	}
+	existed := s.findCollectionTagId(filepath, s.User.TargetCollection.Id(), subCollection) != -1
 	s.CreateCollectionTagInDb(filepath, s.User.TargetCollection.Id(), name, subCollection)
+	if !existed {
+		s.journal("tag "+name, tagChange(filepath, s.User.TargetCollection.Id(), name, subCollection))
+	}
 	s.UpdateChoices()
 }
 
-func (s *Server) CreateExport(name string, outputDir string, concrete bool) int {
+func (s *Server) CreateExport(export core.Export) int {
+	outputDir := export.Path()
 	if _, err := os.Stat(outputDir); os.IsNotExist(err) {
 		if err := os.MkdirAll(outputDir, 0755); err != nil {
 			panic(err)
 		}
 	}
-	if len(name) == 0 {
+	if len(export.Name()) == 0 {
 		return 0
 	}
-	res, err := s.Db.Exec("insert or ignore into Export (user_id, name, output_dir, concrete) values (?, ?, ?, ?)", s.User.Id, name, outputDir, concrete)
+	if export.WriteMetadata && !export.Concrete() && !export.Transcodes() && export.Profile == "" {
+		log.Println("abstract exports link to the originals, so they can't have metadata written")
+		export.WriteMetadata = false
+	}
+	res, err := s.Db.Exec("insert or ignore into Export (user_id, name, output_dir, concrete, write_metadata, format, sample_rate, bit_depth, mono, profile, kind, sidecar) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", s.User.Id, export.Name(), outputDir, export.Concrete(), export.WriteMetadata, export.Format, export.SampleRate, export.BitDepth, export.Mono, export.Profile, export.Kind, export.Sidecar)
 	if err != nil {
 		log.Fatalf("Failed to execute SQL statement in createTagInDb: %v", err)
 	}
@@ -546,8 +602,31 @@ func (s *Server) CreateExport(name string, outputDir string, concrete bool) int
 	return int(id)
 }
 
+// Columns read by scanExport
+const exportColumns = `id, name, output_dir, concrete, write_metadata, format, sample_rate, bit_depth, mono, profile, kind, sidecar`
+
+// Read an export from a row selecting exportColumns
+func scanExport(row interface{ Scan(...any) error }) (core.Export, error) {
+	var id, sampleRate, bitDepth int
+	var name, outputDir, format, profile, kind string
+	var concrete, writeMetadata, mono, sidecar bool
+	if err := row.Scan(&id, &name, &outputDir, &concrete, &writeMetadata, &format, &sampleRate, &bitDepth, &mono, &profile, &kind, &sidecar); err != nil {
+		return core.Export{}, err
+	}
+	export := core.NewExport(id, name, outputDir, concrete)
+	export.WriteMetadata = writeMetadata
+	export.Format = format
+	export.SampleRate = sampleRate
+	export.BitDepth = bitDepth
+	export.Mono = mono
+	export.Profile = profile
+	export.Kind = kind
+	export.Sidecar = sidecar
+	return export, nil
+}
+
 func (s *Server) GetExports() []core.SelectableListItem {
-	statement := `select id, name, output_dir, concrete from Export where user_id = ? order by name desc`
+	statement := `select ` + exportColumns + ` from Export where user_id = ? order by name desc`
 	rows, err := s.Db.Query(statement, s.User.Id)
 	if err != nil {
 		log.Fatalf("Failed to execute SQL statement in getExports: %v", err)
@@ -555,69 +634,138 @@ func (s *Server) GetExports() []core.SelectableListItem {
 	defer rows.Close()
 	exports := make([]core.SelectableListItem, 0)
 	for rows.Next() {
-		var id int
-		var name string
-		var outputDir string
-		var concrete bool
-		if err := rows.Scan(&id, &name, &outputDir, &concrete); err != nil {
+		export, err := scanExport(rows)
+		if err != nil {
 			log.Fatalf("Failed to scan row in getExports: %v", err)
 		}
-		exports = append(exports, core.NewExport(id, name, outputDir, concrete))
+		exports = append(exports, export)
 	}
 	return exports
 }
 
 func (s *Server) GetExport(id int) core.Export {
-	statement := `select name, output_dir, concrete from Export where id = ?`
-	row := s.Db.QueryRow(statement, id)
-	var name string
-	var outputDir string
-	var concrete bool
-	if err := row.Scan(&name, &outputDir, &concrete); err != nil {
+	statement := `select ` + exportColumns + ` from Export where id = ?`
+	export, err := scanExport(s.Db.QueryRow(statement, id))
+	if err != nil {
 		log.Fatalf("Failed to scan row in getExport: %v", err)
 	}
-	return core.NewExport(id, name, outputDir, concrete)
+	return export
 }
 
-func (s *Server) ExportCollection(tags []core.CollectionTag, export core.Export) {
+// Copy, link or transcode every tagged file into the export's directory. Files are handled in parallel and a
+// failure on one file doesn't stop the rest, they're all collected in the report.
+func (s *Server) ExportCollection(tags []core.CollectionTag, export core.Export) ExportReport {
 	log.Printf("export: %v", export)
 	log.Printf("num tags: %v", len(tags))
+	report := NewExportReport()
+	var profile *ExportProfile
+	if export.Profile != "" {
+		p, ok := GetExportProfile(export.Profile)
+		if !ok {
+			report.Problems = append(report.Problems, fmt.Sprintf("unknown export profile %s, expected one of %s", export.Profile, strings.Join(ExportProfileNames(), ", ")))
+			return report
+		}
+		profile = &p
+		export = p.Apply(export)
+	}
+	plan := planExport(tags, export, profile)
+	report.Fixes = plan.fixes
+	for _, fix := range plan.fixes {
+		log.Printf("export fix: %s", fix)
+	}
+	if len(plan.problems) > 0 {
+		// with a profile the export is all or nothing, so the user can sort these out and run it again
+		report.Problems = plan.problems
+		for _, problem := range plan.problems {
+			log.Printf("export problem: %s", problem)
+		}
+		return report
+	}
+	if export.Chains() {
+		s.exportChains(plan, export, profile, &report)
+		log.Printf("export finished: %s", report)
+		return report
+	}
 	var copyFn func(source string, destination string) error
-	if export.Description() == "concrete" {
+	if export.Transcodes() {
+		options := audio.TranscodeOptions{Format: export.Format, SampleRate: export.SampleRate, BitDepth: export.BitDepth, Mono: export.Mono}
+		copyFn = func(source string, destination string) error {
+			return audio.Transcode(source, destination, options)
+		}
+	} else if export.Concrete() && export.WriteMetadata {
+		// a hard link shares its data with the original, so writing metadata needs a real copy
+		copyFn = copyFile
+	} else if export.Concrete() {
 		copyFn = os.Link
 	} else {
 		copyFn = os.Symlink
 	}
-	for _, tag := range tags {
-		log.Printf("tag: %v", tag)
-		source := tag.FilePath
-		_, err := os.Stat(source)
-		if err != nil {
-			log.Fatalf("Source doesn't exist: %v", err)
+	writeMetadata := export.WriteMetadata && (export.Concrete() || export.Transcodes())
+	var mu sync.Mutex
+	byDestination := make(map[string]core.CollectionTag, len(plan.items))
+	destinations := make([]string, 0, len(plan.items))
+	metadata := make(map[string]audio.ExportMetadata)
+	for _, item := range plan.items {
+		byDestination[item.destination] = item.tag
+		destinations = append(destinations, item.destination)
+		if writeMetadata {
+			// looked up here rather than in the workers, as it can write to the metadata cache
+			metadata[item.destination] = s.GetExportMetadata(item.tag)
 		}
-		dir := core.ExpandPath(path.Join(export.Path(), tag.CollectionName, tag.SubCollection))
-		log.Printf("making dir: %s", dir)
-		err = os.MkdirAll(dir, 0755)
-		if err != nil {
-			log.Fatalf("Failed to create dir: %v", err)
+	}
+	forEachFileParallel(destinations, func(destination string) {
+		tag := byDestination[destination]
+		err := exportFile(tag.FilePath, destination, copyFn)
+		if err == nil && writeMetadata {
+			if err := audio.WriteMetadata(destination, metadata[destination]); err != nil {
+				log.Printf("Failed to write metadata to %s: %v", destination, err)
+			}
 		}
-		log.Printf("output dir: %s", dir)
-		destination := path.Join(dir, tag.Name())
-		_, err = os.Stat(destination)
-		if err == nil {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case errors.Is(err, os.ErrExist):
 			log.Printf("Destination already exists: %s", destination)
-			continue
-		}
-		log.Printf("copying %s to %s", source, destination)
-		if err := copyFn(source, destination); err != nil {
-			log.Fatalf("Failed to create link: %v", err)
-		} else {
-			log.Printf("Created link from %s to %s", source, destination)
+			report.Skipped++
+		case err != nil:
+			report.Fail(tag.FilePath, err)
+		default:
+			log.Printf("Exported %s to %s", tag.FilePath, destination)
+			report.Exported++
 		}
+	})
+	if export.WritesSfz() {
+		s.exportSfz(plan, export, profile, &report)
 	}
+	if export.Kind == core.ExportDrumRack {
+		s.exportDrumRacks(plan, profile, &report)
+	}
+	log.Printf("export finished: %s", report)
+	return report
 }
 
 // ////////////////////// DATABASE ENDPOINTS ////////////////////////
+
+// How many paths go into each "file_path in (...)" query, well under sqlite's limit on variables
+const pathBatch = 500
+
+// A directory with a trailing separator, for matching only what's beneath it with substr(file_path, 1, length(?)) = ?
+func dirPrefix(dir string) string {
+	return strings.TrimSuffix(dir, string(filepath.Separator)) + string(filepath.Separator)
+}
+
+// Call fn with the placeholders and args for each batch of paths, for a "file_path in (...)" query
+func forEachPathBatch(paths []string, fn func(placeholders string, args []any)) {
+	for start := 0; start < len(paths); start += pathBatch {
+		batch := paths[start:min(start+pathBatch, len(paths))]
+		args := make([]any, len(batch))
+		for i, p := range batch {
+			args[i] = p
+		}
+		fn(strings.TrimSuffix(strings.Repeat("?, ", len(batch)), ", "), args)
+	}
+}
+
 // Get collection tags associated with a directory
 func (s *Server) GetCollectionTags(id int) []core.CollectionTag {
 	statement := `select ct.id, t.file_path, col.name, ct.sub_collection,
@@ -765,7 +913,7 @@ where t.file_path like ? order by ct.sub_collection asc, ct.name asc`
 }
 
 func (s *Server) GetUser(id int) core.User {
-	statement := `select u.name as user_name, c.id as collection_id, c.name as collection_name, c.description, u.auto_audition, u.selected_subcollection, u.root from User u left join Collection c on u.selected_collection = c.id where u.id = ?`
+	statement := `select u.name as user_name, c.id as collection_id, c.name as collection_name, c.description, u.auto_audition, u.selected_subcollection, u.root, u.projects_dir from User u left join Collection c on u.selected_collection = c.id where u.id = ?`
 	row := s.Db.QueryRow(statement, id)
 	var name string
 	var collectionId *int
@@ -774,7 +922,8 @@ func (s *Server) GetUser(id int) core.User {
 	var autoAudition bool
 	var selectedSubCollection string
 	var root string
-	if err := row.Scan(&name, &collectionId, &collectionName, &collectionDescription, &autoAudition, &selectedSubCollection, &root); err != nil {
+	var projectsDir string
+	if err := row.Scan(&name, &collectionId, &collectionName, &collectionDescription, &autoAudition, &selectedSubCollection, &root, &projectsDir); err != nil {
 		log.Fatalf("Failed to scan row in getuser: %v", err)
 	}
 	var selectedCollection *core.CollectionMetadata
@@ -785,7 +934,7 @@ func (s *Server) GetUser(id int) core.User {
 		collection := core.NewCollection(0, "", "")
 		selectedCollection = &collection
 	}
-	return core.User{Id: id, Name: name, AutoAudition: autoAudition, TargetCollection: selectedCollection, TargetSubCollection: selectedSubCollection, Root: root}
+	return core.User{Id: id, Name: name, AutoAudition: autoAudition, TargetCollection: selectedCollection, TargetSubCollection: selectedSubCollection, Root: root, ProjectsDir: projectsDir}
 }
 
 // Get all users
@@ -799,7 +948,7 @@ func (s *Server) GetUsers(name *string) []core.User {
 	} else {
 		whereClause = ""
 	}
-	statement := `select u.id as user_id, u.name as user_name, c.id as collection_id, c.name as collection_name, c.description, u.auto_audition, u.selected_subcollection, u.root from User u left join Collection c on u.selected_collection = c.id`
+	statement := `select u.id as user_id, u.name as user_name, c.id as collection_id, c.name as collection_name, c.description, u.auto_audition, u.selected_subcollection, u.root, u.projects_dir from User u left join Collection c on u.selected_collection = c.id`
 	if whereClause != "" {
 		statement = statement + " " + whereClause
 		statement += " order by u.name asc"
@@ -822,7 +971,8 @@ func (s *Server) GetUsers(name *string) []core.User {
 		var autoAudition bool
 		var selectedSubCollection string
 		var root string
-		if err := rows.Scan(&id, &name, &collectionId, &collectionName, &collectionDescription, &autoAudition, &selectedSubCollection, &root); err != nil {
+		var projectsDir string
+		if err := rows.Scan(&id, &name, &collectionId, &collectionName, &collectionDescription, &autoAudition, &selectedSubCollection, &root, &projectsDir); err != nil {
 			log.Fatalf("Failed to scan row in getusers: %v", err)
 		}
 		var selectedCollection *core.CollectionMetadata
@@ -833,7 +983,7 @@ func (s *Server) GetUsers(name *string) []core.User {
 			collection := core.NewCollection(0, "", "")
 			selectedCollection = &collection
 		}
-		users = append(users, core.User{Id: id, Name: name, AutoAudition: autoAudition, TargetCollection: selectedCollection, TargetSubCollection: selectedSubCollection, Root: root})
+		users = append(users, core.User{Id: id, Name: name, AutoAudition: autoAudition, TargetCollection: selectedCollection, TargetSubCollection: selectedSubCollection, Root: root, ProjectsDir: projectsDir})
 	}
 	return users
 }
@@ -863,7 +1013,7 @@ func (s *Server) SetRootFromInput(root string) error {
 			log.Fatal("couldn't create a directory at ", root)
 		}
 	}
-	s.State = NewState(root, root, s.GetDirectoryTags)
+	s.State = NewState(root, root, s.GetDirectoryTags, s.GetCategories, s.GetUsage)
 	s.State.UpdateChoices()
 	return nil
 }
@@ -913,8 +1063,17 @@ func (s *Server) UpdateUsername(id int, name string) {
 	}
 }
 
-// Create a collection in the database
+// Create a collection in the database and make it the target collection
 func (s *Server) CreateCollection(name string, description string) int {
+	id := s.createCollection(name, description)
+	s.journal("create collection "+name, JournalChange{Kind: changeCreateCollection, CollectionId: id, Name: name, Description: description})
+	s.UpdateSelectedCollectionInDb(id)
+	s.UpdateTargetCollection(core.NewCollection(id, name, description))
+	return id
+}
+
+// Create a collection in the database without recording it in the journal
+func (s *Server) createCollection(name string, description string) int {
 	var err error
 	var res sql.Result
 	res, err = s.Db.Exec("insert into Collection (name, user_id, description) values (?, ?, ?)", name, s.User.Id, description)
@@ -925,8 +1084,6 @@ func (s *Server) CreateCollection(name string, description string) int {
 	if err != nil {
 		log.Fatalf("Failed to get last insert ID: %v", err)
 	}
-	s.UpdateSelectedCollectionInDb(int(id))
-	s.UpdateTargetCollection(core.NewCollection(int(id), name, description))
 	return int(id)
 }
 
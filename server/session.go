@@ -0,0 +1,144 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/jesses-code-adventures/excavator/core"
+	"github.com/jesses-code-adventures/excavator/session"
+)
+
+// ////////////////////// DAW SESSION IMPORTS ////////////////////////
+
+// What happened when a session was turned into a collection
+type SessionImport struct {
+	Collection  core.CollectionMetadata
+	Added       int
+	Missing     []string
+	Unsupported []string
+	OutsideRoot []string
+}
+
+// A one line summary, e.g. "my set: 12 tagged, 1 missing"
+func (i SessionImport) String() string {
+	summary := fmt.Sprintf("%s: %d tagged", i.Collection.Name(), i.Added)
+	if len(i.Missing) > 0 {
+		summary += fmt.Sprintf(", %d missing", len(i.Missing))
+	}
+	if len(i.Unsupported) > 0 {
+		summary += fmt.Sprintf(", %d unsupported", len(i.Unsupported))
+	}
+	if len(i.OutsideRoot) > 0 {
+		summary += fmt.Sprintf(", %d outside root", len(i.OutsideRoot))
+	}
+	return summary
+}
+
+// The subcollection for a track, nested subcollections use slashes so they're swapped out of track names
+func trackSubCollection(track string) string {
+	track = strings.TrimSpace(strings.ReplaceAll(track, "/", "-"))
+	if track == "" {
+		return ""
+	}
+	return "/" + track
+}
+
+// Whether a file sits somewhere beneath the root, the only place tags can point
+func (s *Server) isInRoot(filePath string) bool {
+	rel, err := filepath.Rel(s.State.Root, filePath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// The id of a user's collection with the given name, or 0 when there isn't one
+func (s *Server) getCollectionIdByName(name string) int {
+	row := s.Db.QueryRow(`select id from Collection where user_id = ? and name = ? order by id asc limit 1`, s.User.Id, name)
+	var id int
+	if err := row.Scan(&id); err != nil {
+		if err != sql.ErrNoRows {
+			log.Fatalf("Failed to scan row in getCollectionIdByName: %v", err)
+		}
+		return 0
+	}
+	return id
+}
+
+// Tag a file in a collection inside a transaction, returning whether a new collection tag was made
+func addCollectionTagInTx(tx *sql.Tx, userId int, filePath string, collectionId int, name string, subCollection string) bool {
+	if _, err := tx.Exec(`insert or ignore into Tag (file_path, user_id) values (?, ?)`, filePath, userId); err != nil {
+		tx.Rollback()
+		log.Fatalf("Failed to execute SQL statement in addCollectionTagInTx: %v", err)
+	}
+	var tagId int
+	if err := tx.QueryRow(`select id from Tag where file_path = ?`, filePath).Scan(&tagId); err != nil {
+		tx.Rollback()
+		log.Fatalf("Failed to scan row in addCollectionTagInTx: %v", err)
+	}
+	res, err := tx.Exec(`insert or ignore into CollectionTag (tag_id, collection_id, name, sub_collection) values (?, ?, ?, ?)`, tagId, collectionId, name, subCollection)
+	if err != nil {
+		tx.Rollback()
+		log.Fatalf("Failed to execute SQL statement in addCollectionTagInTx: %v", err)
+	}
+	added, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		log.Fatalf("Failed to get rows affected in addCollectionTagInTx: %v", err)
+	}
+	return added > 0
+}
+
+// Create a collection named after a DAW session, or add to it if it already exists, with a tag for every sample the
+// session uses in a subcollection named after its track. The collection becomes the target collection.
+func (s *Server) ImportSession(path string) (SessionImport, error) {
+	parsed, err := session.Parse(core.ExpandPath(path))
+	if err != nil {
+		return SessionImport{}, err
+	}
+	result := SessionImport{Missing: make([]string, 0), Unsupported: make([]string, 0), OutsideRoot: make([]string, 0)}
+	changes := make([]JournalChange, 0, len(parsed.Samples)+1)
+	collectionId := s.getCollectionIdByName(parsed.Name)
+	if collectionId == 0 {
+		description := fmt.Sprintf("samples used in %s", filepath.Base(parsed.Path))
+		collectionId = s.createCollection(parsed.Name, description)
+		changes = append(changes, JournalChange{Kind: changeCreateCollection, CollectionId: collectionId, Name: parsed.Name, Description: description})
+	}
+	tx, err := s.Db.Begin()
+	if err != nil {
+		log.Fatalf("Failed to begin transaction in importSession: %v", err)
+	}
+	for _, sample := range parsed.Samples {
+		switch {
+		case sample.Missing:
+			result.Missing = append(result.Missing, sample.Path)
+		case !core.IsAudioFile(sample.Path):
+			result.Unsupported = append(result.Unsupported, sample.Path)
+		case !s.isInRoot(sample.Path):
+			result.OutsideRoot = append(result.OutsideRoot, sample.Path)
+		default:
+			if addCollectionTagInTx(tx, s.User.Id, sample.Path, collectionId, filepath.Base(sample.Path), trackSubCollection(sample.Track)) {
+				changes = append(changes, tagChange(sample.Path, collectionId, filepath.Base(sample.Path), trackSubCollection(sample.Track)))
+				result.Added++
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("Failed to commit transaction in importSession: %v", err)
+	}
+	s.journal("import "+parsed.Name, changes...)
+	for _, missing := range result.Missing {
+		log.Printf("Session %s uses %s, which couldn't be found", parsed.Name, missing)
+	}
+	for _, outside := range result.OutsideRoot {
+		log.Printf("Session %s uses %s, which is outside the root", parsed.Name, outside)
+	}
+	for _, collection := range s.GetCollections() {
+		if collection.Id() == collectionId {
+			result.Collection = collection
+			s.UpdateTargetCollection(collection)
+		}
+	}
+	s.UpdateChoices()
+	return result, nil
+}
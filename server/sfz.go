@@ -0,0 +1,280 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jesses-code-adventures/excavator/audio"
+	"github.com/jesses-code-adventures/excavator/core"
+)
+
+// ////////////////////// SFZ EXPORTS ////////////////////////
+
+// Where chromatic mappings start, C3 in excavator's note names
+const sfzFirstKey = 60
+
+// General MIDI drum notes for each drum category, in order of preference
+var gmDrumNotes = map[audio.Category][]int{
+	audio.Kick:  {36, 35},
+	audio.Snare: {38, 40, 37},
+	audio.Clap:  {39},
+	audio.Hat:   {42, 44, 46},
+	audio.Perc:  {41, 43, 45, 47, 48, 50, 54, 56, 60, 61, 62, 63, 64, 75, 82},
+}
+
+// General MIDI drum notes for more specific words in a sample's name
+var gmDrumTokenNotes = map[string][]int{
+	"open": {46}, "ohh": {46}, "oh": {46},
+	"crash": {49, 57}, "ride": {51, 59}, "cymbal": {49, 57},
+	"rim": {37}, "rimshot": {37}, "sidestick": {37},
+	"tom": {41, 43, 45, 47, 48, 50}, "toms": {41, 43, 45, 47, 48, 50},
+	"tamb": {54}, "tambourine": {54}, "cowbell": {56},
+	"bongo": {60, 61}, "conga": {62, 63, 64}, "clave": {75}, "shaker": {82, 70},
+}
+
+// A sample placed in an sfz instrument
+type sfzRegion struct {
+	sample string // relative to the sfz file
+	key    int
+	lokey  int
+	hikey  int
+}
+
+// The regions for one subcollection
+type sfzGroup struct {
+	name    string
+	drums   bool
+	regions []sfzRegion
+}
+
+// A sample waiting to be mapped, with what we know about it
+type sfzSample struct {
+	destination string
+	name        string
+	category    audio.Category
+	rootNote    int
+}
+
+// Write .sfz instruments referencing the files an export has just written, one per collection or one per
+// subcollection depending on the export's kind. Each sfz sits beside the folder it plays from.
+func (s *Server) exportSfz(plan exportPlan, export core.Export, profile *ExportProfile, report *ExportReport) {
+	root := core.ExpandPath(export.Path())
+	files := make(map[string][]string)
+	groups := make(map[string]map[string][]sfzSample)
+	order := make([]string, 0)
+	for _, item := range plan.items {
+		if _, err := os.Lstat(item.destination); err != nil {
+			// the file failed to export, which has already been reported
+			continue
+		}
+		dir := path.Dir(item.destination)
+		sfzPath := path.Join(root, strings.SplitN(strings.TrimPrefix(dir, root+"/"), "/", 2)[0]) + ".sfz"
+		if export.Kind == core.ExportSfzPerSubCollection {
+			sfzPath = dir + ".sfz"
+		}
+		if profile != nil {
+			sfzPath = path.Join(path.Dir(sfzPath), profile.FixName(path.Base(sfzPath)))
+		}
+		if _, ok := groups[sfzPath]; !ok {
+			groups[sfzPath] = make(map[string][]sfzSample)
+			order = append(order, sfzPath)
+		}
+		if _, ok := groups[sfzPath][dir]; !ok {
+			files[sfzPath] = append(files[sfzPath], dir)
+		}
+		groups[sfzPath][dir] = append(groups[sfzPath][dir], s.sfzSample(item))
+	}
+	for _, sfzPath := range order {
+		samples := make([][]sfzSample, 0, len(files[sfzPath]))
+		for _, dir := range files[sfzPath] {
+			samples = append(samples, groups[sfzPath][dir])
+		}
+		sfzGroups, err := mapSfzGroups(sfzPath, files[sfzPath], samples)
+		if err == nil {
+			err = writeSfz(sfzPath, sfzGroups)
+		}
+		switch {
+		case errors.Is(err, os.ErrExist):
+			log.Printf("Destination already exists: %s", sfzPath)
+			report.Skipped++
+		case err != nil:
+			report.Fail(sfzPath, err)
+		default:
+			log.Printf("Wrote sfz instrument %s", sfzPath)
+			report.Exported++
+		}
+	}
+}
+
+// Everything needed to map an exported file
+func (s *Server) sfzSample(item exportItem) sfzSample {
+	sample := sfzSample{destination: item.destination, name: item.tag.Name(), rootNote: -1}
+	sample.category = audio.CategoryFromString(s.GetCategory(item.tag.FilePath))
+	if sample.category == audio.Unclassified {
+		sample.category = audio.ClassifyPath(item.tag.FilePath)
+	}
+	if metadata, err := s.GetMetadata(item.tag.FilePath); err == nil {
+		sample.rootNote = metadata.RootNote
+	}
+	return sample
+}
+
+// Whether most of a subcollection's samples are drum hits
+func isDrumGroup(samples []sfzSample) bool {
+	drums := 0
+	for _, sample := range samples {
+		if _, ok := gmDrumNotes[sample.category]; ok {
+			drums++
+		}
+	}
+	return drums*2 > len(samples)
+}
+
+// Give every sample in an sfz a key. Drum subcollections take General MIDI notes first, then everything else is
+// laid out by root note when a single subcollection has a distinct root for every sample, or chromatically otherwise.
+func mapSfzGroups(sfzPath string, dirs []string, samples [][]sfzSample) ([]sfzGroup, error) {
+	used := make(map[int]bool)
+	groups := make([]sfzGroup, len(dirs))
+	relative := func(destination string) string {
+		rel, err := filepath.Rel(filepath.Dir(sfzPath), destination)
+		if err != nil {
+			return destination
+		}
+		return filepath.ToSlash(rel)
+	}
+	for i, dir := range dirs {
+		groups[i] = sfzGroup{name: path.Base(dir), drums: isDrumGroup(samples[i])}
+		if !groups[i].drums {
+			continue
+		}
+		for _, sample := range samples[i] {
+			key := nextFreeKey(drumNoteCandidates(sample), used)
+			if key < 0 {
+				return nil, errors.New(fmt.Sprintf("ran out of keys mapping %s", sample.name))
+			}
+			used[key] = true
+			groups[i].regions = append(groups[i].regions, sfzRegion{sample: relative(sample.destination), key: key, lokey: key, hikey: key})
+		}
+	}
+	melodic := make([]int, 0)
+	for i := range groups {
+		if !groups[i].drums {
+			melodic = append(melodic, i)
+		}
+	}
+	if len(melodic) == 1 && len(used) == 0 && hasDistinctRootNotes(samples[melodic[0]]) {
+		groups[melodic[0]].regions = rootNoteRegions(samples[melodic[0]], relative)
+		return groups, nil
+	}
+	chromatic := make([]int, 0, 128)
+	for key := sfzFirstKey; key < 128; key++ {
+		chromatic = append(chromatic, key)
+	}
+	for key := sfzFirstKey - 1; key >= 0; key-- {
+		chromatic = append(chromatic, key)
+	}
+	for _, i := range melodic {
+		for _, sample := range samples[i] {
+			key := nextFreeKey(chromatic, used)
+			if key < 0 {
+				return nil, errors.New(fmt.Sprintf("ran out of keys mapping %s", sample.name))
+			}
+			used[key] = true
+			groups[i].regions = append(groups[i].regions, sfzRegion{sample: relative(sample.destination), key: key, lokey: key, hikey: key})
+		}
+	}
+	return groups, nil
+}
+
+// Notes a drum sample would like, most specific first, falling back to anything in the drum range
+func drumNoteCandidates(sample sfzSample) []int {
+	candidates := make([]int, 0)
+	for _, token := range audio.Tokens(strings.TrimSuffix(sample.name, path.Ext(sample.name))) {
+		candidates = append(candidates, gmDrumTokenNotes[token]...)
+	}
+	candidates = append(candidates, gmDrumNotes[sample.category]...)
+	for key := 35; key < 128; key++ {
+		candidates = append(candidates, key)
+	}
+	for key := 34; key >= 0; key-- {
+		candidates = append(candidates, key)
+	}
+	return candidates
+}
+
+// The first candidate that isn't already taken, or -1
+func nextFreeKey(candidates []int, used map[int]bool) int {
+	for _, key := range candidates {
+		if !used[key] {
+			return key
+		}
+	}
+	return -1
+}
+
+// Whether every sample has its own known root note
+func hasDistinctRootNotes(samples []sfzSample) bool {
+	seen := make(map[int]bool)
+	for _, sample := range samples {
+		if sample.rootNote < 0 || seen[sample.rootNote] {
+			return false
+		}
+		seen[sample.rootNote] = true
+	}
+	return len(samples) > 0
+}
+
+// Key zones centred on each sample's root note, splitting the keyboard halfway between neighbours
+func rootNoteRegions(samples []sfzSample, relative func(string) string) []sfzRegion {
+	sorted := slices.Clone(samples)
+	slices.SortFunc(sorted, func(a, b sfzSample) int {
+		return a.rootNote - b.rootNote
+	})
+	regions := make([]sfzRegion, len(sorted))
+	for i, sample := range sorted {
+		lokey, hikey := 0, 127
+		if i > 0 {
+			lokey = (sorted[i-1].rootNote+sample.rootNote)/2 + 1
+		}
+		if i < len(sorted)-1 {
+			hikey = (sample.rootNote + sorted[i+1].rootNote) / 2
+		}
+		regions[i] = sfzRegion{sample: relative(sample.destination), key: sample.rootNote, lokey: lokey, hikey: hikey}
+	}
+	return regions
+}
+
+// Write an sfz file, refusing to replace one that's already there
+func writeSfz(sfzPath string, groups []sfzGroup) error {
+	var b strings.Builder
+	b.WriteString("// written by excavator\n")
+	// sample goes last on each line as its value may contain spaces
+	for _, group := range groups {
+		fmt.Fprintf(&b, "\n<group> // %s\n", group.name)
+		if group.drums {
+			b.WriteString("loop_mode=one_shot\n")
+		}
+		for _, region := range group.regions {
+			if region.lokey == region.hikey {
+				fmt.Fprintf(&b, "<region> key=%d sample=%s\n", region.key, region.sample)
+			} else {
+				fmt.Fprintf(&b, "<region> lokey=%d hikey=%d pitch_keycenter=%d sample=%s\n", region.lokey, region.hikey, region.key, region.sample)
+			}
+		}
+	}
+	f, err := os.OpenFile(sfzPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
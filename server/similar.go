@@ -0,0 +1,163 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/jesses-code-adventures/excavator/audio"
+	"github.com/jesses-code-adventures/excavator/core"
+)
+
+// ////////////////////// SIMILAR SOUNDS ////////////////////////
+
+// How many neighbours a similarity search returns
+const similarResults = 50
+
+// Where to look for sounds similar to a reference sample
+type SimilarityScope int
+
+const (
+	ScopeCurrentDir SimilarityScope = iota
+	ScopeRoot
+	ScopeCollection
+)
+
+func (s SimilarityScope) String() string {
+	return [...]string{"current dir", "root", "target collection"}[s]
+}
+
+// Files a similarity search should compare against
+func (s *Server) SimilarityScopeFiles(scope SimilarityScope) ([]string, error) {
+	switch scope {
+	case ScopeCurrentDir:
+		return ListAudioFiles(s.State.Dir)
+	case ScopeRoot:
+		return ListAudioFiles(s.State.Root)
+	case ScopeCollection:
+		seen := make(map[string]bool)
+		files := make([]string, 0)
+		for _, tag := range s.GetCollectionTags(s.User.TargetCollection.Id()) {
+			if !seen[tag.FilePath] {
+				seen[tag.FilePath] = true
+				files = append(files, tag.FilePath)
+			}
+		}
+		return files, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unknown similarity scope: %d", scope))
+}
+
+// Cached features for every file, keyed by path, along with the mod time they were computed at
+func (s *Server) GetFeaturesFromDb() (map[string]audio.Features, map[string]int64, error) {
+	statement := `select file_path, mod_time, centroid, rolloff, duration, attack, envelope from Features`
+	rows, err := s.Db.Query(statement)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	features := make(map[string]audio.Features)
+	modTimes := make(map[string]int64)
+	for rows.Next() {
+		var filePath string
+		var modTime int64
+		var f audio.Features
+		var envelope []byte
+		if err := rows.Scan(&filePath, &modTime, &f.Centroid, &f.Rolloff, &f.Duration, &f.Attack, &envelope); err != nil {
+			return nil, nil, err
+		}
+		f.Envelope, err = audio.EnvelopeFromBytes(envelope)
+		if err != nil {
+			continue
+		}
+		features[filePath] = f
+		modTimes[filePath] = modTime
+	}
+	return features, modTimes, rows.Err()
+}
+
+// Get features for each file, extracting and storing them for files that are new or have changed
+func (s *Server) IndexFeatures(files []string) (map[string]audio.Features, error) {
+	cached, cachedModTimes, err := s.GetFeaturesFromDb()
+	if err != nil {
+		return nil, err
+	}
+	features := make(map[string]audio.Features)
+	modTimes := make(map[string]int64)
+	stale := make([]string, 0)
+	for _, file := range files {
+		modTime, err := fileModTime(file)
+		if err != nil {
+			continue
+		}
+		if f, ok := cached[file]; ok && cachedModTimes[file] == modTime {
+			features[file] = f
+			continue
+		}
+		modTimes[file] = modTime
+		stale = append(stale, file)
+	}
+	log.Printf("extracting features from %d of %d files", len(stale), len(files))
+	extracted := make(map[string]audio.Features)
+	var mu sync.Mutex
+	forEachFileParallel(stale, func(file string) {
+		f, err := audio.NewFeatures(file)
+		if err != nil {
+			log.Printf("Failed to extract features from %s: %v", file, err)
+			return
+		}
+		mu.Lock()
+		extracted[file] = f
+		mu.Unlock()
+	})
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	statement := `insert or replace into Features (file_path, mod_time, centroid, rolloff, duration, attack, envelope) values (?, ?, ?, ?, ?, ?, ?)`
+	for file, f := range extracted {
+		if _, err := tx.Exec(statement, file, modTimes[file], f.Centroid, f.Rolloff, f.Duration, f.Attack, f.EnvelopeBytes()); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		features[file] = f
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return features, nil
+}
+
+// The nearest neighbours of a sample within a scope, closest first
+func (s *Server) FindSimilar(filePath string, scope SimilarityScope) ([]core.SelectableListItem, error) {
+	files, err := s.SimilarityScopeFiles(scope)
+	if err != nil {
+		return nil, err
+	}
+	features, err := s.IndexFeatures(append(files, filePath))
+	if err != nil {
+		return nil, err
+	}
+	reference, ok := features[filePath]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Couldn't extract features from %s", filePath))
+	}
+	similar := make([]core.SimilarSound, 0, len(features))
+	for _, file := range files {
+		f, ok := features[file]
+		if !ok || file == filePath {
+			continue
+		}
+		similar = append(similar, core.NewSimilarSound(file, reference.Distance(f)))
+	}
+	sort.Slice(similar, func(i, j int) bool {
+		return similar[i].Distance < similar[j].Distance
+	})
+	items := make([]core.SelectableListItem, 0, similarResults)
+	for i := 0; i < len(similar) && i < similarResults; i++ {
+		items = append(items, similar[i])
+	}
+	return items, nil
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// ////////////////////// DIRECTORY TAGGING ////////////////////////
+
+// How tagging a directory went
+type DirectoryTag struct {
+	Dir   string
+	Added int
+	Total int
+}
+
+// A one line summary for the status bar
+func (d DirectoryTag) String() string {
+	return fmt.Sprintf("%s: %d of %d files added", filepath.Base(d.Dir), d.Added, d.Total)
+}
+
+// The subcollection a file beneath a tagged directory goes in when subfolders are mirrored, so dir/kicks/hard/a.wav
+// tagged into /drums lands in /drums/kicks/hard
+func mirroredSubCollection(dir string, filePath string, subCollection string) string {
+	rel, err := filepath.Rel(dir, filepath.Dir(filePath))
+	if err != nil || rel == "." {
+		return subCollection
+	}
+	return strings.TrimSuffix(subCollection, "/") + "/" + filepath.ToSlash(rel)
+}
+
+// Tag every audio file beneath a directory into the target collection in one transaction. When mirror is set each
+// file's subfolder, relative to dir, is added to the end of the subcollection.
+func (s *Server) TagDirectory(dir string, subCollection string, mirror bool) (DirectoryTag, error) {
+	result := DirectoryTag{Dir: dir}
+	if s.User.TargetCollection.Id() == 0 {
+		return result, errors.New("no target collection set")
+	}
+	if len(subCollection) > 0 && !strings.HasPrefix(subCollection, "/") {
+		subCollection = "/" + subCollection
+	}
+	files, err := ListAudioFiles(dir)
+	if err != nil {
+		return result, err
+	}
+	result.Total = len(files)
+	tx, err := s.Db.Begin()
+	if err != nil {
+		log.Fatalf("Failed to begin transaction in tagDirectory: %v", err)
+	}
+	changes := make([]JournalChange, 0, len(files))
+	for _, filePath := range files {
+		fileSubCollection := subCollection
+		if mirror {
+			fileSubCollection = mirroredSubCollection(dir, filePath, subCollection)
+		}
+		if addCollectionTagInTx(tx, s.User.Id, filePath, s.User.TargetCollection.Id(), filepath.Base(filePath), fileSubCollection) {
+			changes = append(changes, tagChange(filePath, s.User.TargetCollection.Id(), filepath.Base(filePath), fileSubCollection))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("Failed to commit transaction in tagDirectory: %v", err)
+	}
+	s.journal("tag "+filepath.Base(dir), changes...)
+	result.Added = len(changes)
+	log.Printf("tagged %d files beneath %s into %s", result.Added, dir, s.User.TargetCollection.Name())
+	return result, nil
+}
+
+// Remove every file at or beneath a path from the target collection, whatever subcollection it's in
+func (s *Server) UntagPath(filePath string) (int, error) {
+	if s.User.TargetCollection.Id() == 0 {
+		return 0, errors.New("no target collection set")
+	}
+	tx, err := s.Db.Begin()
+	if err != nil {
+		log.Fatalf("Failed to begin transaction in untagPath: %v", err)
+	}
+	removed := untagPathInTx(tx, s.User.TargetCollection.Id(), filePath)
+	if err := tx.Commit(); err != nil {
+		log.Fatalf("Failed to commit transaction in untagPath: %v", err)
+	}
+	s.journal("untag "+filepath.Base(filePath), removed...)
+	log.Printf("untagged %d files beneath %s from %s", len(removed), filePath, s.User.TargetCollection.Name())
+	return len(removed), nil
+}
+
+// Remove the collection tags, and any exports of them, for every file at or beneath a path, returning what was
+// removed
+func untagPathInTx(tx *sql.Tx, collectionId int, filePath string) []JournalChange {
+	prefix := filePath + string(filepath.Separator)
+	where := `where ct.collection_id = ? and (t.file_path = ? or substr(t.file_path, 1, length(?)) = ?)`
+	rows, err := tx.Query(`select t.file_path, ct.name, ct.sub_collection from CollectionTag ct join Tag t on ct.tag_id = t.id `+where, collectionId, filePath, prefix, prefix)
+	if err != nil {
+		tx.Rollback()
+		log.Fatalf("Failed to execute SQL statement in untagPathInTx: %v", err)
+	}
+	removed := make([]JournalChange, 0)
+	for rows.Next() {
+		change := JournalChange{Kind: changeUntag, CollectionId: collectionId}
+		if err := rows.Scan(&change.FilePath, &change.Name, &change.SubCollection); err != nil {
+			rows.Close()
+			tx.Rollback()
+			log.Fatalf("Failed to scan row in untagPathInTx: %v", err)
+		}
+		removed = append(removed, change)
+	}
+	rows.Close()
+	tagged := `select ct.id from CollectionTag ct join Tag t on ct.tag_id = t.id ` + where
+	for _, statement := range []string{
+		`delete from ExportTag where collection_tag_id in (` + tagged + `)`,
+		`delete from CollectionTag where id in (` + tagged + `)`,
+	} {
+		if _, err := tx.Exec(statement, collectionId, filePath, prefix, prefix); err != nil {
+			tx.Rollback()
+			log.Fatalf("Failed to execute SQL statement in untagPathInTx: %v", err)
+		}
+	}
+	return removed
+}
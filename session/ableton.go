@@ -0,0 +1,437 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ////////////////////// ABLETON LIVE ////////////////////////
+
+// Reads Ableton Live sets (.als), which are gzip compressed xml
+type AbletonParser struct{}
+
+// Elements holding a track, whose Name child holds the name shown in Live
+var abletonTracks = map[string]bool{
+	"AudioTrack":  true,
+	"MidiTrack":   true,
+	"GroupTrack":  true,
+	"ReturnTrack": true,
+	"MasterTrack": true,
+	"MainTrack":   true,
+}
+
+// File types Live can load as samples
+var abletonSampleExtensions = map[string]bool{
+	".wav": true, ".aif": true, ".aiff": true, ".flac": true, ".mp3": true, ".ogg": true,
+}
+
+func (p AbletonParser) Name() string {
+	return "ableton live"
+}
+
+func (p AbletonParser) CanParse(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".als"
+}
+
+// Where a FileRef element says its file is. Live 11 and up store a Path and a RelativePath string, older
+// versions store the directories as a list of elements plus a Name.
+type abletonFileRef struct {
+	path         string
+	relativePath string
+	relativeDirs []string
+	hintDirs     []string
+	name         string
+	size         int64
+}
+
+// Every place the file could be, most trustworthy first
+func (f abletonFileRef) candidates(setDir string, projectDir string) []string {
+	candidates := make([]string, 0, 6)
+	if f.path != "" {
+		candidates = append(candidates, filepath.FromSlash(f.path))
+	}
+	relative := f.relativePath
+	if relative == "" && f.name != "" {
+		dirs := make([]string, len(f.relativeDirs))
+		for i, dir := range f.relativeDirs {
+			// an empty directory means the parent
+			if dir == "" {
+				dir = ".."
+			}
+			dirs[i] = dir
+		}
+		relative = filepath.Join(append(dirs, f.name)...)
+	}
+	if relative != "" && !filepath.IsAbs(relative) {
+		candidates = append(candidates, filepath.Join(projectDir, relative), filepath.Join(setDir, relative))
+	}
+	if len(f.hintDirs) > 0 && f.name != "" {
+		candidates = append(candidates, string(filepath.Separator)+filepath.Join(append(f.hintDirs, f.name)...))
+	}
+	return candidates
+}
+
+// The file name the reference points at, whichever format it was stored in
+func (f abletonFileRef) fileName() string {
+	if f.name != "" {
+		return f.name
+	}
+	if f.path != "" {
+		return filepath.Base(filepath.FromSlash(f.path))
+	}
+	return filepath.Base(filepath.FromSlash(f.relativePath))
+}
+
+// The folder holding the set's "Ableton Project Info", or the set's own folder when there isn't one
+func abletonProjectDir(setDir string) string {
+	for dir := setDir; ; dir = filepath.Dir(dir) {
+		if info, err := os.Stat(filepath.Join(dir, "Ableton Project Info")); err == nil && info.IsDir() {
+			return dir
+		}
+		if filepath.Dir(dir) == dir {
+			return setDir
+		}
+	}
+}
+
+// Open a set, decompressing it unless it was saved as plain xml
+func openAbletonSet(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(f)
+	magic, err := r.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{gz, f}, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, f}, nil
+}
+
+// The value attribute Live puts on most elements
+func valueAttr(element xml.StartElement) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == "Value" {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// The element with one of its attributes changed, or added if it wasn't there
+func withAttr(element xml.StartElement, name string, value string) xml.StartElement {
+	element = element.Copy()
+	for i, attr := range element.Attr {
+		if attr.Name.Local == name {
+			element.Attr[i].Value = value
+			return element
+		}
+	}
+	element.Attr = append(element.Attr, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+	return element
+}
+
+// Read a FileRef from its tokens, the first being the FileRef itself
+func readAbletonFileRef(tokens []xml.Token) abletonFileRef {
+	ref := abletonFileRef{}
+	depth := 0
+	parents := make([]string, 0, 4)
+	for _, token := range tokens {
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			parent := ""
+			if len(parents) > 0 {
+				parent = parents[len(parents)-1]
+			}
+			parents = append(parents, t.Name.Local)
+			switch name := t.Name.Local; {
+			case depth == 2 && name == "Path":
+				ref.path = valueAttr(t)
+			case depth == 2 && name == "RelativePath":
+				ref.relativePath = valueAttr(t)
+			case depth == 2 && name == "Name":
+				ref.name = valueAttr(t)
+			case name == "OriginalFileSize" || (name == "FileSize" && parent == "SearchHint"):
+				if size, err := strconv.ParseInt(valueAttr(t), 10, 64); err == nil && size > 0 {
+					ref.size = size
+				}
+			case name == "RelativePathElement":
+				dir := ""
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "Dir" {
+						dir = attr.Value
+					}
+				}
+				if parent == "PathHint" {
+					ref.hintDirs = append(ref.hintDirs, dir)
+				} else {
+					ref.relativeDirs = append(ref.relativeDirs, dir)
+				}
+			}
+		case xml.EndElement:
+			depth--
+			parents = parents[:len(parents)-1]
+		}
+	}
+	return ref
+}
+
+// The directories of a path as RelativePathElements, an empty directory meaning the parent
+func abletonPathElements(dirs []string) []xml.Token {
+	tokens := make([]xml.Token, 0, len(dirs)*2)
+	for i, dir := range dirs {
+		if dir == ".." {
+			dir = ""
+		}
+		element := xml.StartElement{Name: xml.Name{Local: "RelativePathElement"}, Attr: []xml.Attr{
+			{Name: xml.Name{Local: "Id"}, Value: strconv.Itoa(i)},
+			{Name: xml.Name{Local: "Dir"}, Value: dir},
+		}}
+		tokens = append(tokens, element, element.End())
+	}
+	return tokens
+}
+
+// Point a FileRef's tokens at a new file, in whichever format the set stored it
+func rewriteAbletonFileRef(tokens []xml.Token, newPath string, projectDir string) []xml.Token {
+	relative, err := filepath.Rel(projectDir, newPath)
+	if err != nil {
+		relative = newPath
+	}
+	relativeDirs := strings.Split(filepath.ToSlash(filepath.Dir(relative)), "/")
+	if relativeDirs[0] == "." {
+		relativeDirs = relativeDirs[:0]
+	}
+	hintDirs := strings.Split(strings.Trim(filepath.ToSlash(filepath.Dir(newPath)), "/"), "/")
+	hasHint := len(readAbletonFileRef(tokens).hintDirs) > 0
+	relativeIsList := true
+	rewritten := make([]xml.Token, 0, len(tokens))
+	depth := 0
+	parents := make([]string, 0, 4)
+	for _, token := range tokens {
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			parent := ""
+			if len(parents) > 0 {
+				parent = parents[len(parents)-1]
+			}
+			parents = append(parents, t.Name.Local)
+			switch name := t.Name.Local; {
+			case depth == 2 && name == "Path":
+				token = withAttr(t, "Value", filepath.ToSlash(newPath))
+			case depth == 2 && name == "RelativePath":
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "Value" {
+						relativeIsList = false
+						token = withAttr(t, "Value", filepath.ToSlash(relative))
+					}
+				}
+			case depth == 2 && name == "Name":
+				token = withAttr(t, "Value", filepath.Base(newPath))
+			case name == "RelativePathElement" && (parent == "RelativePath" || parent == "PathHint"):
+				// replaced as a whole list when the parent closes
+				token = nil
+			}
+		case xml.EndElement:
+			parent := ""
+			if len(parents) > 1 {
+				parent = parents[len(parents)-2]
+			}
+			switch {
+			case t.Name.Local == "RelativePathElement" && (parent == "RelativePath" || parent == "PathHint"):
+				token = nil
+			case depth == 2 && t.Name.Local == "RelativePath" && relativeIsList:
+				rewritten = append(rewritten, abletonPathElements(relativeDirs)...)
+			case t.Name.Local == "PathHint" && hasHint:
+				rewritten = append(rewritten, abletonPathElements(hintDirs)...)
+			}
+			depth--
+			parents = parents[:len(parents)-1]
+		}
+		if token != nil {
+			rewritten = append(rewritten, token)
+		}
+	}
+	return rewritten
+}
+
+// Stream through a set, handing every FileRef's tokens to onRef along with the name of the track it sits under and
+// every other token to onToken
+func walkAbletonSet(set io.Reader, onToken func(xml.Token) error, onRef func(tokens []xml.Token, track string) error) error {
+	decoder := xml.NewDecoder(set)
+	var (
+		depth                   int
+		trackDepth              = -1
+		trackNameDepth          = -1
+		effectiveName, userName string
+		refTokens               []xml.Token
+		refDepth                int
+	)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		token = xml.CopyToken(token)
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			name := t.Name.Local
+			switch {
+			case abletonTracks[name] && trackDepth < 0:
+				trackDepth = depth
+				effectiveName, userName = "", ""
+			case name == "Name" && depth == trackDepth+1:
+				trackNameDepth = depth
+			case trackNameDepth > 0 && depth == trackNameDepth+1 && name == "EffectiveName":
+				effectiveName = valueAttr(t)
+			case trackNameDepth > 0 && depth == trackNameDepth+1 && name == "UserName":
+				userName = valueAttr(t)
+			case name == "FileRef" && refTokens == nil:
+				refTokens = make([]xml.Token, 0, 32)
+				refDepth = depth
+			}
+		case xml.EndElement:
+			switch {
+			case depth == trackNameDepth:
+				trackNameDepth = -1
+			case depth == trackDepth:
+				trackDepth = -1
+				effectiveName, userName = "", ""
+			}
+			depth--
+		}
+		if refTokens == nil {
+			if err := onToken(token); err != nil {
+				return err
+			}
+			continue
+		}
+		refTokens = append(refTokens, token)
+		if end, ok := token.(xml.EndElement); ok && end.Name.Local == "FileRef" && depth == refDepth-1 {
+			track := effectiveName
+			if track == "" {
+				track = userName
+			}
+			if err := onRef(refTokens, track); err != nil {
+				return err
+			}
+			refTokens = nil
+		}
+	}
+}
+
+// Where a reference's sample is, or the best guess when it can't be found
+func (f abletonFileRef) resolve(setDir string, projectDir string) (string, bool) {
+	return resolvePath(f.candidates(setDir, projectDir))
+}
+
+// Whether the reference is to something Live plays as a sample, rather than a preset or device
+func (f abletonFileRef) isSample() bool {
+	return abletonSampleExtensions[strings.ToLower(filepath.Ext(f.fileName()))]
+}
+
+// Stream through the set, noting which track each sample reference sits under
+func (p AbletonParser) Parse(path string) (Session, error) {
+	set, err := openAbletonSet(path)
+	if err != nil {
+		return Session{}, err
+	}
+	defer set.Close()
+	setDir := filepath.Dir(path)
+	projectDir := abletonProjectDir(setDir)
+	session := Session{Name: sessionName(path), Path: path, Samples: make([]SampleRef, 0)}
+	seen := make(map[SampleRef]bool)
+	err = walkAbletonSet(set, func(xml.Token) error { return nil }, func(tokens []xml.Token, track string) error {
+		ref := readAbletonFileRef(tokens)
+		if ref.isSample() {
+			resolved, found := ref.resolve(setDir, projectDir)
+			session.add(SampleRef{Path: resolved, Track: track, Missing: !found, Size: ref.size}, seen)
+		}
+		return nil
+	})
+	return session, err
+}
+
+// Write a copy of the set with samples pointed at new files. Live saves both absolute and project relative paths,
+// so both are rewritten.
+func (p AbletonParser) Repair(path string, destination string, replacements map[string]string) (int, error) {
+	set, err := openAbletonSet(path)
+	if err != nil {
+		return 0, err
+	}
+	defer set.Close()
+	setDir := filepath.Dir(path)
+	projectDir := abletonProjectDir(setDir)
+	f, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return 0, err
+	}
+	gz := gzip.NewWriter(f)
+	encoder := xml.NewEncoder(gz)
+	// the encoder escapes tabs, so indentation is written as it was
+	encode := func(token xml.Token) error {
+		if text, ok := token.(xml.CharData); ok && len(bytes.TrimSpace(text)) == 0 {
+			if err := encoder.Flush(); err != nil {
+				return err
+			}
+			_, err := gz.Write(text)
+			return err
+		}
+		return encoder.EncodeToken(token)
+	}
+	repaired := 0
+	err = walkAbletonSet(set, encode, func(tokens []xml.Token, track string) error {
+		ref := readAbletonFileRef(tokens)
+		if ref.isSample() {
+			resolved, _ := ref.resolve(setDir, projectDir)
+			if replacement, ok := replacements[resolved]; ok {
+				tokens = rewriteAbletonFileRef(tokens, replacement, projectDir)
+				repaired++
+			}
+		}
+		for _, token := range tokens {
+			if err := encode(token); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = encoder.Flush()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(destination)
+		return 0, err
+	}
+	return repaired, nil
+}
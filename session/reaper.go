@@ -0,0 +1,203 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ////////////////////// REAPER ////////////////////////
+
+// Reads REAPER projects (.rpp), a plain text format of nested <BLOCK ... > chunks
+type ReaperParser struct{}
+
+func (p ReaperParser) Name() string {
+	return "reaper"
+}
+
+func (p ReaperParser) CanParse(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".rpp"
+}
+
+// Split an rpp line into its fields. REAPER quotes fields containing spaces with whichever of ", ' or ` the value
+// doesn't contain.
+func reaperFields(line string) []string {
+	fields := make([]string, 0, 4)
+	line = strings.TrimSpace(line)
+	for len(line) > 0 {
+		var field string
+		if quote := line[0]; quote == '"' || quote == '\'' || quote == '`' {
+			end := strings.IndexByte(line[1:], quote)
+			if end < 0 {
+				field, line = line[1:], ""
+			} else {
+				field, line = line[1:end+1], line[end+2:]
+			}
+		} else {
+			end := strings.IndexAny(line, " \t")
+			if end < 0 {
+				field, line = line, ""
+			} else {
+				field, line = line[:end], line[end:]
+			}
+		}
+		fields = append(fields, field)
+		line = strings.TrimLeft(line, " \t")
+	}
+	return fields
+}
+
+// The last element of a path saved on any platform
+func reaperBase(path string) string {
+	return path[strings.LastIndexAny(path, `/\`)+1:]
+}
+
+// Every place a media file could be. REAPER looks beside the project and in its record path when a file has moved,
+// so we do the same.
+func reaperCandidates(file string, projectDir string, recordPath string) []string {
+	candidates := make([]string, 0, 4)
+	// windows paths can't be found here, but they're the best guess to report when nothing else turns up
+	if filepath.IsAbs(file) || strings.Contains(file, `:\`) {
+		candidates = append(candidates, file)
+	} else {
+		candidates = append(candidates, filepath.Join(projectDir, filepath.FromSlash(strings.ReplaceAll(file, `\`, "/"))))
+	}
+	base := reaperBase(file)
+	if recordPath != "" {
+		if !filepath.IsAbs(recordPath) {
+			recordPath = filepath.Join(projectDir, recordPath)
+		}
+		candidates = append(candidates, filepath.Join(recordPath, base))
+	}
+	return append(candidates, filepath.Join(projectDir, base))
+}
+
+// A media source in a project and the line it was read from
+type reaperSource struct {
+	file  string
+	track string
+	line  int
+}
+
+// Walk the project's chunks, noting the track each media source sits under
+func scanReaperProject(lines []string) (string, []reaperSource) {
+	sources := make([]reaperSource, 0)
+	recordPath := ""
+	blocks := make([]string, 0, 8)
+	track := ""
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "<"):
+			fields := reaperFields(line[1:])
+			name := ""
+			if len(fields) > 0 {
+				name = fields[0]
+			}
+			if name == "TRACK" {
+				track = ""
+			}
+			blocks = append(blocks, name)
+		case line == ">":
+			if len(blocks) > 0 {
+				if blocks[len(blocks)-1] == "TRACK" {
+					track = ""
+				}
+				blocks = blocks[:len(blocks)-1]
+			}
+		case len(blocks) > 0:
+			fields := reaperFields(line)
+			if len(fields) < 2 {
+				continue
+			}
+			switch parent := blocks[len(blocks)-1]; {
+			case parent == "REAPER_PROJECT" && fields[0] == "RECORD_PATH":
+				recordPath = fields[1]
+			case parent == "TRACK" && fields[0] == "NAME":
+				track = fields[1]
+			case parent == "SOURCE" && fields[0] == "FILE":
+				sources = append(sources, reaperSource{file: fields[1], track: track, line: i})
+			}
+		}
+	}
+	return recordPath, sources
+}
+
+// Read a project's lines, keeping any carriage returns so a repaired copy matches the original
+func readReaperLines(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(string(data), "\n"), nil
+}
+
+// Quote a field with a character it doesn't contain, as REAPER does
+func reaperQuote(value string) string {
+	for _, quote := range []string{`"`, "'", "`"} {
+		if !strings.Contains(value, quote) {
+			return quote + value + quote
+		}
+	}
+	return value
+}
+
+func (p ReaperParser) Parse(path string) (Session, error) {
+	lines, err := readReaperLines(path)
+	if err != nil {
+		return Session{}, err
+	}
+	projectDir := filepath.Dir(path)
+	session := Session{Name: sessionName(path), Path: path, Samples: make([]SampleRef, 0)}
+	seen := make(map[SampleRef]bool)
+	// the record path can come after the tracks, so sources are resolved once the whole project is read
+	recordPath, sources := scanReaperProject(lines)
+	for _, src := range sources {
+		resolved, found := resolvePath(reaperCandidates(src.file, projectDir, recordPath))
+		session.add(SampleRef{Path: resolved, Track: src.track, Missing: !found}, seen)
+	}
+	return session, nil
+}
+
+// Write a copy of the project with FILE lines pointed at new files, leaving every other line as it was
+func (p ReaperParser) Repair(path string, destination string, replacements map[string]string) (int, error) {
+	lines, err := readReaperLines(path)
+	if err != nil {
+		return 0, err
+	}
+	projectDir := filepath.Dir(path)
+	recordPath, sources := scanReaperProject(lines)
+	repaired := 0
+	for _, src := range sources {
+		resolved, _ := resolvePath(reaperCandidates(src.file, projectDir, recordPath))
+		replacement, ok := replacements[resolved]
+		if !ok {
+			continue
+		}
+		line := lines[src.line]
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		fields := reaperFields(line)
+		fields[1] = replacement
+		for i, field := range fields {
+			if i == 1 || field == "" || strings.ContainsAny(field, " \t") {
+				fields[i] = reaperQuote(field)
+			}
+		}
+		lines[src.line] = indent + strings.Join(fields, " ")
+		if strings.HasSuffix(line, "\r") {
+			lines[src.line] += "\r"
+		}
+		repaired++
+	}
+	f, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.WriteString(strings.Join(lines, "\n")); err != nil {
+		f.Close()
+		os.Remove(destination)
+		return 0, err
+	}
+	return repaired, f.Close()
+}
@@ -0,0 +1,117 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ////////////////////// DAW SESSIONS ////////////////////////
+
+// A sample a session refers to and the track that uses it
+type SampleRef struct {
+	Path    string // resolved absolute path, or the best guess when the file couldn't be found
+	Track   string
+	Missing bool
+	Size    int64 // bytes when the session recorded it, else 0
+}
+
+// The samples used by a saved DAW session
+type Session struct {
+	Name    string
+	Path    string
+	Samples []SampleRef
+}
+
+// Reads the samples out of one DAW's session files
+type SessionParser interface {
+	// Name of the DAW, for messages
+	Name() string
+	// Whether the file looks like one of this DAW's sessions
+	CanParse(path string) bool
+	Parse(path string) (Session, error)
+}
+
+// Every DAW we can read, add new parsers here
+var Parsers = []SessionParser{
+	AbletonParser{},
+	ReaperParser{},
+}
+
+// Parsers that can write a copy of a session with some of its samples pointed at new files
+type SessionRepairer interface {
+	// Replacements are keyed by SampleRef.Path, returns how many references were changed
+	Repair(path string, destination string, replacements map[string]string) (int, error)
+}
+
+// Whether any parser can read the file
+func IsSessionFile(path string) bool {
+	_, err := parserFor(path)
+	return err == nil
+}
+
+// Parse a session file with whichever parser understands it
+func Parse(path string) (Session, error) {
+	parser, err := parserFor(path)
+	if err != nil {
+		return Session{}, err
+	}
+	return parser.Parse(path)
+}
+
+// Write a repaired copy of a session with whichever parser understands it
+func Repair(path string, destination string, replacements map[string]string) (int, error) {
+	parser, err := parserFor(path)
+	if err != nil {
+		return 0, err
+	}
+	repairer, ok := parser.(SessionRepairer)
+	if !ok {
+		return 0, errors.New(fmt.Sprintf("Can't repair %s sessions", parser.Name()))
+	}
+	return repairer.Repair(path, destination, replacements)
+}
+
+func parserFor(path string) (SessionParser, error) {
+	for _, parser := range Parsers {
+		if parser.CanParse(path) {
+			return parser, nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("No session parser for %s", filepath.Base(path)))
+}
+
+// The session's file name without its extension
+func sessionName(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// The first candidate path that exists, or the first candidate when none do
+func resolvePath(candidates []string) (string, bool) {
+	for _, candidate := range candidates {
+		if candidate == "" {
+			continue
+		}
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, true
+		}
+	}
+	for _, candidate := range candidates {
+		if candidate != "" {
+			return candidate, false
+		}
+	}
+	return "", false
+}
+
+// Add a sample once per track, keeping the order they were found in
+func (s *Session) add(ref SampleRef, seen map[SampleRef]bool) {
+	if ref.Path == "" || seen[ref] {
+		return
+	}
+	seen[ref] = true
+	s.Samples = append(s.Samples, ref)
+}
@@ -0,0 +1,37 @@
+package window
+
+import (
+	"log"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/jesses-code-adventures/excavator/server"
+)
+
+// ////////////////////// ABLETON BROWSER LABELS ////////////////////////
+
+// Sent when a sync with Live's browser labels has finished
+type AbletonSyncedMsg struct {
+	Sync server.LabelSync
+	Err  error
+}
+
+// Sync labels off the ui thread, it walks the whole root
+func syncAbletonLabels(s *server.Server) tea.Cmd {
+	return func() tea.Msg {
+		sync, err := s.SyncAbletonLabels()
+		return AbletonSyncedMsg{Sync: sync, Err: err}
+	}
+}
+
+// Show how the sync went and refresh the listing so imported tags show up
+func (m Model) HandleAbletonSyncedMsg(msg AbletonSyncedMsg) Model {
+	if msg.Err != nil {
+		log.Printf("Failed to sync ableton labels: %v", msg.Err)
+		return m.SetStatus("ableton", msg.Err.Error())
+	}
+	if m.Window.Name() == Home {
+		m.Server.UpdateChoices()
+	}
+	return m.SetStatus("ableton", msg.Sync.String())
+}
@@ -0,0 +1,38 @@
+package window
+
+import (
+	"log"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/jesses-code-adventures/excavator/server"
+)
+
+// ////////////////////// ANALYSIS ////////////////////////
+
+// Sent when a directory has finished being analysed
+type AnalysedMsg struct {
+	Dir string
+	Err error
+}
+
+// Classify a directory and read its metadata off the ui thread
+func analyseDir(s *server.Server, dir string) tea.Cmd {
+	return func() tea.Msg {
+		return AnalysedMsg{Dir: dir, Err: s.AnalyseDir(dir)}
+	}
+}
+
+// Refresh the home listing and details pane so new categories and metadata show up
+func (m Model) HandleAnalysedMsg(msg AnalysedMsg) Model {
+	if msg.Err != nil {
+		log.Printf("Failed to analyse %s: %v", msg.Dir, msg.Err)
+		return m.SetStatus("analyse", msg.Err.Error())
+	}
+	if m.Window.Name() == Home && m.Server.State.Dir == msg.Dir {
+		m.Server.UpdateChoices()
+	}
+	// force the details pane to pick up the new results once Update requests them
+	m.detailsPath = ""
+	return m
+}
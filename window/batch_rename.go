@@ -0,0 +1,52 @@
+package window
+
+import (
+	"log"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/jesses-code-adventures/excavator/core"
+)
+
+// ////////////////////// BATCH RENAMING ////////////////////////
+
+// Every file in the current listing, which is what a batch rename applies to
+func (m Model) listedFiles() []string {
+	files := make([]string, 0, len(m.Server.State.Choices))
+	for _, choice := range m.Server.State.Choices {
+		if !choice.IsDir() && choice.IsFile() {
+			files = append(files, choice.Path())
+		}
+	}
+	return files
+}
+
+// Work out the batch rename from the form and show it for review before anything is touched
+func (m Model) PreviewBatchRename(msg tea.Msg, cmd tea.Cmd) (Model, tea.Cmd) {
+	plans, err := m.Server.PlanBatchRename(m.renameFiles, m.Form.Inputs[0].Input.Value(), m.Form.Inputs[1].Input.Value(), m.Form.Inputs[2].Input.Value())
+	if err != nil {
+		log.Printf("Failed to plan batch rename: %v", err)
+		m = m.SetStatus("rename", err.Error())
+		return m.GoToHome(msg, cmd)
+	}
+	m.renamePlans = plans
+	return m.SetWindow(msg, cmd, BatchRenamePreviewWindow)
+}
+
+// Apply the previewed batch rename
+func (m Model) ApplyBatchRename(msg tea.Msg, cmd tea.Cmd) (Model, tea.Cmd) {
+	result := m.Server.ApplyBatchRename(m.renamePlans)
+	m.renamePlans = nil
+	m.renameFiles = nil
+	m = m.SetStatus("rename", result.String())
+	return m.GoToHome(msg, cmd)
+}
+
+// The planned renames as list items for the preview
+func (m Model) renamePlanChoices() []core.SelectableListItem {
+	choices := make([]core.SelectableListItem, 0, len(m.renamePlans))
+	for _, plan := range m.renamePlans {
+		choices = append(choices, plan)
+	}
+	return choices
+}
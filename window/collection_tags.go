@@ -0,0 +1,92 @@
+package window
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/jesses-code-adventures/excavator/core"
+)
+
+// ////////////////////// EDITING COLLECTION TAGS ////////////////////////
+
+// The target collection's tags as list items
+func (m Model) collectionTagChoices() []core.SelectableListItem {
+	tags := m.Server.GetCollectionTagsAsListItem(m.Server.User.TargetCollection.Id())
+	choices := make([]core.SelectableListItem, 0, len(tags))
+	for _, tag := range tags {
+		choices = append(choices, tag)
+	}
+	return choices
+}
+
+// Go back to browsing the collection with the cursor on the tag that was being edited
+func (m Model) returnToCollectionTag(msg tea.Msg, cmd tea.Cmd) (Model, tea.Cmd) {
+	m, cmd = m.SetWindow(msg, cmd, BrowseCollectionWindow)
+	for i, choice := range m.Server.State.Choices {
+		if choice.Id() == m.editTag.Id() {
+			m.Cursor = i
+			break
+		}
+	}
+	return m, cmd
+}
+
+// Change the export name of the tag being edited
+func (m Model) RenameCollectionTag(msg tea.Msg, cmd tea.Cmd, name string) (Model, tea.Cmd) {
+	if err := m.Server.RenameCollectionTag(m.editTag.Id(), name); err != nil {
+		log.Printf("Failed to rename tag %s: %v", m.editTag.Name(), err)
+		m = m.SetStatus("tag", err.Error())
+	} else {
+		m = m.SetStatus("tag", "renamed "+m.editTag.Name())
+	}
+	return m.returnToCollectionTag(msg, cmd)
+}
+
+// Move the tag being edited to another subcollection
+func (m Model) MoveCollectionTag(msg tea.Msg, cmd tea.Cmd, subCollection string) (Model, tea.Cmd) {
+	if err := m.Server.MoveCollectionTag(m.editTag.Id(), subCollection); err != nil {
+		log.Printf("Failed to move tag %s: %v", m.editTag.Name(), err)
+		m = m.SetStatus("tag", err.Error())
+	} else {
+		m = m.SetStatus("tag", "moved "+m.editTag.Name())
+	}
+	return m.returnToCollectionTag(msg, cmd)
+}
+
+// Take the tag under the cursor out of the collection
+func (m Model) RemoveCollectionTag() Model {
+	tag, ok := m.Server.State.Choices[m.Cursor].(core.CollectionTag)
+	if !ok {
+		return m
+	}
+	if err := m.Server.RemoveCollectionTag(tag.Id()); err != nil {
+		log.Printf("Failed to remove tag %s: %v", tag.Name(), err)
+		return m.SetStatus("tag", err.Error())
+	}
+	m = m.refreshTags()
+	return m.SetStatus("tag", "removed "+tag.Name())
+}
+
+// Open the directory holding the tagged file under the cursor, with the cursor on the file
+func (m Model) JumpToCollectionTag(msg tea.Msg, cmd tea.Cmd) (Model, tea.Cmd) {
+	if len(m.Server.State.Choices) == 0 {
+		return m, cmd
+	}
+	filePath := m.Server.State.Choices[m.Cursor].Path()
+	if _, err := os.Stat(filepath.Dir(filePath)); err != nil {
+		log.Printf("Failed to open the directory of %s: %v", filePath, err)
+		return m.SetStatus("tag", filepath.Base(filePath)+" is missing"), cmd
+	}
+	m.Server.State.Dir = filepath.Dir(filePath)
+	m, cmd = m.GoToHome(msg, cmd)
+	for i, choice := range m.Server.State.Choices {
+		if choice.Path() == filePath {
+			m.Cursor = i
+			break
+		}
+	}
+	return m, cmd
+}
@@ -39,10 +39,31 @@ const (
 	BrowseCollectionWindow
 	EnterUserWindow
 	EnterRootWindow
+	DuplicatesWindow
+	SimilarCurrentWindow
+	SimilarRootWindow
+	SimilarCollectionWindow
+	ImportSessionWindow
+	RenameWindow
+	MoveWindow
+	BatchRenameWindow
+	BatchRenamePreviewWindow
+	TagDirectoryWindow
+	RenameTagWindow
+	MoveTagWindow
+	ManageCollectionsWindow
+	RenameCollectionWindow
+	DescribeCollectionWindow
+	DuplicateCollectionWindow
+	MergeCollectionWindow
+	DeleteCollectionWindow
+	CombineCollectionsWindow
+	RecipesWindow
+	RecipeWindow
 )
 
 func (w WindowName) String() string {
-	return [...]string{"home", "create collection", "create tag", "target subcollection", "target collection", "recursive search - root", "recursive search - current dir", "create export", "run export", "browse target collection", "create user", "create root"}[w]
+	return [...]string{"home", "create collection", "create tag", "target subcollection", "target collection", "recursive search - root", "recursive search - current dir", "create export", "run export", "browse target collection", "create user", "create root", "duplicates", "similar sounds - current dir", "similar sounds - root", "similar sounds - target collection", "import session", "rename", "move", "batch rename", "batch rename preview", "tag directory", "rename tag", "move tag", "manage collections", "rename collection", "describe collection", "duplicate collection", "merge into", "delete collection", "combine collections", "kit recipes", "kit recipe"}[w]
 }
 
 func (w WindowName) Window() Window {
@@ -107,6 +128,26 @@ func (w WindowName) Window() Window {
 			name:       w,
 			windowType: PreViewport,
 		}
+	case DuplicatesWindow:
+		return Window{
+			name:       w,
+			windowType: SearchableSelectableListWindow,
+		}
+	case SimilarCurrentWindow, SimilarRootWindow, SimilarCollectionWindow:
+		return Window{
+			name:       w,
+			windowType: SearchableSelectableListWindow,
+		}
+	case ImportSessionWindow, RenameWindow, MoveWindow, BatchRenameWindow, TagDirectoryWindow, RenameTagWindow, MoveTagWindow, RenameCollectionWindow, DescribeCollectionWindow, DuplicateCollectionWindow, DeleteCollectionWindow, CombineCollectionsWindow, RecipeWindow:
+		return Window{
+			name:       w,
+			windowType: FormWindow,
+		}
+	case BatchRenamePreviewWindow, ManageCollectionsWindow, MergeCollectionWindow, RecipesWindow:
+		return Window{
+			name:       w,
+			windowType: ListSelectionWindow,
+		}
 	default:
 		log.Fatalf("Unknown window name: %v", w.String())
 	}
@@ -141,7 +182,7 @@ func (w WindowType) FormView(form core.Form) string {
 	return FormStyle.Render(s)
 }
 
-func (w WindowType) SearchableListView(choices []core.SelectableListItem, cursor int, maxWidth int, showCollections bool, input textinput.Model, isBrowseCollectionView bool) string {
+func (w WindowType) SearchableListView(choices []core.SelectableListItem, cursor int, maxWidth int, showCollections bool, input textinput.Model, isBrowseCollectionView bool, selected map[string]bool) string {
 	if w == FormWindow {
 		log.Fatal("Searchable list view called on a form", w)
 	}
@@ -157,6 +198,15 @@ func (w WindowType) SearchableListView(choices []core.SelectableListItem, cursor
 			name = choice.Name()
 			description = choice.Description()
 		}
+		if entry, ok := choice.(core.TaggedDirEntry); ok && entry.Category != "" {
+			name = fmt.Sprintf("%s [%s]", name, entry.Category)
+		}
+		if entry, ok := choice.(core.TaggedDirEntry); ok && entry.Projects > 0 {
+			name = fmt.Sprintf("%s (used in %d)", name, entry.Projects)
+		}
+		if selected[choice.Path()] {
+			name = "+ " + name
+		}
 		if cursor == i {
 			cursor := ">"
 			newLine = fmt.Sprintf("%s %s", cursor, name)
@@ -168,6 +218,12 @@ func (w WindowType) SearchableListView(choices []core.SelectableListItem, cursor
 		}
 		if cursor == i {
 			newLine = SelectedStyle.Render(newLine, fmt.Sprintf("    %v", description))
+		} else if selected[choice.Path()] {
+			if showCollections {
+				newLine = MarkedStyle.Render(newLine, fmt.Sprintf("    %v", description))
+			} else {
+				newLine = MarkedStyle.Render(newLine)
+			}
 		} else {
 			if showCollections {
 				newLine = UnselectedStyle.Render(newLine, fmt.Sprintf("    %v", description))
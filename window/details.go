@@ -0,0 +1,96 @@
+package window
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/jesses-code-adventures/excavator/server"
+)
+
+// ////////////////////// DETAILS ////////////////////////
+
+// Lines of detail shown under the panel's label
+const detailsPanelLines = 7
+
+// Sent when a sample's details have finished loading in the background
+type DetailsMsg struct {
+	Path  string
+	Lines []string
+}
+
+// Load a sample's details off the ui thread, as reading its metadata may mean parsing the file
+func loadDetails(s *server.Server, filePath string) tea.Cmd {
+	return func() tea.Msg {
+		return DetailsMsg{Path: filePath, Lines: s.GetSampleDetails(filePath)}
+	}
+}
+
+// The details pane for the sample under the cursor, kept at a fixed height like the spectrogram
+func (m Model) DetailsPanelView() string {
+	if !m.ShowDetails {
+		return ""
+	}
+	width := max(m.Viewport.Width, 1)
+	label := "details: no file selected"
+	lines := make([]string, 0, detailsPanelLines)
+	if m.detailsPath != "" {
+		label = fmt.Sprintf("details: %s", path.Base(m.detailsPath))
+		lines = append(lines, m.detailLines...)
+		switch {
+		case m.detailLines == nil:
+			lines = append(lines, "loading...")
+		case len(lines) == 0:
+			lines = append(lines, "nothing known about this sample yet")
+		}
+	}
+	if len(lines) > detailsPanelLines {
+		lines = append(lines[:detailsPanelLines-1], fmt.Sprintf("... %d more", len(lines)-detailsPanelLines+1))
+	}
+	for len(lines) < detailsPanelLines {
+		lines = append(lines, "")
+	}
+	// cut by display width, as metadata is often multibyte
+	style := HelpValueStyle.Copy().MaxWidth(width)
+	for i, line := range lines {
+		lines[i] = style.Render(line)
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, HelpKeyStyle.Render(label), strings.Join(lines, "\n"))
+}
+
+// Request the details of whatever is under the cursor, if the pane is open and they aren't already loaded
+func (m Model) RequestDetails(cmd tea.Cmd) (Model, tea.Cmd) {
+	if !m.ShowDetails {
+		return m, cmd
+	}
+	filePath := m.SelectedFilePath()
+	if filePath == m.detailsPath {
+		return m, cmd
+	}
+	m.detailsPath = filePath
+	m.detailLines = nil
+	if filePath == "" {
+		return m, cmd
+	}
+	return m, tea.Batch(cmd, loadDetails(m.Server, filePath))
+}
+
+// Store loaded details if they're still the ones we're waiting for
+func (m Model) HandleDetailsMsg(msg DetailsMsg) Model {
+	if msg.Path != m.detailsPath {
+		return m
+	}
+	m.detailLines = msg.Lines
+	return m
+}
+
+// Open or close the details pane
+func (m Model) ToggleDetails() Model {
+	m.ShowDetails = !m.ShowDetails
+	m.detailsPath = ""
+	m.detailLines = nil
+	return m.ManuallyResizeWindow()
+}
@@ -0,0 +1,57 @@
+package window
+
+import (
+	"log"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/jesses-code-adventures/excavator/core"
+	"github.com/jesses-code-adventures/excavator/server"
+)
+
+// ////////////////////// DUPLICATES ////////////////////////
+
+// Sent when the root has been fingerprinted and duplicates grouped
+type DuplicatesMsg struct {
+	Items []core.SelectableListItem
+	Err   error
+}
+
+// Fingerprint the root off the ui thread, then collect the duplicates
+func indexDuplicates(s *server.Server) tea.Cmd {
+	root := s.State.Root
+	return func() tea.Msg {
+		if err := s.IndexFingerprints(root); err != nil {
+			return DuplicatesMsg{Err: err}
+		}
+		return DuplicatesMsg{Items: s.GetDuplicates()}
+	}
+}
+
+// Fill the duplicates window once indexing is done, unless the user has since moved on
+func (m Model) HandleDuplicatesMsg(msg DuplicatesMsg) Model {
+	if msg.Err != nil {
+		log.Printf("Failed to index fingerprints: %v", msg.Err)
+		return m.SetStatus("duplicates", msg.Err.Error())
+	}
+	if m.Window.Name() != DuplicatesWindow {
+		return m
+	}
+	m.Server.State.Choices = msg.Items
+	m.Cursor = 0
+	return m
+}
+
+// Keep the copy under the cursor, re-pointing tags from the rest of its group onto it
+func (m Model) KeepSelectedDuplicate() Model {
+	if len(m.Server.State.Choices) == 0 {
+		return m
+	}
+	choice := m.Server.State.Choices[m.Cursor]
+	if err := m.Server.KeepDuplicate(choice.Path()); err != nil {
+		log.Printf("Failed to keep duplicate %s: %v", choice.Path(), err)
+	}
+	m.Server.State.Choices = m.Server.GetDuplicates()
+	m.Cursor = min(m.Cursor, max(len(m.Server.State.Choices)-1, 0))
+	return m
+}
@@ -0,0 +1,108 @@
+package window
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/jesses-code-adventures/excavator/audio"
+	"github.com/jesses-code-adventures/excavator/core"
+	"github.com/jesses-code-adventures/excavator/server"
+)
+
+// ////////////////////// EXPORTS ////////////////////////
+
+// Sent when an export run has finished
+type ExportedMsg struct {
+	Name   string
+	Report server.ExportReport
+}
+
+// Export the target collection off the ui thread, transcoding can take a while
+func runExport(s *server.Server, export core.Export, tags []core.CollectionTag) tea.Cmd {
+	return func() tea.Msg {
+		return ExportedMsg{Name: export.Name(), Report: s.ExportCollection(tags, export)}
+	}
+}
+
+// Show how the export went in the status bar
+func (m Model) HandleExportedMsg(msg ExportedMsg) Model {
+	return m.SetStatus("export", msg.Name+": "+msg.Report.String())
+}
+
+// The inputs for the create export form, with defaults that keep the originals untouched
+func exportFormInputs() []core.FormInput {
+	defaults := []struct {
+		name  string
+		value string
+	}{
+		{"name", ""},
+		{"output_dir", ""},
+		{"concrete", ""},
+		{"write_metadata", "false"},
+		{"format", "original"},
+		{"sample_rate", "original"},
+		{"bit_depth", "original"},
+		{"mono", "false"},
+		{"profile", "none"},
+		{"kind", "files"},
+		{"sidecar", "false"},
+	}
+	inputs := make([]core.FormInput, 0, len(defaults))
+	for _, d := range defaults {
+		input := core.NewFormInput(d.name)
+		input.Input.SetValue(d.value)
+		inputs = append(inputs, input)
+	}
+	return inputs
+}
+
+// Build an export from the create export form
+func exportFromForm(form core.Form) core.Export {
+	value := func(i int) string {
+		return strings.TrimSpace(form.Inputs[i].Input.Value())
+	}
+	export := core.NewExport(0, value(0), value(1), parseBoolInput(value(2)))
+	export.WriteMetadata = parseBoolInput(value(3))
+	switch kind := strings.ToLower(value(9)); kind {
+	case core.ExportChain, core.ExportPackedChain, core.ExportSfz, core.ExportSfzPerSubCollection, core.ExportDrumRack:
+		export.Kind = kind
+	case "files":
+	default:
+		log.Printf("Unknown export kind %s, exporting files", kind)
+	}
+	export.Sidecar = parseBoolInput(value(10))
+	if profile := strings.ToLower(value(8)); profile != "none" {
+		if _, ok := server.GetExportProfile(profile); ok {
+			export.Profile = profile
+			return export
+		}
+		log.Printf("Unknown export profile %s, expected one of %s", profile, strings.Join(server.ExportProfileNames(), ", "))
+	}
+	// chains are always freshly written wavs, so they use these even when the format is left as original
+	export.SampleRate = parseIntInput(value(5))
+	export.BitDepth = parseIntInput(value(6))
+	export.Mono = parseBoolInput(value(7))
+	format := strings.ToLower(value(4))
+	if format == "original" {
+		return export
+	}
+	export.Format = format
+	options := audio.TranscodeOptions{Format: export.Format, SampleRate: export.SampleRate, BitDepth: export.BitDepth, Mono: export.Mono}
+	if err := options.Validate(); err != nil {
+		log.Printf("Not transcoding export %s: %v", export.Name(), err)
+		export.Format = ""
+	}
+	return export
+}
+
+// Interpret a numeric form answer, anything that isn't a number (e.g. "original") is 0
+func parseIntInput(value string) int {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0
+	}
+	return n
+}
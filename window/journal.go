@@ -0,0 +1,25 @@
+package window
+
+import (
+	"log"
+)
+
+// ////////////////////// UNDO JOURNAL ////////////////////////
+
+// Undo the last change, or redo the last undone one, and refresh whatever it touched
+func (m Model) StepJournal(undo bool) Model {
+	step, stepFn := "redo", m.Server.Redo
+	if undo {
+		step, stepFn = "undo", m.Server.Undo
+	}
+	description, err := stepFn()
+	if err != nil {
+		log.Printf("Failed to %s %s: %v", step, description, err)
+		if description != "" {
+			return m.SetStatus(step, description+": "+err.Error())
+		}
+		return m.SetStatus(step, err.Error())
+	}
+	m = m.refreshTags()
+	return m.SetStatus(step, description)
+}
@@ -0,0 +1,107 @@
+package window
+
+import (
+	"log"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/jesses-code-adventures/excavator/core"
+)
+
+// ////////////////////// RANDOM KITS ////////////////////////
+
+// The user's recipes as list items
+func (m Model) recipeChoices() []core.SelectableListItem {
+	choices := make([]core.SelectableListItem, 0)
+	for _, recipe := range m.Server.GetRecipes() {
+		choices = append(choices, recipe)
+	}
+	return choices
+}
+
+// The recipe under the cursor, if there is one
+func (m Model) selectedRecipe() (core.Recipe, bool) {
+	if m.Cursor < 0 || m.Cursor >= len(m.Server.State.Choices) {
+		return core.Recipe{}, false
+	}
+	recipe, ok := m.Server.State.Choices[m.Cursor].(core.Recipe)
+	return recipe, ok
+}
+
+// Open the recipe form, empty for a new recipe or filled in with the one under the cursor
+func (m Model) EditRecipe(msg tea.Msg, cmd tea.Cmd, existing bool) (Model, tea.Cmd) {
+	m.editRecipe = core.Recipe{}
+	if existing {
+		recipe, ok := m.selectedRecipe()
+		if !ok {
+			return m, cmd
+		}
+		m.editRecipe = recipe
+	}
+	return m.SetWindow(msg, cmd, RecipeWindow)
+}
+
+// Save the recipe form and go back to the list of recipes
+func (m Model) SaveRecipe(msg tea.Msg, cmd tea.Cmd, name string, rules string) (Model, tea.Cmd) {
+	id, err := m.Server.SaveRecipe(m.editRecipe.Id(), name, rules)
+	if err != nil {
+		log.Printf("Failed to save recipe %s: %v", name, err)
+		m = m.SetStatus("kit", err.Error())
+	} else {
+		m = m.SetStatus("kit", "saved "+name)
+	}
+	m, cmd = m.SetWindow(msg, cmd, RecipesWindow)
+	for i, choice := range m.Server.State.Choices {
+		if choice.Id() == id {
+			m.Cursor = i
+			break
+		}
+	}
+	return m, cmd
+}
+
+// Delete the recipe under the cursor
+func (m Model) DeleteRecipe() Model {
+	recipe, ok := m.selectedRecipe()
+	if !ok {
+		return m
+	}
+	m.Server.DeleteRecipe(recipe.Id())
+	m.Server.State.Choices = m.recipeChoices()
+	m.Cursor = min(m.Cursor, max(len(m.Server.State.Choices)-1, 0))
+	return m.SetStatus("kit", "deleted "+recipe.Name())
+}
+
+// Draw a kit from the recipe under the cursor, make it the target collection and browse it
+func (m Model) GenerateKit(msg tea.Msg, cmd tea.Cmd) (Model, tea.Cmd) {
+	recipe, ok := m.selectedRecipe()
+	if !ok {
+		return m, cmd
+	}
+	result, err := m.Server.GenerateKit(recipe.Id())
+	if err != nil {
+		log.Printf("Failed to generate a kit from %s: %v", recipe.Name(), err)
+		return m.SetStatus("kit", err.Error()), cmd
+	}
+	m.Server.UpdateTargetCollection(core.NewCollection(result.Id, result.Name, "drawn from the recipe "+recipe.Name()))
+	m = m.SetStatus("kit", result.String())
+	return m.SetWindow(msg, cmd, BrowseCollectionWindow)
+}
+
+// Draw the subcollection under the cursor again, keeping the rest of the kit
+func (m Model) RerollKitSlot() Model {
+	if m.Cursor < 0 || m.Cursor >= len(m.Server.State.Choices) {
+		return m
+	}
+	tag, ok := m.Server.State.Choices[m.Cursor].(core.CollectionTag)
+	if !ok {
+		return m
+	}
+	result, err := m.Server.RerollKitSlot(m.Server.User.TargetCollection.Id(), tag.SubCollection)
+	if err != nil {
+		log.Printf("Failed to re-roll %s: %v", tag.SubCollection, err)
+		return m.SetStatus("kit", err.Error())
+	}
+	m = m.refreshTags()
+	return m.SetStatus("kit", result.String())
+}
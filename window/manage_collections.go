@@ -0,0 +1,135 @@
+package window
+
+import (
+	"log"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/jesses-code-adventures/excavator/core"
+	"github.com/jesses-code-adventures/excavator/server"
+)
+
+// ////////////////////// MANAGING COLLECTIONS ////////////////////////
+
+// Every collection as list items, leaving out the one with the given id
+func (m Model) collectionChoices(exceptId int) []core.SelectableListItem {
+	choices := make([]core.SelectableListItem, 0)
+	for _, collection := range m.Server.GetCollections() {
+		if collection.Id() != exceptId {
+			choices = append(choices, collection)
+		}
+	}
+	return choices
+}
+
+// Open a window acting on the collection under the cursor
+func (m Model) manageSelectedCollection(msg tea.Msg, cmd tea.Cmd, window WindowName) (Model, tea.Cmd) {
+	if len(m.Server.State.Choices) == 0 {
+		return m, cmd
+	}
+	collection, ok := m.Server.State.Choices[m.Cursor].(core.CollectionMetadata)
+	if !ok {
+		return m, cmd
+	}
+	m.manageCollection = collection
+	return m.SetWindow(msg, cmd, window)
+}
+
+// Go back to the collection manager with the cursor on the given collection, if it's still there
+func (m Model) returnToManageCollections(msg tea.Msg, cmd tea.Cmd, id int) (Model, tea.Cmd) {
+	m, cmd = m.SetWindow(msg, cmd, ManageCollectionsWindow)
+	for i, choice := range m.Server.State.Choices {
+		if choice.Id() == id {
+			m.Cursor = i
+			break
+		}
+	}
+	return m, cmd
+}
+
+// Show how a change to a collection went and go back to the collection manager
+func (m Model) finishManagingCollection(msg tea.Msg, cmd tea.Cmd, id int, err error, done string) (Model, tea.Cmd) {
+	if err != nil {
+		log.Printf("Failed to change collection %s: %v", m.manageCollection.Name(), err)
+		m = m.SetStatus("collections", err.Error())
+	} else {
+		m = m.SetStatus("collections", done)
+	}
+	return m.returnToManageCollections(msg, cmd, id)
+}
+
+// Rename the collection being managed
+func (m Model) RenameCollection(msg tea.Msg, cmd tea.Cmd, name string) (Model, tea.Cmd) {
+	err := m.Server.RenameCollection(m.manageCollection.Id(), name)
+	return m.finishManagingCollection(msg, cmd, m.manageCollection.Id(), err, "renamed "+m.manageCollection.Name())
+}
+
+// Change the description of the collection being managed
+func (m Model) DescribeCollection(msg tea.Msg, cmd tea.Cmd, description string) (Model, tea.Cmd) {
+	err := m.Server.DescribeCollection(m.manageCollection.Id(), description)
+	return m.finishManagingCollection(msg, cmd, m.manageCollection.Id(), err, "described "+m.manageCollection.Name())
+}
+
+// Copy the collection being managed into a new one
+func (m Model) DuplicateCollection(msg tea.Msg, cmd tea.Cmd, name string) (Model, tea.Cmd) {
+	id, err := m.Server.DuplicateCollection(m.manageCollection.Id(), name)
+	if err != nil {
+		id = m.manageCollection.Id()
+	}
+	return m.finishManagingCollection(msg, cmd, id, err, "duplicated "+m.manageCollection.Name())
+}
+
+// Merge the collection being managed into the one under the cursor
+func (m Model) MergeCollection(msg tea.Msg, cmd tea.Cmd) (Model, tea.Cmd) {
+	if len(m.Server.State.Choices) == 0 {
+		return m, cmd
+	}
+	into := m.Server.State.Choices[m.Cursor]
+	result, err := m.Server.MergeCollection(m.manageCollection.Id(), into.Id())
+	return m.finishManagingCollection(msg, cmd, into.Id(), err, m.manageCollection.Name()+" merged into "+into.Name()+": "+result.String())
+}
+
+// Delete the collection being managed, as long as its name was typed out to confirm
+func (m Model) DeleteCollection(msg tea.Msg, cmd tea.Cmd, confirmation string) (Model, tea.Cmd) {
+	if confirmation != m.manageCollection.Name() {
+		m = m.SetStatus("collections", "delete cancelled")
+		return m.returnToManageCollections(msg, cmd, m.manageCollection.Id())
+	}
+	err := m.Server.DeleteCollection(m.manageCollection.Id())
+	return m.finishManagingCollection(msg, cmd, m.manageCollection.Id(), err, "deleted "+m.manageCollection.Name())
+}
+
+// Combine the named collections into a new one, as typed into the combine form
+func (m Model) CombineCollections(msg tea.Msg, cmd tea.Cmd, operation string, names string, name string, conflicts string) (Model, tea.Cmd) {
+	result, err := m.combineCollections(operation, names, name, conflicts)
+	id := result.Id
+	if err != nil {
+		id = m.manageCollection.Id()
+	}
+	return m.finishManagingCollection(msg, cmd, id, err, result.String())
+}
+
+// Read the combine form and run the set operation
+func (m Model) combineCollections(operation string, names string, name string, conflicts string) (server.CollectionSet, error) {
+	setOperation, err := server.ParseSetOperation(operation)
+	if err != nil {
+		return server.CollectionSet{}, err
+	}
+	conflict, err := server.ParseSubCollectionConflict(conflicts)
+	if err != nil {
+		return server.CollectionSet{}, err
+	}
+	ids := make([]int, 0)
+	for _, collectionName := range strings.Split(names, ",") {
+		if strings.TrimSpace(collectionName) == "" {
+			continue
+		}
+		collection, err := m.Server.FindCollection(collectionName)
+		if err != nil {
+			return server.CollectionSet{}, err
+		}
+		ids = append(ids, collection.Id())
+	}
+	return m.Server.CombineCollections(setOperation, ids, name, conflict)
+}
@@ -14,9 +14,11 @@ import (
 	"github.com/charmbracelet/bubbles/viewport"
 	"github.com/charmbracelet/lipgloss"
 
+	"github.com/jesses-code-adventures/excavator/audio"
 	"github.com/jesses-code-adventures/excavator/core"
 	"github.com/jesses-code-adventures/excavator/keymaps"
 	"github.com/jesses-code-adventures/excavator/server"
+	"github.com/jesses-code-adventures/excavator/session"
 )
 
 // A generic Model defining app behaviour in all states
@@ -37,8 +39,26 @@ type Model struct {
 	SelectableList           string
 	Server                   *server.Server
 	ShowCollections          bool
+	ShowDetails              bool
+	ShowSpectrogram          bool
+	Spectrogram              *audio.Spectrogram
+	spectrogramErr           error
+	spectrogramPath          string
 	Viewport                 viewport.Model
 	Window                   Window
+	detailLines              []string
+	detailsPath              string
+	statuses                 []StatusDisplayItem
+	renamePath               string
+	renameFiles              []string
+	renamePlans              []core.RenamePlan
+	tagDirPath               string
+	editTag                  core.CollectionTag
+	manageCollection         core.CollectionMetadata
+	editRecipe               core.Recipe
+	marked                   map[string]bool // selected paths, kept across windows so they can be exported
+	visual                   bool
+	visualAnchor             int
 }
 
 // Constructor for the app's model
@@ -102,6 +122,18 @@ func (s StatusDisplayItem) View() string {
 	return s.keyStyle.Render(s.key+": ") + s.valueStyle.Render(s.value)
 }
 
+// Show the outcome of a background task in the status bar, replacing the last one with the same key
+func (m Model) SetStatus(key string, value string) Model {
+	statuses := make([]StatusDisplayItem, 0, len(m.statuses)+1)
+	for _, status := range m.statuses {
+		if status.key != key {
+			statuses = append(statuses, status)
+		}
+	}
+	m.statuses = append(statuses, NewStatusDisplayItem(key, value))
+	return m
+}
+
 func NewStatusDisplayItem(key string, value string) StatusDisplayItem {
 	return StatusDisplayItem{
 		key:        key,
@@ -125,6 +157,18 @@ func (m Model) GetStatusDisplay() string {
 		NewStatusDisplayItem("dir", m.Server.State.GetCurrentLocationFromRoot()),
 		NewStatusDisplayItem("items", fmt.Sprintf("%v", len(m.Server.State.Choices))),
 	}
+	statuses := m.statuses
+	if selected := len(m.selectedSet()); selected > 0 || m.visual {
+		value := fmt.Sprintf("%d", selected)
+		if m.visual {
+			value += " (visual)"
+		}
+		statuses = append(statuses[:len(statuses):len(statuses)], NewStatusDisplayItem("selected", value))
+	}
+	for _, status := range statuses {
+		msgRaw += " • " + status.key + ": " + status.value
+		items = append(items, status)
+	}
 	for i, item := range items {
 		msg += item.View()
 		if i != len(items)-1 {
@@ -160,7 +204,8 @@ func (m Model) FooterView() string {
 func (m Model) ManuallyResizeWindow() Model {
 	footerHeight := lipgloss.Height(m.FooterView())
 	headerHeight := lipgloss.Height(m.HeaderView())
-	newHeight := m.screenHeight - headerHeight - footerHeight
+	panelHeight := lipgloss.Height(m.PanelsView())
+	newHeight := m.screenHeight - headerHeight - footerHeight - panelHeight
 	m.Viewport.Height = newHeight
 	m.Ready = true
 	return m
@@ -170,9 +215,10 @@ func (m Model) ManuallyResizeWindow() Model {
 func (m Model) HandleWindowResize(msg tea.WindowSizeMsg) Model {
 	footerHeight := lipgloss.Height(m.FooterView())
 	headerHeight := lipgloss.Height(m.HeaderView())
+	panelHeight := lipgloss.Height(m.PanelsView())
 	m.screenHeight = msg.Height
 	m.screenWidth = msg.Width
-	m.Viewport.Height = msg.Height - headerHeight - footerHeight
+	m.Viewport.Height = msg.Height - headerHeight - footerHeight - panelHeight
 	m.Viewport.Width = msg.Width
 	m.Ready = true
 	return m
@@ -224,17 +270,32 @@ func (m Model) SetViewportContent(msg tea.Msg, cmd tea.Cmd) (Model, tea.Cmd) {
 			m.ShowCollections,
 			m.SearchableSelectableList.Search.Input,
 			m.Window.Name() == BrowseCollectionWindow,
+			m.selectedSet(),
 		))
 		m.Viewport = m.EnsureCursorVerticallyCentered()
 	}
 	return m, cmd
 }
 
+// Optional panels shown between the viewport and the footer
+func (m Model) PanelsView() string {
+	panels := make([]string, 0)
+	for _, panel := range []string{m.DetailsPanelView(), m.SpectrogramPanelView()} {
+		if panel != "" {
+			panels = append(panels, panel)
+		}
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, panels...)
+}
+
 // Handle all view rendering
 func (m Model) View() string {
 	if m.Quitting {
 		return ""
 	}
+	if panels := m.PanelsView(); panels != "" {
+		return AppStyle.Render(fmt.Sprintf("%s\n%s\n%s\n%s", m.HeaderView(), ViewportStyle.Render(m.Viewport.View()), panels, m.FooterView()))
+	}
 	return AppStyle.Render(fmt.Sprintf("%s\n%s\n%s", m.HeaderView(), ViewportStyle.Render(m.Viewport.View()), m.FooterView()))
 }
 
@@ -287,10 +348,16 @@ func (m Model) HandleTitledList(msg tea.Msg, cmd tea.Cmd, window WindowName) (Mo
 		m.Server.State.Choices = make([]core.SelectableListItem, 0)
 	case Home:
 	case BrowseCollectionWindow:
-		m.ClearModel()
-		tags := m.Server.GetCollectionTagsAsListItem(m.Server.User.TargetCollection.Id())
-		for _, tag := range tags {
-			m.Server.State.Choices = append(m.Server.State.Choices, tag)
+		m = m.ClearModel()
+		m.Server.State.Choices = m.collectionTagChoices()
+	case DuplicatesWindow:
+		m = m.ClearModel()
+		cmd = tea.Batch(cmd, indexDuplicates(m.Server))
+	case SimilarCurrentWindow, SimilarRootWindow, SimilarCollectionWindow:
+		reference := m.SelectedFilePath()
+		m = m.ClearModel()
+		if reference != "" {
+			cmd = tea.Batch(cmd, findSimilar(m.Server, reference, window))
 		}
 	case RunExportWindow:
 		m.Server.State.Choices = make([]core.SelectableListItem, 0)
@@ -299,6 +366,22 @@ func (m Model) HandleTitledList(msg tea.Msg, cmd tea.Cmd, window WindowName) (Mo
 			m.Server.State.Choices = append(m.Server.State.Choices, export)
 		}
 		m.SelectableList = window.String()
+	case BatchRenamePreviewWindow:
+		m = m.ClearModel()
+		m.Server.State.Choices = m.renamePlanChoices()
+		m.SelectableList = window.String()
+	case ManageCollectionsWindow:
+		m = m.ClearModel()
+		m.Server.State.Choices = m.collectionChoices(0)
+		m.SelectableList = window.String()
+	case MergeCollectionWindow:
+		m = m.ClearModel()
+		m.Server.State.Choices = m.collectionChoices(m.manageCollection.Id())
+		m.SelectableList = "merge " + m.manageCollection.Name() + " into"
+	case RecipesWindow:
+		m = m.ClearModel()
+		m.Server.State.Choices = m.recipeChoices()
+		m.SelectableList = window.String()
 	default:
 		log.Fatalf("Invalid searchable selectable list title")
 	}
@@ -313,22 +396,73 @@ func (m Model) HandleForm(msg tea.Msg, cmd tea.Cmd, window WindowName) (Model, t
 		m.Form = core.GetNewCollectionForm()
 	case CreateExportWindow:
 		m = m.ClearModel()
-		form := core.NewForm(window.String(), []core.FormInput{
-			core.NewFormInput("name"),
-			core.NewFormInput("output_dir"),
-			core.NewFormInput("concrete"),
-		})
-		m.Form = form
+		m.Form = core.NewForm(window.String(), exportFormInputs())
+	case RenameWindow, MoveWindow:
+		m.renamePath = m.Server.State.Choices[m.Cursor].Path()
+		m = m.ClearModel()
+		if window == RenameWindow {
+			m.Form = core.GetRenameForm(path.Base(m.renamePath))
+		} else {
+			m.Form = core.GetMoveForm(path.Dir(m.renamePath))
+		}
+	case RenameTagWindow, MoveTagWindow:
+		if tag, ok := m.Server.State.Choices[m.Cursor].(core.CollectionTag); ok {
+			m.editTag = tag
+		}
+		m = m.ClearModel()
+		if window == RenameTagWindow {
+			m.Form = core.GetRenameTagForm(m.editTag.Name())
+		} else {
+			m.Form = core.GetMoveTagForm(m.editTag.SubCollection)
+		}
+	case RenameCollectionWindow:
+		m = m.ClearModel()
+		m.Form = core.GetRenameCollectionForm(m.manageCollection.Name())
+	case DescribeCollectionWindow:
+		m = m.ClearModel()
+		m.Form = core.GetDescribeCollectionForm(m.manageCollection.Description())
+	case DuplicateCollectionWindow:
+		m = m.ClearModel()
+		m.Form = core.GetDuplicateCollectionForm(m.manageCollection.Name())
+	case DeleteCollectionWindow:
+		m = m.ClearModel()
+		m.Form = core.GetDeleteCollectionForm(m.manageCollection.Name())
+	case RecipeWindow:
+		m = m.ClearModel()
+		m.Form = core.GetRecipeForm(m.editRecipe.Name(), m.editRecipe.Description())
+	case CombineCollectionsWindow:
+		m = m.ClearModel()
+		m.Form = core.GetCombineCollectionsForm(m.manageCollection.Name() + ", ")
+	case TagDirectoryWindow:
+		m.tagDirPath = m.SelectedDirPath()
+		m = m.ClearModel()
+		m.Form = core.GetTagDirectoryForm(m.Server.User.TargetSubCollection)
+	case BatchRenameWindow:
+		m.renameFiles = m.listedFiles()
+		m = m.ClearModel()
+		m.Form = core.GetBatchRenameForm()
+	case ImportSessionWindow:
+		defaultPath := ""
+		if len(m.Server.State.Choices) > 0 && session.IsSessionFile(m.Server.State.Choices[m.Cursor].Path()) {
+			defaultPath = m.Server.State.Choices[m.Cursor].Path()
+		}
+		m = m.ClearModel()
+		m.Form = core.GetImportSessionForm(defaultPath)
 	case NewTagWindow:
 		fp := m.Server.State.Choices[m.Cursor].Path()
 		name := path.Base(fp)
-		m.Form = core.GetCreateTagForm(name, m.Server.User.TargetSubCollection)
+		subCollection := m.Server.User.TargetSubCollection
+		if category := m.Server.GetCategory(fp); category != "" {
+			subCollection = "/" + category
+		}
+		m.Form = core.GetCreateTagForm(name, subCollection)
 	}
 	return m, cmd
 }
 
 // Main handler to be called any time the window changes
 func (m Model) SetWindow(msg tea.Msg, cmd tea.Cmd, window WindowName) (Model, tea.Cmd) {
+	m = m.commitVisual()
 	if m.Window.Name() == window {
 		m, cmd = m.GoToHome(msg, cmd)
 		return m, cmd
@@ -354,6 +488,36 @@ func (m Model) ToggleExtendedHelp() Model {
 	return m
 }
 
+// Path of the file under the cursor, or an empty string if the cursor isn't on a file
+func (m Model) SelectedFilePath() string {
+	if m.Window.Type() == FormWindow || m.Window.Type() == PreViewport {
+		return ""
+	}
+	if m.Cursor < 0 || m.Cursor >= len(m.Server.State.Choices) {
+		return ""
+	}
+	choice := m.Server.State.Choices[m.Cursor]
+	if choice.IsDir() || !choice.IsFile() {
+		return ""
+	}
+	return choice.Path()
+}
+
+// Path of the directory under the cursor, or an empty string if the cursor isn't on one. The parent entry doesn't count.
+func (m Model) SelectedDirPath() string {
+	if m.Window.Type() == FormWindow || m.Window.Type() == PreViewport {
+		return ""
+	}
+	if m.Cursor < 0 || m.Cursor >= len(m.Server.State.Choices) {
+		return ""
+	}
+	choice := m.Server.State.Choices[m.Cursor]
+	if !choice.IsDir() || choice.Name() == ".." {
+		return ""
+	}
+	return choice.Path()
+}
+
 // Audition the file under the cursor
 func (m Model) AuditionCurrentlySelectedFile() {
 	if len(m.Server.State.Choices) == 0 {
@@ -420,6 +584,10 @@ func (m Model) HandleStandardMovementKey(msg tea.KeyMsg) Model {
 		m.VerticalNavEffect()
 	case key.Matches(msg, m.Keys.ShowHelp):
 		m = m.ToggleExtendedHelp()
+	case key.Matches(msg, m.Keys.ToggleSpectrogram):
+		m = m.ToggleSpectrogram()
+	case key.Matches(msg, m.Keys.ToggleDetails):
+		m = m.ToggleDetails()
 	default:
 		if msg.String() == "g" && m.KeyHack.GetLastKey() == "g" {
 			m.Cursor = 0
@@ -438,7 +606,11 @@ func (m Model) HandleWindowChangeKey(msg tea.KeyMsg, cmd tea.Cmd) (Model, tea.Cm
 			return m.GoToHome(msg, cmd)
 		}
 	case key.Matches(msg, m.Keys.NewCollection):
-		m, cmd = m.SetWindow(msg, cmd, NewCollectionWindow)
+		if m.Window.Name() == RecipesWindow {
+			m, cmd = m.EditRecipe(msg, cmd, false)
+		} else {
+			m, cmd = m.SetWindow(msg, cmd, NewCollectionWindow)
+		}
 	case key.Matches(msg, m.Keys.CreateExport):
 		m, cmd = m.SetWindow(msg, cmd, CreateExportWindow)
 	case key.Matches(msg, m.Keys.RunExport):
@@ -455,8 +627,26 @@ func (m Model) HandleWindowChangeKey(msg tea.KeyMsg, cmd tea.Cmd) (Model, tea.Cm
 		m, cmd = m.SetWindow(msg, cmd, SetTargetCollectionWindow)
 	case key.Matches(msg, m.Keys.BrowseTargetCollection):
 		m, cmd = m.SetWindow(msg, cmd, BrowseCollectionWindow)
+	case key.Matches(msg, m.Keys.ManageCollections):
+		m, cmd = m.SetWindow(msg, cmd, ManageCollectionsWindow)
+	case key.Matches(msg, m.Keys.KitRecipes):
+		m, cmd = m.SetWindow(msg, cmd, RecipesWindow)
 	case key.Matches(msg, m.Keys.CreateTag):
-		m, cmd = m.SetWindow(msg, cmd, NewTagWindow)
+		if m.SelectedDirPath() != "" {
+			m, cmd = m.SetWindow(msg, cmd, TagDirectoryWindow)
+		} else {
+			m, cmd = m.SetWindow(msg, cmd, NewTagWindow)
+		}
+	case key.Matches(msg, m.Keys.FindDuplicates):
+		m, cmd = m.SetWindow(msg, cmd, DuplicatesWindow)
+	case key.Matches(msg, m.Keys.FindSimilarFromCurrent):
+		m, cmd = m.SetWindow(msg, cmd, SimilarCurrentWindow)
+	case key.Matches(msg, m.Keys.FindSimilarFromRoot):
+		m, cmd = m.SetWindow(msg, cmd, SimilarRootWindow)
+	case key.Matches(msg, m.Keys.FindSimilarInCollection):
+		m, cmd = m.SetWindow(msg, cmd, SimilarCollectionWindow)
+	case key.Matches(msg, m.Keys.ImportSession):
+		m, cmd = m.SetWindow(msg, cmd, ImportSessionWindow)
 	}
 	return m, cmd
 }
@@ -470,9 +660,42 @@ func (m Model) HandleListSelectionKey(msg tea.KeyMsg, cmd tea.Cmd) (Model, tea.C
 		m.ShowCollections = !m.ShowCollections
 	case key.Matches(msg, m.Keys.SetTargetSubCollectionRoot):
 		m.Server.UpdateTargetSubCollection("")
+	case key.Matches(msg, m.Keys.Rename):
+		if m.Window.Name() == ManageCollectionsWindow {
+			m, cmd = m.manageSelectedCollection(msg, cmd, RenameCollectionWindow)
+		}
+	case key.Matches(msg, m.Keys.InsertMode):
+		switch m.Window.Name() {
+		case ManageCollectionsWindow:
+			m, cmd = m.manageSelectedCollection(msg, cmd, DescribeCollectionWindow)
+		case RecipesWindow:
+			m, cmd = m.EditRecipe(msg, cmd, true)
+		}
+	case key.Matches(msg, m.Keys.DuplicateCollection):
+		if m.Window.Name() == ManageCollectionsWindow {
+			m, cmd = m.manageSelectedCollection(msg, cmd, DuplicateCollectionWindow)
+		}
+	case key.Matches(msg, m.Keys.Move):
+		if m.Window.Name() == ManageCollectionsWindow {
+			m, cmd = m.manageSelectedCollection(msg, cmd, MergeCollectionWindow)
+		}
+	case key.Matches(msg, m.Keys.Untag):
+		switch m.Window.Name() {
+		case ManageCollectionsWindow:
+			m, cmd = m.manageSelectedCollection(msg, cmd, DeleteCollectionWindow)
+		case RecipesWindow:
+			m = m.DeleteRecipe()
+		}
+	case key.Matches(msg, m.Keys.CombineCollections):
+		if m.Window.Name() == ManageCollectionsWindow {
+			m, cmd = m.manageSelectedCollection(msg, cmd, CombineCollectionsWindow)
+		}
 	case key.Matches(msg, m.Keys.Enter):
 		switch m.Window.Name() {
-		case SetTargetCollectionWindow:
+		case SetTargetCollectionWindow, ManageCollectionsWindow:
+			if len(m.Server.State.Choices) == 0 {
+				break
+			}
 			if collection, ok := m.Server.State.Choices[m.Cursor].(core.CollectionMetadata); ok {
 				m.Server.UpdateTargetCollection(collection)
 				m, cmd = m.GoToHome(msg, cmd)
@@ -481,10 +704,22 @@ func (m Model) HandleListSelectionKey(msg tea.KeyMsg, cmd tea.Cmd) (Model, tea.C
 			}
 		case RunExportWindow:
 			if export, ok := m.Server.State.Choices[m.Cursor].(core.Export); ok {
-				m.Server.ExportCollection(m.Server.GetCollectionTags(m.Server.User.TargetCollection.Id()), m.Server.GetExport(export.Id()))
+				tags := m.Server.GetCollectionTags(m.Server.User.TargetCollection.Id())
+				if selection := m.Selection(); len(selection) > 0 {
+					tags = m.Server.SelectionTags(selection)
+					m = m.ClearSelection()
+				}
+				m = m.SetStatus("export", export.Name()+": exporting")
+				cmd = tea.Batch(cmd, runExport(m.Server, m.Server.GetExport(export.Id()), tags))
 			} else {
 				log.Fatalf("Invalid list selection item type")
 			}
+		case BatchRenamePreviewWindow:
+			m, cmd = m.ApplyBatchRename(msg, cmd)
+		case MergeCollectionWindow:
+			m, cmd = m.MergeCollection(msg, cmd)
+		case RecipesWindow:
+			m, cmd = m.GenerateKit(msg, cmd)
 		}
 	}
 	return m, cmd
@@ -530,7 +765,7 @@ func (m Model) HandleFormNavigationKey(msg tea.KeyMsg, cmd tea.Cmd) (Model, tea.
 		m.Help.ShowAll = !m.Help.ShowAll
 	case key.Matches(msg, m.Keys.Enter):
 		for i, input := range m.Form.Inputs {
-			if input.Input.Value() == "" {
+			if input.Input.Value() == "" && !input.Optional {
 				m.Form.FocusedInput = i
 				m.Form.Inputs[i].Input.Focus()
 				return m, cmd
@@ -540,9 +775,9 @@ func (m Model) HandleFormNavigationKey(msg tea.KeyMsg, cmd tea.Cmd) (Model, tea.
 		case NewCollectionWindow:
 			m.Server.CreateCollection(m.Form.Inputs[0].Input.Value(), m.Form.Inputs[1].Input.Value())
 		case NewTagWindow:
-			m.Server.CreateTag(m.Server.State.Choices[m.Cursor].Name(), m.Form.Inputs[0].Input.Value(), m.Form.Inputs[1].Input.Value())
+			m.Server.CreateTag(m.Server.State.Choices[m.Cursor].Path(), m.Form.Inputs[0].Input.Value(), m.Form.Inputs[1].Input.Value())
 		case CreateExportWindow:
-			if len(m.Form.Inputs) < 3 {
+			if len(m.Form.Inputs) < 11 {
 				log.Println("not enough inputs for export")
 				return m, cmd
 			}
@@ -550,19 +785,61 @@ func (m Model) HandleFormNavigationKey(msg tea.KeyMsg, cmd tea.Cmd) (Model, tea.
 				log.Println("please fill out all fields")
 				return m, cmd
 			}
-			var concrete bool
-			if strings.HasPrefix(m.Form.Inputs[2].Input.Value(), "t") || m.Form.Inputs[2].Input.Value() == "1" {
-				concrete = true
+			m.Server.CreateExport(exportFromForm(m.Form))
+		case RenameWindow:
+			if err := m.Server.RenamePath(m.renamePath, m.Form.Inputs[0].Input.Value()); err != nil {
+				log.Printf("Failed to rename %s: %v", m.renamePath, err)
+				m = m.SetStatus("rename", err.Error())
 			} else {
-				concrete = false
+				m = m.SetStatus("rename", "renamed "+path.Base(m.renamePath))
+			}
+		case MoveWindow:
+			destination := path.Join(core.ExpandPath(m.Form.Inputs[0].Input.Value()), path.Base(m.renamePath))
+			if err := m.Server.MovePath(m.renamePath, destination); err != nil {
+				log.Printf("Failed to move %s: %v", m.renamePath, err)
+				m = m.SetStatus("move", err.Error())
+			} else {
+				m = m.SetStatus("move", "moved "+path.Base(m.renamePath))
+			}
+		case BatchRenameWindow:
+			return m.PreviewBatchRename(msg, cmd)
+		case RenameTagWindow:
+			return m.RenameCollectionTag(msg, cmd, m.Form.Inputs[0].Input.Value())
+		case MoveTagWindow:
+			return m.MoveCollectionTag(msg, cmd, m.Form.Inputs[0].Input.Value())
+		case RenameCollectionWindow:
+			return m.RenameCollection(msg, cmd, m.Form.Inputs[0].Input.Value())
+		case DescribeCollectionWindow:
+			return m.DescribeCollection(msg, cmd, m.Form.Inputs[0].Input.Value())
+		case DuplicateCollectionWindow:
+			return m.DuplicateCollection(msg, cmd, m.Form.Inputs[0].Input.Value())
+		case DeleteCollectionWindow:
+			return m.DeleteCollection(msg, cmd, m.Form.Inputs[0].Input.Value())
+		case RecipeWindow:
+			return m.SaveRecipe(msg, cmd, m.Form.Inputs[0].Input.Value(), m.Form.Inputs[1].Input.Value())
+		case CombineCollectionsWindow:
+			return m.CombineCollections(msg, cmd, m.Form.Inputs[0].Input.Value(), m.Form.Inputs[1].Input.Value(), m.Form.Inputs[2].Input.Value(), m.Form.Inputs[3].Input.Value())
+		case TagDirectoryWindow:
+			m = m.TagDirectory(m.tagDirPath, m.Form.Inputs[0].Input.Value(), parseBoolInput(m.Form.Inputs[1].Input.Value()))
+		case ImportSessionWindow:
+			imported, err := m.Server.ImportSession(m.Form.Inputs[0].Input.Value())
+			if err != nil {
+				log.Printf("Failed to import session: %v", err)
+				m = m.SetStatus("session", err.Error())
+			} else {
+				m = m.SetStatus("session", imported.String())
 			}
-			m.Server.CreateExport(m.Form.Inputs[0].Input.Value(), m.Form.Inputs[1].Input.Value(), concrete)
 		}
 		m, cmd = m.GoToHome(msg, cmd)
 	}
 	return m, cmd
 }
 
+// Interpret a yes/no form answer
+func parseBoolInput(value string) bool {
+	return strings.HasPrefix(value, "t") || value == "1"
+}
+
 // Utility function handling searches
 func (m Model) FilterListItems() Model {
 	var resp []core.SelectableListItem
@@ -633,9 +910,35 @@ func (m Model) HandleSearchableListNavKey(msg tea.KeyMsg, cmd tea.Cmd) (Model, t
 			return m, cmd
 		}
 		choice := m.Server.State.Choices[m.Cursor]
-		if !choice.IsDir() && choice.IsFile() {
+		if len(m.selectedSet()) > 0 {
+			m = m.TagSelection()
+		} else if !choice.IsDir() && choice.IsFile() {
 			m.Server.CreateQuickTag(choice.Path())
+		} else if dir := m.SelectedDirPath(); dir != "" {
+			m = m.TagDirectory(dir, m.Server.User.TargetSubCollection, false)
+		}
+	case key.Matches(msg, m.Keys.Untag):
+		if len(m.Server.State.Choices) == 0 {
+			return m, cmd
+		}
+		if len(m.selectedSet()) > 0 {
+			m = m.UntagSelection()
+		} else if m.Window.Name() == BrowseCollectionWindow {
+			m = m.RemoveCollectionTag()
+		} else if choice := m.Server.State.Choices[m.Cursor]; choice.IsFile() || m.SelectedDirPath() != "" {
+			m = m.UntagPath(choice.Path())
+		}
+	case key.Matches(msg, m.Keys.ToggleMark):
+		m = m.ToggleMark()
+		if m.Cursor < len(m.Server.State.Choices)-1 {
+			m.Cursor++
 		}
+	case key.Matches(msg, m.Keys.VisualMode):
+		m = m.ToggleVisual()
+	case key.Matches(msg, m.Keys.ClearSelection):
+		m = m.ClearSelection()
+	case key.Matches(msg, m.Keys.AuditionLayered):
+		m.AuditionSelectionLayered()
 	case key.Matches(msg, m.Keys.Enter):
 		value := m.SearchableSelectableList.Search.Input.Value()
 		if m.SearchingLocally {
@@ -665,6 +968,7 @@ func (m Model) HandleSearchableListNavKey(msg tea.KeyMsg, cmd tea.Cmd) (Model, t
 		case Home:
 			choice := m.Server.State.Choices[m.Cursor]
 			if choice.IsDir() {
+				m = m.commitVisual()
 				if choice.Name() == ".." {
 					m.Cursor = 0
 					m.Server.State.ChangeToParentDir()
@@ -685,11 +989,60 @@ func (m Model) HandleSearchableListNavKey(msg tea.KeyMsg, cmd tea.Cmd) (Model, t
 				}
 			}
 			m, cmd = m.GoToHome(msg, cmd)
+		case BrowseCollectionWindow:
+			m, cmd = m.JumpToCollectionTag(msg, cmd)
+		case DuplicatesWindow:
+			m = m.KeepSelectedDuplicate()
 		}
 	case key.Matches(msg, m.Keys.ToggleShowCollections):
 		m.ShowCollections = !m.ShowCollections
 	case key.Matches(msg, m.Keys.SetTargetSubCollectionRoot):
 		m.Server.UpdateTargetSubCollection("")
+	case key.Matches(msg, m.Keys.AnalyseDir):
+		if m.Window.Name() == Home {
+			cmd = tea.Batch(cmd, analyseDir(m.Server, m.Server.State.Dir))
+		}
+	case key.Matches(msg, m.Keys.Rename):
+		if len(m.Server.State.Choices) == 0 {
+			return m, cmd
+		}
+		switch m.Window.Name() {
+		case Home:
+			m, cmd = m.SetWindow(msg, cmd, RenameWindow)
+		case BrowseCollectionWindow:
+			m, cmd = m.SetWindow(msg, cmd, RenameTagWindow)
+		}
+	case key.Matches(msg, m.Keys.Move):
+		if len(m.Server.State.Choices) == 0 {
+			return m, cmd
+		}
+		switch m.Window.Name() {
+		case Home:
+			m, cmd = m.SetWindow(msg, cmd, MoveWindow)
+		case BrowseCollectionWindow:
+			m, cmd = m.SetWindow(msg, cmd, MoveTagWindow)
+		}
+	case key.Matches(msg, m.Keys.BatchRename):
+		switch m.Window.Name() {
+		case Home, FuzzySearchRootWindow, FuzzySearchCurrentWindow:
+			if len(m.listedFiles()) > 0 {
+				m, cmd = m.SetWindow(msg, cmd, BatchRenameWindow)
+			}
+		}
+	case key.Matches(msg, m.Keys.RerollKitSlot):
+		if m.Window.Name() == BrowseCollectionWindow {
+			m = m.RerollKitSlot()
+		}
+	case key.Matches(msg, m.Keys.Undo):
+		m = m.StepJournal(true)
+	case key.Matches(msg, m.Keys.Redo):
+		m = m.StepJournal(false)
+	case key.Matches(msg, m.Keys.ScanProjects):
+		m = m.SetStatus("projects", "scanning")
+		cmd = tea.Batch(cmd, scanProjects(m.Server))
+	case key.Matches(msg, m.Keys.SyncAbletonLabels):
+		m = m.SetStatus("ableton", "syncing")
+		cmd = tea.Batch(cmd, syncAbletonLabels(m.Server))
 	}
 	return m, cmd
 }
@@ -770,6 +1123,22 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		m = m.HandleWindowResize(msg)
+	case SpectrogramMsg:
+		m = m.HandleSpectrogramMsg(msg)
+	case DetailsMsg:
+		m = m.HandleDetailsMsg(msg)
+	case DuplicatesMsg:
+		m = m.HandleDuplicatesMsg(msg)
+	case SimilarMsg:
+		m = m.HandleSimilarMsg(msg)
+	case AnalysedMsg:
+		m = m.HandleAnalysedMsg(msg)
+	case ExportedMsg:
+		m = m.HandleExportedMsg(msg)
+	case ProjectsScannedMsg:
+		m = m.HandleProjectsScannedMsg(msg)
+	case AbletonSyncedMsg:
+		m = m.HandleAbletonSyncedMsg(msg)
 	case tea.KeyMsg:
 		switch m.Window.Type() {
 		case PreViewport:
@@ -786,5 +1155,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		m.KeyHack.UpdateLastKey(msg.String())
 	}
+	m, cmd = m.RequestSpectrogram(cmd)
+	m, cmd = m.RequestDetails(cmd)
 	return m.SetViewportContent(msg, cmd)
 }
@@ -0,0 +1,39 @@
+package window
+
+import (
+	"log"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/jesses-code-adventures/excavator/server"
+)
+
+// ////////////////////// PROJECT USAGE ////////////////////////
+
+// Sent when a scan of the projects directory has finished
+type ProjectsScannedMsg struct {
+	Scan server.ProjectScan
+	Err  error
+}
+
+// Scan the projects directory off the ui thread, parsing every project can take a while
+func scanProjects(s *server.Server) tea.Cmd {
+	return func() tea.Msg {
+		scan, err := s.ScanProjects()
+		return ProjectsScannedMsg{Scan: scan, Err: err}
+	}
+}
+
+// Show how the scan went and refresh the listing so usage counts show up
+func (m Model) HandleProjectsScannedMsg(msg ProjectsScannedMsg) Model {
+	if msg.Err != nil {
+		log.Printf("Failed to scan projects: %v", msg.Err)
+		return m.SetStatus("projects", msg.Err.Error())
+	}
+	m = m.SetStatus("projects", msg.Scan.String())
+	if m.Window.Name() == Home {
+		m.Server.UpdateChoices()
+	}
+	m.detailsPath = ""
+	return m
+}
@@ -0,0 +1,158 @@
+package window
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/jesses-code-adventures/excavator/core"
+)
+
+// ////////////////////// SELECTIONS ////////////////////////
+
+// Mark or unmark the row under the cursor
+func (m Model) ToggleMark() Model {
+	if m.Cursor < 0 || m.Cursor >= len(m.Server.State.Choices) {
+		return m
+	}
+	choice := m.Server.State.Choices[m.Cursor]
+	if choice.Name() == ".." {
+		return m
+	}
+	if m.marked == nil {
+		m.marked = make(map[string]bool)
+	}
+	if m.marked[choice.Path()] {
+		delete(m.marked, choice.Path())
+	} else {
+		m.marked[choice.Path()] = true
+	}
+	return m
+}
+
+// Start selecting a range from the cursor, or stop and keep the range marked
+func (m Model) ToggleVisual() Model {
+	if !m.visual {
+		m.visual = true
+		m.visualAnchor = m.Cursor
+		return m
+	}
+	return m.commitVisual()
+}
+
+// Mark every row in the visual range and leave visual mode
+func (m Model) commitVisual() Model {
+	if !m.visual {
+		return m
+	}
+	if m.marked == nil {
+		m.marked = make(map[string]bool)
+	}
+	for path := range m.visualRange() {
+		m.marked[path] = true
+	}
+	m.visual = false
+	return m
+}
+
+// The paths between the visual anchor and the cursor
+func (m Model) visualRange() map[string]bool {
+	selected := make(map[string]bool)
+	if !m.visual {
+		return selected
+	}
+	start, end := min(m.visualAnchor, m.Cursor), max(m.visualAnchor, m.Cursor)
+	for i := max(start, 0); i <= end && i < len(m.Server.State.Choices); i++ {
+		if choice := m.Server.State.Choices[i]; choice.Name() != ".." {
+			selected[choice.Path()] = true
+		}
+	}
+	return selected
+}
+
+// Every marked path plus the visual range, for highlighting
+func (m Model) selectedSet() map[string]bool {
+	selected := m.visualRange()
+	for path := range m.marked {
+		selected[path] = true
+	}
+	return selected
+}
+
+// The selected paths, listed rows first in the order they're shown, then anything marked elsewhere
+func (m Model) Selection() []string {
+	selected := m.selectedSet()
+	paths := make([]string, 0, len(selected))
+	for _, choice := range m.Server.State.Choices {
+		if selected[choice.Path()] {
+			paths = append(paths, choice.Path())
+			delete(selected, choice.Path())
+		}
+	}
+	rest := make([]string, 0, len(selected))
+	for path := range selected {
+		rest = append(rest, path)
+	}
+	sort.Strings(rest)
+	return append(paths, rest...)
+}
+
+// Forget the selection and leave visual mode
+func (m Model) ClearSelection() Model {
+	m.marked = nil
+	m.visual = false
+	return m
+}
+
+// Tag the whole selection into the target collection and subcollection
+func (m Model) TagSelection() Model {
+	added, err := m.Server.TagSelection(m.Selection())
+	if err != nil {
+		log.Printf("Failed to tag selection: %v", err)
+		return m.SetStatus("tag", err.Error())
+	}
+	m = m.ClearSelection()
+	m = m.refreshTags()
+	return m.SetStatus("tag", fmt.Sprintf("%d added", added))
+}
+
+// Take the whole selection out of the target collection
+func (m Model) UntagSelection() Model {
+	removed, err := m.Server.UntagSelection(m.Selection())
+	if err != nil {
+		log.Printf("Failed to untag selection: %v", err)
+		return m.SetStatus("tag", err.Error())
+	}
+	m = m.ClearSelection()
+	m = m.refreshTags()
+	return m.SetStatus("tag", fmt.Sprintf("%d removed", removed))
+}
+
+// Play every selected file at once
+func (m Model) AuditionSelectionLayered() {
+	paths := make([]string, 0)
+	for _, path := range m.Selection() {
+		if core.IsAudioFile(path) {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		m.AuditionCurrentlySelectedFile()
+		return
+	}
+	go m.Server.Player.PlayLayer(paths)
+}
+
+// Reload the listing so changed tags show up
+func (m Model) refreshTags() Model {
+	switch m.Window.Name() {
+	case Home:
+		m.Server.UpdateChoices()
+	case BrowseCollectionWindow:
+		m.Server.State.Choices = m.collectionTagChoices()
+	default:
+		return m
+	}
+	m.Cursor = min(m.Cursor, max(len(m.Server.State.Choices)-1, 0))
+	return m
+}
@@ -0,0 +1,53 @@
+package window
+
+import (
+	"log"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/jesses-code-adventures/excavator/core"
+	"github.com/jesses-code-adventures/excavator/server"
+)
+
+// ////////////////////// SIMILAR SOUNDS ////////////////////////
+
+// Sent when a similarity search has finished
+type SimilarMsg struct {
+	Window WindowName
+	Items  []core.SelectableListItem
+	Err    error
+}
+
+// The search scope belonging to each similar sounds window
+func similarityScope(window WindowName) server.SimilarityScope {
+	switch window {
+	case SimilarRootWindow:
+		return server.ScopeRoot
+	case SimilarCollectionWindow:
+		return server.ScopeCollection
+	default:
+		return server.ScopeCurrentDir
+	}
+}
+
+// Run a similarity search off the ui thread
+func findSimilar(s *server.Server, reference string, window WindowName) tea.Cmd {
+	return func() tea.Msg {
+		items, err := s.FindSimilar(reference, similarityScope(window))
+		return SimilarMsg{Window: window, Items: items, Err: err}
+	}
+}
+
+// Show the results of a similarity search if its window is still open
+func (m Model) HandleSimilarMsg(msg SimilarMsg) Model {
+	if msg.Err != nil {
+		log.Printf("Failed to find similar sounds: %v", msg.Err)
+		return m.SetStatus("similar", msg.Err.Error())
+	}
+	if m.Window.Name() != msg.Window {
+		return m
+	}
+	m.Server.State.Choices = msg.Items
+	m.Cursor = 0
+	return m
+}
@@ -0,0 +1,132 @@
+package window
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/jesses-code-adventures/excavator/audio"
+	"github.com/jesses-code-adventures/excavator/server"
+)
+
+// ////////////////////// SPECTROGRAM ////////////////////////
+
+// Sent when a spectrogram has finished loading in the background
+type SpectrogramMsg struct {
+	Path        string
+	Spectrogram audio.Spectrogram
+	Err         error
+}
+
+// Colours a spectrogram level is interpolated across, quietest first
+var spectrogramGradient = [][3]float64{
+	{0x1A, 0x1A, 0x1A},
+	{0x25, 0xA0, 0x65},
+	{0xE4, 0x41, 0xB5},
+	{0xFF, 0xFD, 0xF5},
+}
+
+// Map a spectrogram level onto the gradient
+func spectrogramColour(level uint8) lipgloss.Color {
+	position := float64(level) / 255 * float64(len(spectrogramGradient)-1)
+	lower := int(position)
+	if lower >= len(spectrogramGradient)-1 {
+		lower = len(spectrogramGradient) - 2
+	}
+	t := position - float64(lower)
+	rgb := [3]int{}
+	for i := range rgb {
+		from := spectrogramGradient[lower][i]
+		to := spectrogramGradient[lower+1][i]
+		rgb[i] = int(from + (to-from)*t)
+	}
+	return lipgloss.Color(fmt.Sprintf("#%02X%02X%02X", rgb[0], rgb[1], rgb[2]))
+}
+
+// Load a spectrogram off the ui thread
+func loadSpectrogram(s *server.Server, filePath string) tea.Cmd {
+	return func() tea.Msg {
+		spectrogram, err := s.GetSpectrogram(filePath)
+		return SpectrogramMsg{Path: filePath, Spectrogram: spectrogram, Err: err}
+	}
+}
+
+// Render a spectrogram stretched to the given width, two bands per line with the highest frequencies at the top
+func SpectrogramView(spectrogram audio.Spectrogram, width int) string {
+	lines := make([]string, 0, spectrogram.Bands/2)
+	for band := spectrogram.Bands - 1; band > 0; band -= 2 {
+		var line strings.Builder
+		for x := 0; x < width; x++ {
+			frame := x * spectrogram.Frames / width
+			upper := spectrogramColour(spectrogram.Level(frame, band))
+			lower := spectrogramColour(spectrogram.Level(frame, band-1))
+			line.WriteString(lipgloss.NewStyle().Foreground(upper).Background(lower).Render("▀"))
+		}
+		lines = append(lines, line.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// The spectrogram panel shown under the list, kept at a fixed height so the viewport doesn't jump around
+func (m Model) SpectrogramPanelView() string {
+	if !m.ShowSpectrogram {
+		return ""
+	}
+	width := max(m.Viewport.Width, 1)
+	blank := strings.Repeat(strings.Repeat(" ", width)+"\n", audio.SpectrogramBands/2-1) + strings.Repeat(" ", width)
+	var label, body string
+	switch {
+	case m.spectrogramPath == "":
+		label, body = "spectrogram: no file selected", blank
+	case m.spectrogramErr != nil:
+		label, body = fmt.Sprintf("spectrogram: %v", m.spectrogramErr), blank
+	case m.Spectrogram == nil:
+		label, body = fmt.Sprintf("spectrogram: analysing %s", path.Base(m.spectrogramPath)), blank
+	default:
+		label, body = fmt.Sprintf("spectrogram: %s", path.Base(m.spectrogramPath)), SpectrogramView(*m.Spectrogram, width)
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, HelpKeyStyle.Render(label), body)
+}
+
+// Request the spectrogram for whatever is under the cursor, if the panel is open and it isn't already loaded
+func (m Model) RequestSpectrogram(cmd tea.Cmd) (Model, tea.Cmd) {
+	if !m.ShowSpectrogram {
+		return m, cmd
+	}
+	filePath := m.SelectedFilePath()
+	if filePath == m.spectrogramPath {
+		return m, cmd
+	}
+	m.spectrogramPath = filePath
+	m.Spectrogram = nil
+	m.spectrogramErr = nil
+	if filePath == "" {
+		return m, cmd
+	}
+	return m, tea.Batch(cmd, loadSpectrogram(m.Server, filePath))
+}
+
+// Store a loaded spectrogram if it's still the one we're waiting for
+func (m Model) HandleSpectrogramMsg(msg SpectrogramMsg) Model {
+	if msg.Path != m.spectrogramPath {
+		return m
+	}
+	if msg.Err != nil {
+		m.spectrogramErr = msg.Err
+		return m.SetStatus("spectrogram", msg.Err.Error())
+	}
+	m.Spectrogram = &msg.Spectrogram
+	return m
+}
+
+// Open or close the spectrogram panel
+func (m Model) ToggleSpectrogram() Model {
+	m.ShowSpectrogram = !m.ShowSpectrogram
+	m.spectrogramPath = ""
+	m.Spectrogram = nil
+	m.spectrogramErr = nil
+	return m.ManuallyResizeWindow()
+}
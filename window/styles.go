@@ -42,6 +42,9 @@ var (
 			Foreground(Pink)
 	UnselectedStyle = lipgloss.NewStyle().
 			Border(lipgloss.HiddenBorder())
+	MarkedStyle = lipgloss.NewStyle().
+			Border(lipgloss.HiddenBorder()).
+			Foreground(Green)
 		// Form
 	FormStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("241")).
@@ -0,0 +1,30 @@
+package window
+
+import (
+	"fmt"
+	"log"
+	"path"
+)
+
+// ////////////////////// DIRECTORY TAGGING ////////////////////////
+
+// Tag everything beneath a directory into the target collection, showing how it went in the status bar
+func (m Model) TagDirectory(dir string, subCollection string, mirror bool) Model {
+	result, err := m.Server.TagDirectory(dir, subCollection, mirror)
+	if err != nil {
+		log.Printf("Failed to tag %s: %v", dir, err)
+		return m.SetStatus("tag", err.Error())
+	}
+	return m.SetStatus("tag", result.String())
+}
+
+// Take a file, or everything beneath a directory, out of the target collection
+func (m Model) UntagPath(filePath string) Model {
+	removed, err := m.Server.UntagPath(filePath)
+	if err != nil {
+		log.Printf("Failed to untag %s: %v", filePath, err)
+		return m.SetStatus("tag", err.Error())
+	}
+	m = m.refreshTags()
+	return m.SetStatus("tag", fmt.Sprintf("%s: %d removed", path.Base(filePath), removed))
+}